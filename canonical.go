@@ -0,0 +1,413 @@
+package yay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	_ VisitsDocumentNode = (*canonicalHandler)(nil)
+	_ VisitsSequenceNode = (*canonicalHandler)(nil)
+	_ VisitsMappingNode  = (*canonicalHandler)(nil)
+	_ VisitsScalarNode   = (*canonicalHandler)(nil)
+	_ VisitsAliasNode    = (*canonicalHandler)(nil)
+)
+
+type canonicalOptions struct {
+	sortKeys bool
+}
+
+// CanonicalOpt is an option for Hash and NewCanonicalHandler
+type CanonicalOpt func(o *canonicalOptions)
+
+// WithSortedKeys is an option for Hash and NewCanonicalHandler which disregards the order of mapping keys, by sorting
+// mapping entries by their canonical key.
+func WithSortedKeys() CanonicalOpt {
+	return func(o *canonicalOptions) {
+		o.sortKeys = true
+	}
+}
+
+func canonicalOptionsOf(opts []CanonicalOpt) canonicalOptions {
+	o := canonicalOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Hash computes a stable SHA-256 content hash of node and its descendants, returned as a hex string.
+//
+// The hash is of the node's canonical form, so it is unaffected by formatting, comments, anchors, quoting or other
+// scalar styles, and whether a node is written inline or as an alias. Merge keys are resolved, and scalars are
+// compared by their resolved value (e.g. 0x10 and 16 are equal integers, while "16" is a distinct string).
+// Key order is significant unless WithSortedKeys is provided.
+//
+// Hash may be invoked on any subtree, such as within a VisitsMappingNode handler to fingerprint each resource of a document.
+func Hash(node *yaml.Node, opts ...CanonicalOpt) string {
+	h := &hasher{hash: sha256.New(), options: canonicalOptionsOf(opts), active: make(map[*yaml.Node]int)}
+	h.write(node)
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+type hasher struct {
+	hash    hash.Hash
+	options canonicalOptions
+	// active are the nodes currently being hashed, by depth, as aliases may refer to an ancestor
+	active map[*yaml.Node]int
+}
+
+func (h *hasher) writeString(kind byte, s string) {
+	var length [binary.MaxVarintLen64]byte
+	h.hash.Write([]byte{kind})
+	h.hash.Write(length[:binary.PutUvarint(length[:], uint64(len(s)))])
+	h.hash.Write([]byte(s))
+}
+
+func (h *hasher) write(node *yaml.Node) {
+	node = resolveAlias(node)
+	if node == nil {
+		h.writeString('n', "")
+		return
+	}
+	if depth, ok := h.active[node]; ok {
+		// a recursive alias is hashed by the depth of the node it refers to
+		h.writeString('r', strconv.Itoa(depth))
+		return
+	}
+	h.active[node] = len(h.active)
+	defer delete(h.active, node)
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		h.writeString('d', strconv.Itoa(len(node.Content)))
+		for _, child := range node.Content {
+			h.write(child)
+		}
+	case yaml.SequenceNode:
+		h.writeString('s', strconv.Itoa(len(node.Content)))
+		for _, child := range node.Content {
+			h.write(child)
+		}
+	case yaml.MappingNode:
+		entries := mergedEntries(node)
+		if h.options.sortKeys {
+			sortEntries(entries, h.options)
+		}
+		h.writeString('m', strconv.Itoa(len(entries)))
+		for _, entry := range entries {
+			h.write(entry.key)
+			h.write(entry.value)
+		}
+	case yaml.ScalarNode:
+		tag, value := canonicalScalar(node)
+		h.writeString('t', tag)
+		h.writeString('v', value)
+	}
+}
+
+// entry is a key/value pair of a mapping
+type entry struct {
+	key   *yaml.Node
+	value *yaml.Node
+	// merged entries are those of a merge source, rather than the mapping itself
+	merged bool
+}
+
+// resolveAlias returns the node anchored by node, following aliases of aliases
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// isMergeKey determines whether key is a merge key, i.e. << (see https://yaml.org/type/merge.html)
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.Value == "<<" && (key.Tag == "" || key.Tag == "!!merge" || key.Tag == "tag:yaml.org,2002:merge")
+}
+
+// mergeSources returns the mappings merged by the value of a merge key, in order of precedence
+func mergeSources(value *yaml.Node) []*yaml.Node {
+	value = resolveAlias(value)
+	if value == nil {
+		return nil
+	}
+	switch value.Kind {
+	case yaml.MappingNode:
+		return []*yaml.Node{value}
+	case yaml.SequenceNode:
+		sources := make([]*yaml.Node, 0, len(value.Content))
+		for _, item := range value.Content {
+			if source := resolveAlias(item); source != nil && source.Kind == yaml.MappingNode {
+				sources = append(sources, source)
+			}
+		}
+		return sources
+	}
+	return nil
+}
+
+// mergedEntries resolves the entries of a mapping according to its merge keys. Keys of the mapping itself take
+// precedence over merged keys, and keys of earlier merge sources take precedence over later sources. Merged entries
+// are positioned at the merge key, and merge sources are resolved recursively.
+func mergedEntries(mapping *yaml.Node) []entry {
+	return mergedEntriesOf(mapping, make(map[*yaml.Node]struct{}))
+}
+
+func mergedEntriesOf(mapping *yaml.Node, resolving map[*yaml.Node]struct{}) []entry {
+	resolving[mapping] = struct{}{}
+	defer delete(resolving, mapping)
+
+	own := make(map[string]struct{})
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if !isMergeKey(mapping.Content[i]) {
+			own[entryKey(mapping.Content[i])] = struct{}{}
+		}
+	}
+
+	entries := make([]entry, 0, len(mapping.Content)/2)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if !isMergeKey(key) {
+			entries = append(entries, entry{key: key, value: value})
+			continue
+		}
+		for _, source := range mergeSources(value) {
+			if _, ok := resolving[source]; ok {
+				continue
+			}
+			for _, merged := range mergedEntriesOf(source, resolving) {
+				k := entryKey(merged.key)
+				if _, ok := own[k]; ok {
+					continue
+				}
+				own[k] = struct{}{}
+				merged.merged = true
+				entries = append(entries, merged)
+			}
+		}
+	}
+	return entries
+}
+
+// entryKey identifies a mapping key by its canonical form
+func entryKey(key *yaml.Node) string {
+	key = resolveAlias(key)
+	if key != nil && key.Kind == yaml.ScalarNode {
+		tag, value := canonicalScalar(key)
+		return tag + "\x00" + value
+	}
+	return Hash(key)
+}
+
+func sortEntries(entries []entry, options canonicalOptions) {
+	keys := make(map[*yaml.Node]string, len(entries))
+	for _, e := range entries {
+		key := resolveAlias(e.key)
+		if key != nil && key.Kind == yaml.ScalarNode {
+			_, keys[e.key] = canonicalScalar(key)
+		} else {
+			keys[e.key] = "\xff" + Hash(e.key, func(o *canonicalOptions) { *o = options })
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		return strings.Compare(keys[a.key], keys[b.key])
+	})
+}
+
+// canonicalScalar returns the resolved tag and canonical value of a scalar, such that equal values of different
+// representations are identical, e.g. 0x10 and 16, or ~ and null.
+func canonicalScalar(node *yaml.Node) (string, string) {
+	tag := node.ShortTag()
+	value := node.Value
+	switch tag {
+	case "!!null":
+		return tag, "null"
+	case "!!bool":
+		return tag, strings.ToLower(value)
+	case "!!int":
+		plain := strings.ReplaceAll(value, "_", "")
+		if strings.HasPrefix(plain, "0o") || strings.HasPrefix(plain, "-0o") || strings.HasPrefix(plain, "+0o") {
+			plain = strings.Replace(plain, "0o", "0", 1)
+		}
+		if n, ok := new(big.Int).SetString(plain, 0); ok {
+			return tag, n.String()
+		}
+	case "!!float":
+		switch strings.ToLower(value) {
+		case ".inf", "+.inf":
+			return tag, ".inf"
+		case "-.inf":
+			return tag, "-.inf"
+		case ".nan":
+			return tag, ".nan"
+		}
+		if f, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64); err == nil && !math.IsInf(f, 0) {
+			s := strconv.FormatFloat(f, 'g', -1, 64)
+			if !strings.ContainsAny(s, ".eIN") {
+				// retain a decimal point, such that the canonical value still resolves as a float
+				s += ".0"
+			}
+			return tag, s
+		}
+	}
+	return tag, value
+}
+
+// canonicalHandler rewrites a document into the canonical form used by Hash.
+// See NewCanonicalHandler for more information.
+type canonicalHandler struct {
+	options canonicalOptions
+	// expansions are the aliases replaced by copies of their anchored nodes, mapped to the anchored node
+	expansions map[*yaml.Node]*yaml.Node
+}
+
+// VisitDocumentNode removes the comments of the document and rewrites its root node, as the visitor doesn't visit a document's root node.
+func (c *canonicalHandler) VisitDocumentNode(ctx context.Context, key *yaml.Node) error {
+	c.expansions = make(map[*yaml.Node]*yaml.Node)
+	clearPresentation(key)
+	if len(key.Content) == 0 {
+		return nil
+	}
+	root := key.Content[0]
+	switch root.Kind {
+	case yaml.SequenceNode:
+		return c.VisitSequenceNode(ctx, nil, root)
+	case yaml.MappingNode:
+		return c.VisitMappingNode(ctx, nil, root)
+	case yaml.ScalarNode:
+		return c.VisitScalarNode(ctx, nil, root)
+	}
+	return nil
+}
+
+// VisitSequenceNode removes the presentation details of the sequence
+func (c *canonicalHandler) VisitSequenceNode(_ context.Context, _ *yaml.Node, value *yaml.Node) error {
+	clearPresentation(value)
+	return nil
+}
+
+// VisitMappingNode resolves merge keys, canonicalizes scalar keys, and sorts entries if configured
+func (c *canonicalHandler) VisitMappingNode(_ context.Context, _ *yaml.Node, value *yaml.Node) error {
+	entries := mergedEntries(value)
+	if c.options.sortKeys {
+		sortEntries(entries, c.options)
+	}
+
+	content := make([]*yaml.Node, 0, len(entries)*2)
+	for _, e := range entries {
+		key, val := e.key, e.value
+		if e.merged {
+			// merged nodes belong to the merge source, which is canonicalized separately
+			key, val = cloneNode(key), cloneNode(val)
+		}
+		if key.Kind == yaml.AliasNode {
+			key = cloneNode(resolveAlias(key))
+		}
+		canonicalize(key)
+		content = append(content, key, val)
+	}
+	value.Content = content
+	clearPresentation(value)
+	return nil
+}
+
+// VisitScalarNode rewrites the scalar to its canonical value
+func (c *canonicalHandler) VisitScalarNode(_ context.Context, _ *yaml.Node, value *yaml.Node) error {
+	canonicalizeScalar(value)
+	return nil
+}
+
+// VisitAliasNode replaces the alias with a copy of its anchored node, which is then visited in place of the alias.
+// A recursive alias, referring to a node it's nested within, can't be expanded and results in an error.
+func (c *canonicalHandler) VisitAliasNode(ctx context.Context, _ *yaml.Node, value *yaml.Node) error {
+	if target := resolveAlias(value); target != nil {
+		if c.expanding(ctx, target) {
+			return &NodeError{Node: value, Err: fmt.Errorf("recursive alias *%s can't be expanded", value.Value)}
+		}
+		if c.expansions == nil {
+			c.expansions = make(map[*yaml.Node]*yaml.Node)
+		}
+		c.expansions[value] = target
+		*value = *copyTree(target)
+		clearPresentation(value)
+		if value.Kind == yaml.ScalarNode {
+			canonicalizeScalar(value)
+		}
+	}
+	return nil
+}
+
+// copyTree copies node and its descendants. Unlike cloneNode, aliases continue to refer to the anchored nodes of the
+// original document, such that the expansion of a recursive alias is still recognized by expanding.
+func copyTree(node *yaml.Node) *yaml.Node {
+	result := *node
+	if node.Content != nil {
+		result.Content = make([]*yaml.Node, len(node.Content))
+		for i, child := range node.Content {
+			result.Content[i] = copyTree(child)
+		}
+	}
+	return &result
+}
+
+// expanding determines whether target is an ancestor of the visited node, or has been expanded in place of an ancestor
+func (c *canonicalHandler) expanding(ctx context.Context, target *yaml.Node) bool {
+	t, ok := anyTraversalFrom(ctx)
+	if !ok {
+		return false
+	}
+	for _, f := range t.frames[:len(t.frames)-1] {
+		if f.node == target || c.expansions[f.node] == target {
+			return true
+		}
+	}
+	return false
+}
+
+func clearPresentation(node *yaml.Node) {
+	node.HeadComment = ""
+	node.LineComment = ""
+	node.FootComment = ""
+	node.Anchor = ""
+	node.Style = 0
+}
+
+func canonicalizeScalar(node *yaml.Node) {
+	node.Tag, node.Value = canonicalScalar(node)
+	clearPresentation(node)
+}
+
+// canonicalize rewrites node and its descendants, which aren't otherwise visited (such as complex mapping keys)
+func canonicalize(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		canonicalizeScalar(node)
+		return
+	}
+	clearPresentation(node)
+	for _, child := range node.Content {
+		canonicalize(child)
+	}
+}
+
+// NewCanonicalHandler creates a handler which rewrites a document into the canonical form used by Hash: comments,
+// anchors, and styles are removed, aliases are replaced by copies of their anchored nodes, merge keys are resolved,
+// and scalars are rewritten to their canonical values (e.g. 0x10 becomes 16, and ~ becomes null).
+// Mapping entries are sorted by key when WithSortedKeys is provided.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func NewCanonicalHandler(opts ...CanonicalOpt) *canonicalHandler {
+	return &canonicalHandler{options: canonicalOptionsOf(opts)}
+}
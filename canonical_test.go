@@ -0,0 +1,253 @@
+package yay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestHash(t *testing.T) {
+	tests := map[string]struct {
+		a     string
+		b     string
+		opts  []CanonicalOpt
+		equal bool
+	}{
+		"ignores comments and formatting": {
+			a:     "a: 1 # one\nb: [x, y]",
+			b:     "# heading\na:   1\nb:\n  - x\n  - y\n",
+			equal: true,
+		},
+		"ignores quoting style": {
+			a:     `a: "text"`,
+			b:     "a: |-\n  text",
+			equal: true,
+		},
+		"compares scalars by resolved value": {
+			a:     "a: 0x10\nb: ~\nc: True\nd: 1_000\ne: 1.50",
+			b:     "a: 16\nb: null\nc: true\nd: 1000\ne: 1.5",
+			equal: true,
+		},
+		"distinguishes strings from other types": {
+			a: `a: 16`,
+			b: `a: "16"`,
+		},
+		"resolves aliases": {
+			a:     "base: &b {x: 1}\nuse: *b",
+			b:     "base: {x: 1}\nuse: {x: 1}",
+			equal: true,
+		},
+		"resolves merge keys": {
+			a:     "base: &b {x: 1, y: 2}\nuse:\n  <<: *b\n  y: 3",
+			b:     "base: {x: 1, y: 2}\nuse: {x: 1, y: 3}",
+			equal: true,
+		},
+		"resolves merge sequences by precedence": {
+			a:     "a: &a {x: 1}\nb: &b {x: 2, y: 2}\nuse: {<<: [*a, *b]}",
+			b:     "a: {x: 1}\nb: {x: 2, y: 2}\nuse: {x: 1, y: 2}",
+			equal: true,
+		},
+		"respects key order by default": {
+			a: "a: 1\nb: 2",
+			b: "b: 2\na: 1",
+		},
+		"ignores key order when sorted": {
+			a:     "a: 1\nb: {d: 1, c: 2}",
+			b:     "b: {c: 2, d: 1}\na: 1",
+			opts:  []CanonicalOpt{WithSortedKeys()},
+			equal: true,
+		},
+		"distinguishes sequences from mappings": {
+			a: "a: [x]",
+			b: "a: {x: }",
+		},
+		"distinguishes custom tags": {
+			a: "a: !secret x",
+			b: "a: x",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var a, b yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.a), &a))
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.b), &b))
+			if tt.equal {
+				assert.Equal(t, Hash(&a, tt.opts...), Hash(&b, tt.opts...))
+			} else {
+				assert.NotEqual(t, Hash(&a, tt.opts...), Hash(&b, tt.opts...))
+			}
+		})
+	}
+}
+
+func TestHash_subtrees(t *testing.T) {
+	input := trimmed(`kind: List
+		|items:
+		|  - kind: ConfigMap
+		|    metadata: {name: a}
+		|  # the same resource, formatted differently
+		|  - kind: "ConfigMap"
+		|    metadata:
+		|      name: 'a'
+		|  - kind: Secret
+		|    metadata: {name: a}`)
+
+	hashes := make([]string, 0)
+	handler, err := NewConditionalHandler(
+		OnVisitMappingNode("$.items[*]", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+			hashes = append(hashes, Hash(value))
+			return nil
+		}),
+	)
+	assert.NoError(t, err)
+	v, err := NewVisitor(handler)
+	assert.NoError(t, err)
+
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+	assert.NoError(t, v.Visit(context.TODO(), &doc))
+
+	assert.Len(t, hashes, 3)
+	assert.Equal(t, hashes[0], hashes[1])
+	assert.NotEqual(t, hashes[0], hashes[2])
+}
+
+func TestHash_recursiveAlias(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("a: &a\n  b: *a"), &doc))
+	assert.NotPanics(t, func() {
+		assert.NotEmpty(t, Hash(&doc))
+	})
+}
+
+func TestNewCanonicalHandler(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []CanonicalOpt
+		expected string
+	}{
+		"removes comments, anchors, and styles": {
+			input: trimmed(`# heading
+				|a: &a "text" # trailing
+				|b: [x, 'y']
+				|c: *a`),
+			expected: trimmed(`a: text
+				|b:
+				|    - x
+				|    - y
+				|c: text
+`),
+		},
+		"canonicalizes scalar values": {
+			input:    "a: 0x10\nb: ~\nc: TRUE\nd: 1_000.50\n0o10: e",
+			expected: "a: 16\nb: null\nc: true\nd: 1000.5\n8: e\n",
+		},
+		"expands aliases and merge keys": {
+			input: trimmed(`base: &base {x: 1, y: 2}
+				|use:
+				|  <<: *base
+				|  y: 3
+				|  z: *base`),
+			expected: trimmed(`base:
+				|    x: 1
+				|    y: 2
+				|use:
+				|    x: 1
+				|    y: 3
+				|    z:
+				|        x: 1
+				|        y: 2
+`),
+		},
+		"sorts keys": {
+			input: "b: {d: 1, c: 2}\na: [z, y]",
+			opts:  []CanonicalOpt{WithSortedKeys()},
+			expected: trimmed(`a:
+				|    - z
+				|    - y
+				|b:
+				|    c: 2
+				|    d: 1
+`),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), &doc))
+			before := Hash(&doc, tt.opts...)
+
+			v, err := NewVisitor(NewCanonicalHandler(tt.opts...))
+			assert.NoError(t, err)
+			assert.NoError(t, v.Visit(context.TODO(), &doc))
+
+			out, err := yaml.Marshal(&doc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(out))
+			assert.Equal(t, before, Hash(&doc, tt.opts...), "canonicalizing should not change the hash")
+		})
+	}
+}
+
+func TestNewCanonicalHandler_recursiveAlias(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		err   string
+	}{
+		"alias of an ancestor": {
+			input: "a: &a\n  - x\n  - *a\n",
+			err:   "3:5: recursive alias *a can't be expanded",
+		},
+		"alias of an ancestor within a mapping": {
+			input: "a: &a\n  b: *a\n",
+			err:   "2:6: recursive alias *a can't be expanded",
+		},
+		"alias of an ancestor within an expansion": {
+			input: "a: &a\n  - x\n  - y\nb: &b\n  - *a\n  - c: *b\n",
+			err:   "6:8: recursive alias *b can't be expanded",
+		},
+		"alias of an expanded ancestor": {
+			input: "b: &b\n  c: &c\n    - *b\nx: *c\n",
+			err:   "3:7: recursive alias *b can't be expanded\n3:7: recursive alias *b can't be expanded",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), &doc))
+
+			v, err := NewVisitor(NewCanonicalHandler())
+			assert.NoError(t, err)
+			done := make(chan error, 1)
+			go func() { done <- v.Visit(context.TODO(), &doc) }()
+			select {
+			case err := <-done:
+				assert.EqualError(t, err, tt.err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("canonicalizing a recursive alias should terminate")
+			}
+		})
+	}
+}
+
+func TestNewCanonicalHandler_mergedNodes(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("base: &base {x: 1}\nuse: {<<: *base, y: 2}\n"), &doc))
+
+	v, err := NewVisitor(NewCanonicalHandler())
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), &doc))
+
+	// merged entries are copies, so changing them doesn't change the merge source
+	base, use := doc.Content[0].Content[1], doc.Content[0].Content[3]
+	assert.NotSame(t, base.Content[0], use.Content[0])
+	assert.NotSame(t, base.Content[1], use.Content[1])
+	use.Content[1].Value = "3"
+
+	out, err := yaml.Marshal(&doc)
+	assert.NoError(t, err)
+	assert.Equal(t, "base:\n    x: 1\nuse:\n    x: 3\n    y: 2\n", string(out))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jimschubert/yay"
+	"github.com/jimschubert/yay/lsp"
+)
+
+// rules are the handlers which may be enabled by id for diagnostics
+var rules = map[string]func() any{
+	"yaml11":         func() any { return yay.NewYAML11Handler() },
+	"duplicate-keys": func() any { return yay.NewDuplicateKeyHandler() },
+}
+
+var severities = map[string]lsp.DiagnosticSeverity{
+	"error":       lsp.SeverityError,
+	"warning":     lsp.SeverityWarning,
+	"information": lsp.SeverityInformation,
+	"hint":        lsp.SeverityHint,
+}
+
+func ruleIDs() []string {
+	ids := make([]string, 0, len(rules))
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func runLSP(e env, args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	enabled := flags.String("rules", strings.Join(ruleIDs(), ","), "comma separated rules reported as diagnostics")
+	severity := flags.String("severity", "warning", "severity of diagnostics: error, warning, information, or hint")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(e.stderr, "Usage: yay lsp [flags]")
+		_, _ = fmt.Fprintln(e.stderr)
+		_, _ = fmt.Fprintln(e.stderr, "Runs a Language Server Protocol server over standard input and output, reporting the diagnostics")
+		_, _ = fmt.Fprintln(e.stderr, "of yay rules for open YAML documents.")
+		_, _ = fmt.Fprintln(e.stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	factories := make([]func() any, 0)
+	for _, id := range strings.Split(*enabled, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		factory, ok := rules[id]
+		if !ok {
+			_, _ = fmt.Fprintf(e.stderr, "yay lsp: unknown rule %q, expected one of %s\n", id, strings.Join(ruleIDs(), ", "))
+			return exitError
+		}
+		factories = append(factories, factory)
+	}
+	level, ok := severities[*severity]
+	if !ok {
+		_, _ = fmt.Fprintf(e.stderr, "yay lsp: unknown severity %q\n", *severity)
+		return exitError
+	}
+
+	server := lsp.NewServer(
+		lsp.WithHandlers(func() []any {
+			handlers := make([]any, 0, len(factories))
+			for _, factory := range factories {
+				handlers = append(handlers, factory())
+			}
+			return handlers
+		}),
+		lsp.WithSeverity(level),
+	)
+	if err := server.Serve(context.Background(), e.stdin, e.stdout); err != nil {
+		_, _ = fmt.Fprintf(e.stderr, "yay lsp: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunLSP(t *testing.T) {
+	frame := func(body string) string {
+		return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+
+	tests := map[string]struct {
+		args     []string
+		stdin    string
+		contains []string
+		stderr   string
+		code     int
+	}{
+		"serves over stdio": {
+			args: []string{"-rules", "duplicate-keys", "-severity", "error"},
+			stdin: frame(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`) +
+				frame(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.yaml","version":1,"text":"a: on\na: 2\n"}}}`) +
+				frame(`{"jsonrpc":"2.0","method":"exit"}`),
+			contains: []string{`"hoverProvider":true`, `"code":"duplicate-keys"`, `"severity":1`},
+		},
+		"rejects unknown rules": {
+			args:   []string{"-rules", "yaml11,tabs"},
+			stderr: "yay lsp: unknown rule \"tabs\", expected one of duplicate-keys, yaml11\n",
+			code:   exitError,
+		},
+		"rejects unknown severities": {
+			args:   []string{"-severity", "fatal"},
+			stderr: "yay lsp: unknown severity \"fatal\"\n",
+			code:   exitError,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(env{stdin: strings.NewReader(tt.stdin), stdout: &stdout, stderr: &stderr}, append([]string{"lsp"}, tt.args...))
+			assert.Equal(t, tt.code, code)
+			assert.Equal(t, tt.stderr, stderr.String())
+			for _, s := range tt.contains {
+				assert.Contains(t, stdout.String(), s)
+			}
+			assert.NotContains(t, stdout.String(), `"code":"yaml11"`)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Command yay exposes the utilities of the yay library to the command line.
+//
+// Usage:
+//
+//	yay <command> [flags] [arguments]
+//
+// Commands:
+//
+//	lsp        run a Language Server Protocol server reporting yay rules
+//	normalize  rewrite files, consolidating multiple merge keys
+//	query      print the nodes selected by a YAML JSONPath expression or glob
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Exit codes, following the convention of grep
+const (
+	exitOK      = 0
+	exitNoMatch = 1
+	exitError   = 2
+)
+
+// env provides commands with their standard streams, allowing commands to be tested in-process
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command runs with its arguments, excluding the command name, and returns the exit code
+type command struct {
+	summary string
+	run     func(e env, args []string) int
+}
+
+var commands = map[string]command{
+	"lsp":       {summary: "run a Language Server Protocol server reporting yay rules", run: runLSP},
+	"normalize": {summary: "rewrite files, consolidating multiple merge keys", run: runNormalize},
+	"query":     {summary: "print the nodes selected by a YAML JSONPath expression or glob", run: runQuery},
+}
+
+func main() {
+	os.Exit(run(env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:]))
+}
+
+func run(e env, args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(e.stderr)
+		return exitError
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		_, _ = fmt.Fprintf(e.stderr, "yay: unknown command %q\n\n", args[0])
+		usage(e.stderr)
+		return exitError
+	}
+	return cmd.run(e, args[1:])
+}
+
+func usage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "Usage: yay <command> [flags] [arguments]")
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Run 'yay <command> -h' for the flags of a command.")
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jimschubert/yay"
+	"go.yaml.in/yaml/v3"
+)
+
+// patterns is a repeatable flag of comma separated glob patterns
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(value string) error {
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		*p = append(*p, pattern)
+	}
+	return nil
+}
+
+// matches determines whether any pattern matches the base name of path, or path relative to the walked directory
+func (p *patterns) matches(path string, rel string) bool {
+	for _, pattern := range *p {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.ToSlash(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// collectFiles expands paths, recursing into directories for files matching include and not matching exclude.
+// Files named explicitly are always included.
+func collectFiles(paths []string, include *patterns, exclude *patterns) ([]string, error) {
+	files := make([]string, 0)
+	for _, root := range paths {
+		if root == stdinName {
+			files = append(files, root)
+			continue
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, root)
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			if path != root && exclude.matches(path, rel) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.IsDir() && include.matches(path, rel) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// normalize applies the handlers to each document of source, returning the source with minimal edits applied
+func normalize(source []byte, handlers func() []any) ([]byte, error) {
+	docs, err := decodeAll(source)
+	if err != nil {
+		return nil, err
+	}
+
+	edits := make([]yay.TextEdit, 0)
+	for _, doc := range docs {
+		tracker, err := yay.TrackSource(source, doc)
+		if err != nil {
+			return nil, err
+		}
+		v, err := yay.NewVisitor(handlers()...)
+		if err != nil {
+			return nil, err
+		}
+		if err := prepareMergeKeys(doc); err != nil {
+			return nil, err
+		}
+		if err := v.Visit(context.Background(), doc); err != nil {
+			return nil, err
+		}
+		finishMergeKeys(doc)
+		docEdits, err := tracker.Edits()
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, docEdits...)
+	}
+	return yay.ApplyEdits(source, edits)
+}
+
+// prepareMergeKeys verifies that each merge key merges an alias or a sequence of aliases, as the merge key handler
+// would otherwise drop other values, such as inline mappings. The comments of merge keys and their values are moved
+// to the first merge key of each mapping, which is retained as the consolidated merge key, as comments of aliases
+// within the consolidated flow sequence would otherwise be written inside of it.
+func prepareMergeKeys(node *yaml.Node) error {
+	var errs error
+	if node.Kind == yaml.MappingNode {
+		var consolidated *yaml.Node
+		var heads, lines, foots []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if !isMergeKey(key) {
+				continue
+			}
+			if !mergesAliases(value) {
+				errs = errors.Join(errs, &yay.NodeError{Node: value, Err: errors.New("unable to normalize a merge key whose value isn't an alias or a sequence of aliases")})
+				continue
+			}
+			if consolidated == nil {
+				consolidated = key
+			}
+			for _, n := range append([]*yaml.Node{key, value}, value.Content...) {
+				heads = appendComment(heads, &n.HeadComment)
+				lines = appendComment(lines, &n.LineComment)
+				foots = appendComment(foots, &n.FootComment)
+			}
+		}
+		if consolidated != nil {
+			consolidated.HeadComment = strings.Join(heads, "\n")
+			consolidated.LineComment = strings.Join(lines, " ")
+			consolidated.FootComment = strings.Join(foots, "\n")
+		}
+	}
+	for _, child := range node.Content {
+		errs = errors.Join(errs, prepareMergeKeys(child))
+	}
+	return errs
+}
+
+// isMergeKey determines whether key is a merge key, i.e. << (see https://yaml.org/type/merge.html)
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.Value == "<<" && key.ShortTag() == "!!merge"
+}
+
+// mergesAliases determines whether value of a merge key is an alias or a sequence of aliases
+func mergesAliases(value *yaml.Node) bool {
+	switch value.Kind {
+	case yaml.AliasNode:
+		return true
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if item.Kind != yaml.AliasNode {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// appendComment moves the comment to comments, if any
+func appendComment(comments []string, comment *string) []string {
+	if *comment == "" {
+		return comments
+	}
+	comments = append(comments, *comment)
+	*comment = ""
+	return comments
+}
+
+// finishMergeKeys prepares consolidated merge keys to be encoded. The implicit !!merge tag of merge keys is cleared, as
+// it would otherwise be written explicitly when a rewritten mapping is encoded, resulting in !!merge <<: rather than
+// <<: as written by the user, while tags written explicitly by the user are retained. Line comments of merge keys are
+// moved to their values, as yaml.v3 writes the line comment of a key whose value is a flow collection after the
+// following entry.
+func finishMergeKeys(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if !isMergeKey(key) {
+				continue
+			}
+			if key.Tag == "!!merge" && key.Style&yaml.TaggedStyle == 0 {
+				key.Tag = ""
+			}
+			if key.LineComment != "" && value.LineComment == "" {
+				value.LineComment, key.LineComment = key.LineComment, ""
+			}
+		}
+	}
+	for _, child := range node.Content {
+		finishMergeKeys(child)
+	}
+}
+
+func runNormalize(e env, args []string) int {
+	flags := flag.NewFlagSet("normalize", flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	write := flags.Bool("w", false, "write the result to each file, rather than to standard output")
+	check := flags.Bool("check", false, "don't write any output, and exit with 1 if any file would change")
+	retainMergeKeyOrder := flags.Bool("retain-merge-key-order", false, "retain the order of multiple merge keys, rather than reversing them so later keys take precedence")
+	include := &patterns{}
+	exclude := &patterns{}
+	flags.Var(include, "include", "comma separated globs of files to process within directories (default \"*.yaml,*.yml\")")
+	flags.Var(exclude, "exclude", "comma separated globs of files or directories to skip within directories")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(e.stderr, "Usage: yay normalize [flags] [files or directories...]")
+		_, _ = fmt.Fprintln(e.stderr)
+		_, _ = fmt.Fprintln(e.stderr, "Rewrites multiple merge keys of each mapping into a single merge key, editing only the changed")
+		_, _ = fmt.Fprintln(e.stderr, "mappings. Directories are processed recursively; standard input is read if no paths are provided.")
+		_, _ = fmt.Fprintln(e.stderr, "Files with merge keys of values other than aliases or sequences of aliases are reported, and left unchanged.")
+		_, _ = fmt.Fprintln(e.stderr, "Exits with 0 on success, 1 if -check found a file which would change, or 2 on error.")
+		_, _ = fmt.Fprintln(e.stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if len(*include) == 0 {
+		_ = include.Set("*.yaml,*.yml")
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{stdinName}
+	}
+	files, err := collectFiles(paths, include, exclude)
+	if err != nil {
+		_, _ = fmt.Fprintf(e.stderr, "yay normalize: %v\n", err)
+		return exitError
+	}
+
+	handlers := func() []any {
+		opts := make([]yay.MultipleMergeKeyOpt, 0)
+		if *retainMergeKeyOrder {
+			opts = append(opts, yay.WithRetainMergeKeyOrder())
+		}
+		return []any{yay.NewMultipleToSingleMergeHandler(opts...)}
+	}
+
+	changed, failed := 0, 0
+	for _, in := range inputs(e, files) {
+		if err := normalizeFile(e, in, handlers, *write, *check, &changed); err != nil {
+			_, _ = fmt.Fprintf(e.stderr, "yay normalize: %s: %v\n", in.name, err)
+			failed++
+		}
+	}
+	_, _ = fmt.Fprintf(e.stderr, "%d file(s) processed, %d changed, %d failed\n", len(files), changed, failed)
+
+	switch {
+	case failed > 0:
+		return exitError
+	case *check && changed > 0:
+		return exitNoMatch
+	}
+	return exitOK
+}
+
+// normalizeFile normalizes a single input, writing the per-file summary
+func normalizeFile(e env, in input, handlers func() []any, write bool, check bool, changed *int) error {
+	if write && in.name == stdinName {
+		return errors.New("unable to write standard input in place")
+	}
+	source, err := in.read()
+	if err != nil {
+		return err
+	}
+	result, err := normalize(source, handlers)
+	if err != nil {
+		return err
+	}
+
+	status := "unchanged"
+	if !bytes.Equal(source, result) {
+		*changed++
+		status = "changed"
+		if check {
+			status = "would change"
+		}
+	}
+
+	switch {
+	case check:
+	case write && status == "changed":
+		info, err := os.Stat(in.name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(in.name, result, info.Mode().Perm()); err != nil {
+			return err
+		}
+	case !write:
+		if _, err := io.Copy(e.stdout, bytes.NewReader(result)); err != nil {
+			return err
+		}
+	}
+	_, _ = fmt.Fprintf(e.stderr, "%s: %s\n", in.name, status)
+	return nil
+}
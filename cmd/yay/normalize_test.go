@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const multipleMerges = `# defaults
+base: &base
+  a: A
+extra: &extra
+  b: B
+config:
+    <<: *base
+    <<: *extra
+    c:   C   # comment retained
+`
+
+const singleMerge = `# defaults
+base: &base
+  a: A
+extra: &extra
+  b: B
+config:
+    <<: [*extra, *base]
+    c: C   # comment retained
+`
+
+func TestRunNormalize(t *testing.T) {
+	setup := func(t *testing.T) string {
+		dir := t.TempDir()
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, "nested", "vendor"), 0o700))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte(multipleMerges), 0o600))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "b.yml"), []byte(singleMerge), 0o600))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "vendor", "c.yaml"), []byte(multipleMerges), 0o600))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "notes.txt"), []byte(multipleMerges), 0o600))
+		return dir
+	}
+
+	t.Run("writes to standard output", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run(env{stdin: strings.NewReader(multipleMerges), stdout: &stdout, stderr: &stderr}, []string{"normalize"})
+		assert.Equal(t, exitOK, code)
+		assert.Equal(t, singleMerge, stdout.String())
+		assert.Equal(t, "-: changed\n1 file(s) processed, 1 changed, 0 failed\n", stderr.String())
+	})
+
+	t.Run("retains merge key order", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run(env{stdin: strings.NewReader(multipleMerges), stdout: &stdout, stderr: &stderr}, []string{"normalize", "-retain-merge-key-order"})
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout.String(), "<<: [*base, *extra]\n")
+	})
+
+	t.Run("retains merge tags written explicitly", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		input := "a: &a {x: 1}\nb: &b {y: 2}\nc:\n  !!merge <<: *a\n  <<: *b\n"
+		code := run(env{stdin: strings.NewReader(input), stdout: &stdout, stderr: &stderr}, []string{"normalize"})
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout.String(), "!!merge <<: [*b, *a]\n")
+	})
+
+	t.Run("moves merge key comments to the consolidated merge key", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		input := "a: &a {x: 1}\nb: &b {y: 2}\nc:\n  # merged\n  <<: *a  # first\n  <<: *b\n  z: 3\n"
+		code := run(env{stdin: strings.NewReader(input), stdout: &stdout, stderr: &stderr}, []string{"normalize"})
+		assert.Equal(t, exitOK, code)
+		assert.Equal(t, "a: &a {x: 1}\nb: &b {y: 2}\nc:\n  # merged\n  <<: [*b, *a] # first\n  z: 3\n", stdout.String())
+	})
+
+	t.Run("refuses to rewrite merge keys of other values", func(t *testing.T) {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "inline.yaml")
+		input := "a: &a {x: 1}\nc:\n  <<: *a\n  <<: {m: 2}\n"
+		assert.NoError(t, os.WriteFile(file, []byte(input), 0o600))
+
+		var stdout, stderr bytes.Buffer
+		code := run(env{stdout: &stdout, stderr: &stderr}, []string{"normalize", "-w", file})
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, stderr.String(), "yay normalize: "+file+": 4:7: unable to normalize a merge key whose value isn't an alias or a sequence of aliases\n")
+		assert.Contains(t, stderr.String(), "1 file(s) processed, 0 changed, 1 failed\n")
+
+		actual, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.Equal(t, input, string(actual))
+	})
+
+	t.Run("rewrites directories in place", func(t *testing.T) {
+		dir := setup(t)
+		var stdout, stderr bytes.Buffer
+		code := run(env{stdout: &stdout, stderr: &stderr}, []string{"normalize", "-w", "-exclude", "vendor", dir})
+		assert.Equal(t, exitOK, code)
+		assert.Empty(t, stdout.String())
+		assert.Equal(t, filepath.Join(dir, "a.yaml")+": changed\n"+
+			filepath.Join(dir, "nested", "b.yml")+": unchanged\n"+
+			"2 file(s) processed, 1 changed, 0 failed\n", stderr.String())
+
+		for name, expected := range map[string]string{
+			"a.yaml":               singleMerge,
+			"nested/b.yml":         singleMerge,
+			"nested/vendor/c.yaml": multipleMerges,
+			"nested/notes.txt":     multipleMerges,
+		} {
+			actual, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, string(actual), name)
+		}
+	})
+
+	t.Run("checks without writing", func(t *testing.T) {
+		dir := setup(t)
+		var stdout, stderr bytes.Buffer
+		code := run(env{stdout: &stdout, stderr: &stderr}, []string{"normalize", "-check", "-include", "*.yml,*.yaml", dir})
+		assert.Equal(t, exitNoMatch, code)
+		assert.Empty(t, stdout.String())
+		assert.Contains(t, stderr.String(), filepath.Join(dir, "nested", "vendor", "c.yaml")+": would change\n")
+		assert.Contains(t, stderr.String(), "3 file(s) processed, 2 changed, 0 failed\n")
+
+		actual, err := os.ReadFile(filepath.Join(dir, "a.yaml"))
+		assert.NoError(t, err)
+		assert.Equal(t, multipleMerges, string(actual))
+	})
+
+	t.Run("passes checks of normalized files", func(t *testing.T) {
+		dir := setup(t)
+		var stdout, stderr bytes.Buffer
+		code := run(env{stdout: &stdout, stderr: &stderr}, []string{"normalize", "-check", filepath.Join(dir, "nested", "b.yml")})
+		assert.Equal(t, exitOK, code)
+	})
+
+	t.Run("reports invalid files", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run(env{stdin: strings.NewReader("a: [\n"), stdout: &stdout, stderr: &stderr}, []string{"normalize"})
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, stderr.String(), "yay normalize: -: ")
+		assert.Contains(t, stderr.String(), "1 file(s) processed, 0 changed, 1 failed\n")
+	})
+
+	t.Run("refuses to write standard input in place", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run(env{stdin: strings.NewReader(multipleMerges), stdout: &stdout, stderr: &stderr}, []string{"normalize", "-w"})
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, stderr.String(), "unable to write standard input in place")
+	})
+}
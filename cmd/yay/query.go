@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jimschubert/yay"
+	"github.com/vmware-labs/yaml-jsonpath/pkg/yamlpath"
+	"go.yaml.in/yaml/v3"
+)
+
+// stdinName is the file argument, and the file name printed, for standard input
+const stdinName = "-"
+
+// input is a named source of one or more YAML documents
+type input struct {
+	name string
+	read func() ([]byte, error)
+}
+
+// inputs returns the named files, or standard input if no files are named
+func inputs(e env, files []string) []input {
+	if len(files) == 0 {
+		files = []string{stdinName}
+	}
+	result := make([]input, 0, len(files))
+	for _, name := range files {
+		if name == stdinName {
+			result = append(result, input{name: name, read: func() ([]byte, error) { return io.ReadAll(e.stdin) }})
+			continue
+		}
+		result = append(result, input{name: name, read: func() ([]byte, error) { return os.ReadFile(name) }})
+	}
+	return result
+}
+
+// decodeAll decodes each document within source
+func decodeAll(source []byte) ([]*yaml.Node, error) {
+	docs := make([]*yaml.Node, 0)
+	dec := yaml.NewDecoder(bytes.NewReader(source))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, &doc)
+	}
+}
+
+// compileQuery validates a YAML JSONPath expression, or a glob (see yay.Glob) if the expression doesn't begin with $,
+// returning the YAML JSONPath expression. See queryDocument.
+func compileQuery(expr string) (string, error) {
+	path := expr
+	if !strings.HasPrefix(expr, "$") {
+		converted, err := yay.GlobToPath(expr)
+		if err != nil {
+			return "", err
+		}
+		path = converted
+	}
+	if _, err := yamlpath.NewPath(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// queryDocument finds the nodes of doc selected by path. As with a yay.ConditionalHandler, the path is bound to the
+// document, which resolves the anchors and aliases referenced by its filters.
+//
+// yamlpath evaluates a mapping containing a merge key as the mapping it merges, so the path is evaluated against a
+// view of doc in which merge keys are replaced by the entries they merge, and the matches are mapped back to doc.
+func queryDocument(path string, doc *yaml.Node) ([]*yaml.Node, error) {
+	view := &mergeView{copies: map[*yaml.Node]*yaml.Node{}, originals: map[*yaml.Node]*yaml.Node{}}
+	root := view.copy(doc)
+	p, err := yamlpath.NewPathWithRoot(path, root)
+	if err != nil {
+		return nil, err
+	}
+	found, err := p.Find(root)
+	if err != nil {
+		return nil, err
+	}
+	for i, node := range found {
+		if original, ok := view.originals[node]; ok {
+			found[i] = original
+		}
+	}
+	return found, nil
+}
+
+// mergeView copies a document, replacing the merge keys of its mappings with the entries they merge
+type mergeView struct {
+	copies    map[*yaml.Node]*yaml.Node
+	originals map[*yaml.Node]*yaml.Node
+}
+
+// copy returns the copy of node, in which aliases refer to the copies of their anchors. Keys of a mapping take
+// precedence over merged keys, and keys of earlier merge sources take precedence over later sources.
+func (v *mergeView) copy(node *yaml.Node) *yaml.Node {
+	if c, ok := v.copies[node]; ok {
+		return c
+	}
+	c := *node
+	result := &c
+	v.copies[node] = result
+	v.originals[result] = node
+	if node.Alias != nil {
+		result.Alias = v.copy(node.Alias)
+	}
+	result.Content = nil
+	if node.Kind != yaml.MappingNode {
+		for _, child := range node.Content {
+			result.Content = append(result.Content, v.copy(child))
+		}
+		return result
+	}
+
+	defined := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i]; !isMergeKey(key) && key.Kind == yaml.ScalarNode {
+			defined[key.Value] = true
+		}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if !isMergeKey(key) {
+			result.Content = append(result.Content, v.copy(key), v.copy(value))
+			continue
+		}
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+		for _, source := range sources {
+			for source.Kind == yaml.AliasNode && source.Alias != nil {
+				source = source.Alias
+			}
+			if source.Kind != yaml.MappingNode {
+				continue
+			}
+			// the copy of a merge source already contains the entries it merges
+			merged := v.copy(source).Content
+			for j := 0; j+1 < len(merged); j += 2 {
+				if merged[j].Kind == yaml.ScalarNode {
+					if defined[merged[j].Value] {
+						continue
+					}
+					defined[merged[j].Value] = true
+				}
+				result.Content = append(result.Content, merged[j], merged[j+1])
+			}
+		}
+	}
+	return result
+}
+
+// matchWriter writes the nodes matched by a query in one of the output formats
+type matchWriter func(w io.Writer, file string, node *yaml.Node) error
+
+var outputFormats = map[string]matchWriter{
+	"yaml": writeYAMLMatch,
+	"json": writeJSONMatch,
+	"line": writeLineMatch,
+}
+
+// writeYAMLMatch writes node as a YAML document
+func writeYAMLMatch(w io.Writer, _ string, node *yaml.Node) error {
+	if _, err := io.WriteString(w, "---\n"); err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// writeJSONMatch writes node as a single line of JSON
+func writeJSONMatch(w io.Writer, _ string, node *yaml.Node) error {
+	b, err := yay.ToJSON(node)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// writeLineMatch writes node as file:line:col: value, with collections written inline
+func writeLineMatch(w io.Writer, file string, node *yaml.Node) error {
+	value := node.Value
+	if node.Kind != yaml.ScalarNode {
+		inline := *node
+		inline.Style |= yaml.FlowStyle
+		inline.HeadComment, inline.LineComment, inline.FootComment = "", "", ""
+		b, err := yaml.Marshal(&inline)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimSpace(string(b))
+	}
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	_, err := fmt.Fprintf(w, "%s:%d:%d: %s\n", file, node.Line, node.Column, value)
+	return err
+}
+
+func runQuery(e env, args []string) int {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	output := flags.String("output", "yaml", "output format: yaml, json, or line (file:line:col: value)")
+	flags.StringVar(output, "o", "yaml", "shorthand for -output")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(e.stderr, "Usage: yay query [flags] <path> [files...]")
+		_, _ = fmt.Fprintln(e.stderr)
+		_, _ = fmt.Fprintln(e.stderr, "Prints the nodes selected by path, a YAML JSONPath expression (e.g. $.spec.containers[*].image)")
+		_, _ = fmt.Fprintln(e.stderr, "or glob (e.g. spec.containers.*.image), within each document of the files or standard input.")
+		_, _ = fmt.Fprintln(e.stderr, "Exits with 0 if any node matched, 1 if none matched, or 2 on error.")
+		_, _ = fmt.Fprintln(e.stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+	write, ok := outputFormats[*output]
+	if !ok {
+		_, _ = fmt.Fprintf(e.stderr, "yay query: unknown output format %q\n", *output)
+		return exitError
+	}
+	path, err := compileQuery(flags.Arg(0))
+	if err != nil {
+		_, _ = fmt.Fprintf(e.stderr, "yay query: %v\n", err)
+		return exitError
+	}
+
+	matched, failed := false, false
+	for _, in := range inputs(e, flags.Args()[1:]) {
+		source, err := in.read()
+		if err != nil {
+			_, _ = fmt.Fprintf(e.stderr, "yay query: %v\n", err)
+			failed = true
+			continue
+		}
+		docs, err := decodeAll(source)
+		if err != nil {
+			_, _ = fmt.Fprintf(e.stderr, "yay query: %s: %v\n", in.name, err)
+			failed = true
+			continue
+		}
+		for _, doc := range docs {
+			found, err := queryDocument(path, doc)
+			if err != nil {
+				_, _ = fmt.Fprintf(e.stderr, "yay query: %s: %v\n", in.name, err)
+				failed = true
+				continue
+			}
+			for _, node := range found {
+				matched = true
+				if err := write(e.stdout, in.name, node); err != nil {
+					_, _ = fmt.Fprintf(e.stderr, "yay query: %s: %v\n", in.name, err)
+					failed = true
+				}
+			}
+		}
+	}
+
+	switch {
+	case failed:
+		return exitError
+	case matched:
+		return exitOK
+	}
+	return exitNoMatch
+}
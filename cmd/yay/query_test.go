@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const deployment = `kind: Deployment
+spec:
+  containers:
+    - name: web
+      image: nginx:1.25
+    - name: sidecar
+      image: envoy:1.30
+---
+kind: Service
+spec:
+  ports: [80, 443]
+`
+
+const merged = `base: &base {a: 1, b: 1}
+item: {<<: *base, b: 2, c: 3}
+`
+
+func TestRunQuery(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "deployment.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(deployment), 0o600))
+
+	tests := map[string]struct {
+		args     []string
+		stdin    string
+		expected string
+		stderr   string
+		code     int
+	}{
+		"prints matches as yaml": {
+			args:     []string{"$.spec.containers[0]", file},
+			expected: "---\nname: web\nimage: nginx:1.25\n",
+		},
+		"prints matches as json": {
+			args:     []string{"-o", "json", "$..spec", file},
+			expected: "{\"containers\":[{\"name\":\"web\",\"image\":\"nginx:1.25\"},{\"name\":\"sidecar\",\"image\":\"envoy:1.30\"}]}\n{\"ports\":[80,443]}\n",
+		},
+		"prints matches as lines": {
+			args:     []string{"-output", "line", "$..image", file},
+			expected: file + ":5:14: nginx:1.25\n" + file + ":7:14: envoy:1.30\n",
+		},
+		"prints collections inline": {
+			args:     []string{"-o", "line", "spec.ports", file},
+			expected: file + ":11:10: [80, 443]\n",
+		},
+		"reads standard input": {
+			args:     []string{"-o", "line", "kind"},
+			stdin:    deployment,
+			expected: "-:1:7: Deployment\n-:9:7: Service\n",
+		},
+		"prints mappings containing merge keys": {
+			args:     []string{"-o", "json", "$.item"},
+			stdin:    merged,
+			expected: "{\"a\":1,\"b\":2,\"c\":3}\n",
+		},
+		"selects merged and overriding entries": {
+			args:     []string{"-o", "line", "item.*"},
+			stdin:    merged,
+			expected: "-:1:17: 1\n-:2:22: 2\n-:2:28: 3\n",
+		},
+		"exits with 1 when nothing matched": {
+			args: []string{"$.missing", file},
+			code: exitNoMatch,
+		},
+		"exits with 2 for invalid paths": {
+			args:   []string{"$.[", file},
+			stderr: "yay query: ",
+			code:   exitError,
+		},
+		"exits with 2 for missing files": {
+			args:   []string{"kind", filepath.Join(dir, "missing.yaml")},
+			stderr: "yay query: open ",
+			code:   exitError,
+		},
+		"exits with 2 for unknown formats": {
+			args:   []string{"-o", "xml", "kind", file},
+			stderr: "yay query: unknown output format \"xml\"\n",
+			code:   exitError,
+		},
+		"requires a path": {
+			args:   []string{},
+			stderr: "Usage: yay query",
+			code:   exitError,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(env{stdin: strings.NewReader(tt.stdin), stdout: &stdout, stderr: &stderr}, append([]string{"query"}, tt.args...))
+			assert.Equal(t, tt.code, code)
+			assert.Equal(t, tt.expected, stdout.String())
+			assert.True(t, strings.HasPrefix(stderr.String(), tt.stderr), stderr.String())
+		})
+	}
+}
+
+func TestRun_unknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run(env{stdout: &stdout, stderr: &stderr}, []string{"frobnicate"})
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr.String(), `unknown command "frobnicate"`)
+	assert.Contains(t, stderr.String(), "query")
+}
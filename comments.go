@@ -0,0 +1,263 @@
+package yay
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vmware-labs/yaml-jsonpath/pkg/yamlpath"
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	_ VisitsDocumentNode = (*commentNormalizationHandler)(nil)
+	_ VisitsMappingNode  = (*commentNormalizationHandler)(nil)
+)
+
+// CommentPosition identifies a comment relative to the node it describes
+type CommentPosition int
+
+const (
+	// HeadComment is written on the lines preceding a node
+	HeadComment CommentPosition = iota
+	// LineComment is written at the end of a node's line
+	LineComment
+	// FootComment is written on the lines following a node
+	FootComment
+)
+
+// String returns the name of the position
+func (p CommentPosition) String() string {
+	switch p {
+	case HeadComment:
+		return "head"
+	case LineComment:
+		return "line"
+	case FootComment:
+		return "foot"
+	}
+	return fmt.Sprintf("CommentPosition(%d)", int(p))
+}
+
+// commentTarget is a node selected by a path, along with the nodes which may hold its comments
+type commentTarget struct {
+	// document is the document node, if value is the document's root node
+	document *yaml.Node
+	// key is the mapping key, if value is a mapping value
+	key   *yaml.Node
+	value *yaml.Node
+}
+
+// owners returns the node which should hold the comment at position, followed by other nodes which may also hold it.
+// yaml.v3 decodes the head and foot comments of a mapping entry onto the key, as well as the line comment of an
+// entry whose value is a block collection, which is written on the key's line.
+func (t commentTarget) owners(position CommentPosition) []*yaml.Node {
+	switch {
+	case t.key != nil && (position != LineComment || isBlockCollection(t.value)):
+		return []*yaml.Node{t.key, t.value}
+	case t.key != nil:
+		return []*yaml.Node{t.value, t.key}
+	case t.document != nil && position != LineComment:
+		return []*yaml.Node{t.document, t.value}
+	}
+	return []*yaml.Node{t.value}
+}
+
+// get returns the raw comment at position, combining comments from all owners
+func (t commentTarget) get(position CommentPosition) string {
+	comments := make([]string, 0)
+	for _, owner := range t.owners(position) {
+		if c := *commentField(owner, position); c != "" {
+			comments = append(comments, c)
+		}
+	}
+	separator := "\n"
+	if position == LineComment {
+		separator = " "
+	}
+	return strings.Join(comments, separator)
+}
+
+// set replaces the raw comment at position, removing it from all but the primary owner
+func (t commentTarget) set(position CommentPosition, comment string) {
+	for i, owner := range t.owners(position) {
+		if i == 0 {
+			*commentField(owner, position) = comment
+		} else {
+			*commentField(owner, position) = ""
+		}
+	}
+}
+
+func commentField(node *yaml.Node, position CommentPosition) *string {
+	switch position {
+	case LineComment:
+		return &node.LineComment
+	case FootComment:
+		return &node.FootComment
+	}
+	return &node.HeadComment
+}
+
+// isBlockCollection determines whether node is written on the lines following its key
+func isBlockCollection(node *yaml.Node) bool {
+	return (node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode) && node.Style&yaml.FlowStyle == 0 && len(node.Content) > 0
+}
+
+// commentTargets selects the nodes matching path within doc
+func commentTargets(doc *yaml.Node, path string) ([]commentTarget, error) {
+	p, err := yamlpath.NewPath(path)
+	if err != nil {
+		return nil, err
+	}
+	found, err := p.Find(doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("path %q selected no nodes", path)
+	}
+
+	keys := make(map[*yaml.Node]*yaml.Node)
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				keys[n.Content[i+1]] = n.Content[i]
+			}
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	targets := make([]commentTarget, 0, len(found))
+	for _, node := range found {
+		target := commentTarget{key: keys[node], value: node}
+		if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 && doc.Content[0] == node {
+			target.document = doc
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// formatComment converts text to the form stored by yaml.Node, prefixing each line with # unless already present
+func formatComment(text string) string {
+	if text == "" {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case line == "":
+			lines[i] = "#"
+		default:
+			lines[i] = "# " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseComment converts a comment stored by yaml.Node to text, removing the # and a single space from each line
+func parseComment(comment string) string {
+	if comment == "" {
+		return ""
+	}
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		line = strings.TrimPrefix(line, "#")
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// GetComment returns the comment at position of the node selected by path, which must select exactly one node.
+// Comments of a mapping entry are read from both its key and value nodes. The returned text excludes the leading #
+// of each line.
+func GetComment(doc *yaml.Node, path string, position CommentPosition) (string, error) {
+	targets, err := commentTargets(doc, path)
+	if err != nil {
+		return "", err
+	}
+	if len(targets) != 1 {
+		return "", fmt.Errorf("path %q selected %d nodes, expected exactly one", path, len(targets))
+	}
+	return parseComment(targets[0].get(position)), nil
+}
+
+// SetComment replaces the comment at position of each node selected by path. The comment is placed where yaml.v3
+// places it when decoding, e.g. the head comment of a mapping entry is set on its key. Lines of text are prefixed
+// with # unless already present.
+func SetComment(doc *yaml.Node, path string, position CommentPosition, text string) error {
+	targets, err := commentTargets(doc, path)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		target.set(position, formatComment(text))
+	}
+	return nil
+}
+
+// AppendComment appends text to the comment at position of each node selected by path, on a new line for head and
+// foot comments
+func AppendComment(doc *yaml.Node, path string, position CommentPosition, text string) error {
+	targets, err := commentTargets(doc, path)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		existing := parseComment(target.get(position))
+		switch {
+		case existing == "":
+			target.set(position, formatComment(text))
+		case position == LineComment:
+			target.set(position, formatComment(existing+" "+text))
+		default:
+			target.set(position, formatComment(existing+"\n"+text))
+		}
+	}
+	return nil
+}
+
+// RemoveComment removes the comment at position of each node selected by path, from both the key and value nodes
+// of a mapping entry
+func RemoveComment(doc *yaml.Node, path string, position CommentPosition) error {
+	return SetComment(doc, path, position, "")
+}
+
+// commentNormalizationHandler moves comments of mapping entries to the nodes on which yaml.v3 places them.
+// See NewCommentNormalizationHandler for more information.
+type commentNormalizationHandler struct{}
+
+// VisitDocumentNode normalizes the entries of the document's root mapping, as the visitor doesn't visit a document's root node.
+func (c *commentNormalizationHandler) VisitDocumentNode(ctx context.Context, key *yaml.Node) error {
+	if len(key.Content) == 0 || key.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	return c.VisitMappingNode(ctx, nil, key.Content[0])
+}
+
+// VisitMappingNode normalizes the comments of each entry of the mapping
+func (c *commentNormalizationHandler) VisitMappingNode(_ context.Context, _ *yaml.Node, value *yaml.Node) error {
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		target := commentTarget{key: value.Content[i], value: value.Content[i+1]}
+		for _, position := range []CommentPosition{HeadComment, LineComment, FootComment} {
+			target.set(position, target.get(position))
+		}
+	}
+	return nil
+}
+
+// NewCommentNormalizationHandler creates a handler which moves the comments of each mapping entry to the node on
+// which yaml.v3 places them when decoding: head and foot comments on the key, and line comments on the value, or on
+// the key when the value is a block collection. Transformations which replace or restructure nodes (such as spliced
+// inclusions or rewritten values) may otherwise leave comments where the encoder omits or misplaces them.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func NewCommentNormalizationHandler() *commentNormalizationHandler {
+	return &commentNormalizationHandler{}
+}
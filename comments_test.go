@@ -0,0 +1,173 @@
+package yay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestGetComment(t *testing.T) {
+	input := trimmed(`# document
+		|
+		|# head a
+		|a: 1 # line a
+		|# foot a
+		|
+		|# head b
+		|b: # line b
+		|  c: [x] # line c
+		|  d:
+		|    - 1 # line item`)
+
+	tests := map[string]struct {
+		path     string
+		position CommentPosition
+		expected string
+		err      string
+	}{
+		"reads head comments from keys":                       {path: "$.a", position: HeadComment, expected: "head a"},
+		"reads line comments from scalar values":              {path: "$.a", position: LineComment, expected: "line a"},
+		"reads foot comments from keys":                       {path: "$.a", position: FootComment, expected: "foot a"},
+		"reads line comments of block collections from keys":  {path: "$.b", position: LineComment, expected: "line b"},
+		"reads line comments of flow collections from values": {path: "$.b.c", position: LineComment, expected: "line c"},
+		"reads comments of sequence items":                    {path: "$.b.d[0]", position: LineComment, expected: "line item"},
+		"reads comments of the document":                      {path: "$", position: HeadComment, expected: "document"},
+		"returns empty comments":                              {path: "$.b.c", position: HeadComment, expected: ""},
+		"requires a single node":                              {path: "$.b.*", err: `path "$.b.*" selected 2 nodes, expected exactly one`},
+		"requires a match":                                    {path: "$.missing", err: `path "$.missing" selected no nodes`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+			actual, err := GetComment(&doc, tt.path, tt.position)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestSetComment(t *testing.T) {
+	input := trimmed(`a: 1 # line a
+		|b:
+		|  c: x
+		|items:
+		|  - 1
+		|  - 2`)
+
+	tests := map[string]struct {
+		edit     func(doc *yaml.Node) error
+		expected string
+	}{
+		"sets comments of mapping entries": {
+			edit: func(doc *yaml.Node) error {
+				if err := SetComment(doc, "$.a", HeadComment, "head a\nsecond line"); err != nil {
+					return err
+				}
+				if err := SetComment(doc, "$.a", LineComment, "replaced"); err != nil {
+					return err
+				}
+				return SetComment(doc, "$.b", LineComment, "# line b")
+			},
+			expected: trimmed(`# head a
+				|# second line
+				|a: 1 # replaced
+				|b: # line b
+				|    c: x
+				|items:
+				|    - 1
+				|    - 2`),
+		},
+		"sets comments of all selected nodes": {
+			edit: func(doc *yaml.Node) error {
+				return SetComment(doc, "$.items[*]", LineComment, "item")
+			},
+			expected: trimmed(`a: 1 # line a
+				|b:
+				|    c: x
+				|items:
+				|    - 1 # item
+				|    - 2 # item`),
+		},
+		"appends comments": {
+			edit: func(doc *yaml.Node) error {
+				if err := AppendComment(doc, "$.a", LineComment, "appended"); err != nil {
+					return err
+				}
+				if err := AppendComment(doc, "$.b.c", HeadComment, "first"); err != nil {
+					return err
+				}
+				return AppendComment(doc, "$.b.c", HeadComment, "second")
+			},
+			expected: trimmed(`a: 1 # line a appended
+				|b:
+				|    # first
+				|    # second
+				|    c: x
+				|items:
+				|    - 1
+				|    - 2`),
+		},
+		"removes comments": {
+			edit: func(doc *yaml.Node) error {
+				return RemoveComment(doc, "$.a", LineComment)
+			},
+			expected: trimmed(`a: 1
+				|b:
+				|    c: x
+				|items:
+				|    - 1
+				|    - 2`),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+			assert.NoError(t, tt.edit(&doc))
+			out, err := yaml.Marshal(&doc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(out))
+		})
+	}
+}
+
+func TestNewCommentNormalizationHandler(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("a: 1\nb:\n  c: x"), &doc))
+
+	// simulate a transformation which left comments on the wrong nodes
+	root := doc.Content[0]
+	root.Content[1].HeadComment = "# head a"
+	root.Content[1].FootComment = "# foot a"
+	root.Content[0].LineComment = "# line a"
+	root.Content[3].LineComment = "# line b"
+	root.Content[3].Content[1].HeadComment = "# head c"
+
+	v, err := NewVisitor(NewCommentNormalizationHandler())
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), &doc))
+
+	assert.Equal(t, "# head a", root.Content[0].HeadComment)
+	assert.Equal(t, "# foot a", root.Content[0].FootComment)
+	assert.Equal(t, "# line a", root.Content[1].LineComment)
+	assert.Equal(t, "", root.Content[0].LineComment)
+	assert.Equal(t, "# line b", root.Content[2].LineComment)
+	assert.Equal(t, "# head c", root.Content[3].Content[0].HeadComment)
+
+	out, err := yaml.Marshal(&doc)
+	assert.NoError(t, err)
+	assert.Equal(t, trimmed(`# head a
+		|a: 1 # line a
+		|# foot a
+		|
+		|b: # line b
+		|    # head c
+		|    c: x`), string(out))
+}
@@ -0,0 +1,347 @@
+package yay
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// fnFilter evaluates a compiled filter expression against a single node
+type fnFilter func(node *yaml.Node) bool
+
+type filterValueType int
+
+const (
+	filterUnknown filterValueType = iota
+	filterString
+	filterInt
+	filterFloat
+	filterBool
+	filterNull
+	filterRegex
+)
+
+func (t filterValueType) isNumeric() bool {
+	return t == filterInt || t == filterFloat
+}
+
+func (t filterValueType) compatibleWith(other filterValueType) bool {
+	return t.isNumeric() && other.isNumeric() || t == other || t == filterString && other == filterRegex
+}
+
+// filterValue is a typed value of a filter operand, either a literal or a scalar resolved from the filtered node
+type filterValue struct {
+	typ   filterValueType
+	value string
+	regex *regexp.Regexp
+}
+
+// filterOperand resolves the values of one side of a filter comparison
+type filterOperand func(node *yaml.Node) []filterValue
+
+// compileFilter compiles the expression within a filter such as [?(@.name == 'a' && @.count > 1)] without
+// evaluating yamlpath for each node. Only simple filters are supported: comparisons and existence checks of @ or
+// dotted children of @, combined via && and ||. Other filters (nesting, negation, root references) aren't compiled.
+//
+// The semantics of comparisons mirror those of yamlpath, which must have already validated the expression.
+func compileFilter(expr string) (fnFilter, bool) {
+	tokens, ok := tokenizeFilter(expr)
+	if !ok {
+		return nil, false
+	}
+
+	disjuncts := make([]fnFilter, 0)
+	for _, disjunct := range splitTokens(tokens, "||") {
+		conjuncts := make([]fnFilter, 0)
+		for _, term := range splitTokens(disjunct, "&&") {
+			f, ok := compileFilterTerm(term)
+			if !ok {
+				return nil, false
+			}
+			conjuncts = append(conjuncts, f)
+		}
+		disjuncts = append(disjuncts, func(node *yaml.Node) bool {
+			for _, f := range conjuncts {
+				if !f(node) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+
+	return func(node *yaml.Node) bool {
+		for _, f := range disjuncts {
+			if f(node) {
+				return true
+			}
+		}
+		return false
+	}, true
+}
+
+func splitTokens(tokens []string, separator string) [][]string {
+	result := make([][]string, 0)
+	start := 0
+	for i, token := range tokens {
+		if token == separator {
+			result = append(result, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, tokens[start:])
+}
+
+func compileFilterTerm(term []string) (fnFilter, bool) {
+	switch len(term) {
+	case 1:
+		// existence of a child, e.g. [?(@.name)]
+		if !strings.HasPrefix(term[0], "@") {
+			return nil, false
+		}
+		operand, ok := compileFilterOperand(term[0])
+		if !ok {
+			return nil, false
+		}
+		return func(node *yaml.Node) bool {
+			return len(operand(node)) > 0
+		}, true
+	case 3:
+		lhs, ok := compileFilterOperand(term[0])
+		if !ok {
+			return nil, false
+		}
+		rhs, ok := compileFilterOperand(term[2])
+		if !ok {
+			return nil, false
+		}
+		accept, ok := filterComparison(term[1])
+		if !ok {
+			return nil, false
+		}
+		// perform a set-wise comparison of the values of each operand
+		return func(node *yaml.Node) bool {
+			match := false
+			for _, l := range lhs(node) {
+				for _, r := range rhs(node) {
+					if !accept(l, r) {
+						return false
+					}
+					match = true
+				}
+			}
+			return match
+		}, true
+	}
+	return nil, false
+}
+
+func filterComparison(operator string) (func(l, r filterValue) bool, bool) {
+	if operator == "=~" {
+		return func(l, r filterValue) bool {
+			return l.typ == filterString && r.typ == filterRegex && r.regex.MatchString(l.value)
+		}, true
+	}
+
+	var accept func(c int) bool
+	switch operator {
+	case "==":
+		accept = func(c int) bool { return c == compareEqual }
+	case "!=":
+		accept = func(c int) bool { return c != compareEqual }
+	case ">":
+		accept = func(c int) bool { return c == compareGreater }
+	case ">=":
+		accept = func(c int) bool { return c == compareGreater || c == compareEqual }
+	case "<":
+		accept = func(c int) bool { return c == compareLess }
+	case "<=":
+		accept = func(c int) bool { return c == compareLess || c == compareEqual }
+	default:
+		return nil, false
+	}
+
+	return func(l, r filterValue) bool {
+		if !l.typ.compatibleWith(r.typ) {
+			return accept(compareIncomparable)
+		}
+		switch l.typ {
+		case filterBool:
+			if strings.EqualFold(l.value, r.value) {
+				return accept(compareEqual)
+			}
+			return accept(compareIncomparable)
+		case filterNull:
+			return accept(compareEqual)
+		default:
+			return accept(compareFilterValues(l, r))
+		}
+	}, true
+}
+
+const (
+	compareLess = iota
+	compareEqual
+	compareGreater
+	compareIncomparable
+)
+
+func compareFilterValues(l, r filterValue) int {
+	if l.typ.isNumeric() && r.typ.isNumeric() {
+		lf, lerr := strconv.ParseFloat(l.value, 64)
+		rf, rerr := strconv.ParseFloat(r.value, 64)
+		switch {
+		case lerr != nil || rerr != nil:
+			return compareIncomparable
+		case lf < rf:
+			return compareLess
+		case lf > rf:
+			return compareGreater
+		}
+		return compareEqual
+	}
+	if l.typ != filterString && !l.typ.isNumeric() || r.typ != filterString && !r.typ.isNumeric() {
+		return compareIncomparable
+	}
+	if l.value == r.value {
+		return compareEqual
+	}
+	return compareIncomparable
+}
+
+func compileFilterOperand(token string) (filterOperand, bool) {
+	switch {
+	case token == "@" || strings.HasPrefix(token, "@."):
+		names := strings.Split(token, ".")[1:]
+		return func(node *yaml.Node) []filterValue {
+			for _, name := range names {
+				node = firstChild(node, name)
+				if node == nil {
+					return nil
+				}
+			}
+			return []filterValue{typedFilterValue(node)}
+		}, true
+	case strings.HasPrefix(token, "'") || strings.HasPrefix(token, `"`):
+		return literalOperand(filterValue{typ: filterString, value: token[1 : len(token)-1]}), true
+	case strings.HasPrefix(token, "/"):
+		re, err := regexp.Compile(strings.ReplaceAll(token[1:len(token)-1], `\/`, `/`))
+		if err != nil {
+			return nil, false
+		}
+		return literalOperand(filterValue{typ: filterRegex, regex: re}), true
+	case token == "true" || token == "false":
+		return literalOperand(filterValue{typ: filterBool, value: token}), true
+	case token == "null":
+		return literalOperand(filterValue{typ: filterNull, value: token}), true
+	case strings.ContainsAny(token[1:], ".eE-") || token[0] == '.':
+		if _, err := strconv.ParseFloat(token, 64); err != nil {
+			return nil, false
+		}
+		return literalOperand(filterValue{typ: filterFloat, value: token}), true
+	default:
+		if _, err := strconv.Atoi(token); err != nil {
+			return nil, false
+		}
+		return literalOperand(filterValue{typ: filterInt, value: token}), true
+	}
+}
+
+func literalOperand(value filterValue) filterOperand {
+	return func(*yaml.Node) []filterValue {
+		return []filterValue{value}
+	}
+}
+
+// firstChild returns the value of the first key named name within a mapping node, as yamlpath does for dotted children
+func firstChild(node *yaml.Node, name string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == name {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func typedFilterValue(node *yaml.Node) filterValue {
+	typ := filterUnknown
+	if node.Kind == yaml.ScalarNode {
+		switch node.ShortTag() {
+		case "!!null":
+			typ = filterNull
+		case "!!bool":
+			typ = filterBool
+		case "!!str":
+			typ = filterString
+		case "!!int":
+			typ = filterInt
+		case "!!float":
+			typ = filterFloat
+		}
+	}
+	return filterValue{typ: typ, value: node.Value}
+}
+
+// tokenizeFilter splits a filter expression into operands, operators, and literals
+func tokenizeFilter(expr string) ([]string, bool) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.HasPrefix(expr[i:], "&&") || strings.HasPrefix(expr[i:], "||") ||
+			strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "!=") ||
+			strings.HasPrefix(expr[i:], ">=") || strings.HasPrefix(expr[i:], "<=") ||
+			strings.HasPrefix(expr[i:], "=~"):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case c == '>' || c == '<':
+			tokens = append(tokens, expr[i:i+1])
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, false
+			}
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		case c == '/':
+			end := i + 1
+			for ; end < len(expr) && expr[end] != '/'; end++ {
+				if expr[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, false
+			}
+			tokens = append(tokens, expr[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(expr) && isFilterWordChar(expr[end]) {
+				end++
+			}
+			if end == i {
+				return nil, false
+			}
+			word := expr[i:end]
+			if strings.HasPrefix(word, "@") && (strings.Contains(word, "..") || strings.HasSuffix(word, ".") || len(word) > 1 && word[1] != '.') {
+				return nil, false
+			}
+			tokens = append(tokens, word)
+			i = end
+		}
+	}
+	return tokens, len(tokens) > 0
+}
+
+func isFilterWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.' || c == '@'
+}
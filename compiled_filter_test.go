@@ -0,0 +1,77 @@
+package yay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware-labs/yaml-jsonpath/pkg/yamlpath"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestCompileFilter(t *testing.T) {
+	tests := map[string]struct {
+		expr     string
+		compiled bool
+	}{
+		"string equality":         {`@.name == 'a'`, true},
+		"double quoted string":    {`@.name == "a"`, true},
+		"inequality":              {`@.name != 'a'`, true},
+		"identity":                {`@ == 'a'`, true},
+		"nested child":            {`@.meta.name == 'a'`, true},
+		"integer ordering":        {`@.count > 1`, true},
+		"float ordering":          {`@.count <= 1.5`, true},
+		"negative number":         {`@.count >= -2`, true},
+		"exponent":                {`@.count < 1e3`, true},
+		"regex":                   {`@.name =~ /^a.*$/`, true},
+		"escaped regex":           {`@.path =~ /^a\/b/`, true},
+		"boolean":                 {`@.enabled == true`, true},
+		"null":                    {`@.value == null`, true},
+		"existence":               {`@.name`, true},
+		"child comparison":        {`@.min < @.max`, true},
+		"conjunction":             {`@.name == 'a' && @.count > 1`, true},
+		"disjunction":             {`@.name == 'a' || @.count > 1`, true},
+		"mixed":                   {`@.name == 'a' && @.count > 1 || @.enabled == true`, true},
+		"operators within string": {`@.name == 'a && b'`, true},
+		"negation":                {`!(@.name == 'a')`, false},
+		"parentheses":             {`(@.name == 'a')`, false},
+		"bracket child":           {`@['name'] == 'a'`, false},
+		"wildcard child":          {`@.* == 'a'`, false},
+		"recursive child":         {`@..name == 'a'`, false},
+		"nested filter":           {`@.items[?(@.name == 'a')]`, false},
+	}
+
+	docs := []string{
+		"name: a\ncount: 2\nenabled: true\nvalue: null\nmin: 1\nmax: 2\npath: a/b\nmeta: {name: a}",
+		"name: b\ncount: 1\nenabled: false\nvalue: 1\nmin: 3\nmax: 2\npath: c\nmeta: {name: b}",
+		"name: 'a && b'\ncount: '2'\nenabled: 'true'\nmin: x\nmax: y",
+		"count: 1.5\nmeta: [a]",
+		"name: a\nname: b\ncount: 1e3",
+		"a",
+		"[a, b]",
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			filter, ok := compileFilter(tt.expr)
+			if !assert.Equal(t, tt.compiled, ok) || !ok {
+				return
+			}
+
+			path, err := yamlpath.NewPath("$[?(" + tt.expr + ")]")
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, doc := range docs {
+				var node yaml.Node
+				if !assert.NoError(t, yaml.Unmarshal([]byte(doc), &node)) {
+					return
+				}
+				value := node.Content[0]
+				wrapper := &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{value}}
+				found, err := path.Find(wrapper)
+				assert.NoError(t, err)
+				assert.Equal(t, len(found) == 1, filter(value), "document %q", doc)
+			}
+		})
+	}
+}
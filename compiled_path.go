@@ -0,0 +1,409 @@
+package yay
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/vmware-labs/yaml-jsonpath/pkg/yamlpath"
+	"go.yaml.in/yaml/v3"
+)
+
+type segmentKind int
+
+const (
+	// segmentChild selects mapping values by key name, e.g. .name or ['name','other']
+	segmentChild segmentKind = iota
+	// segmentWildcard selects all mapping values or sequence items, e.g. .* or [*]
+	segmentWildcard
+	// segmentIndex selects sequence items by index, slice, or union, e.g. [0], [1:3], or [0,2]
+	segmentIndex
+	// segmentFilter selects sequence items (or the node itself, for non-sequences) satisfying a filter, e.g. [?(@.name == 'a')]
+	segmentFilter
+	// segmentDescendants selects a node and all of its descendants, e.g. the .. of $..name
+	segmentDescendants
+)
+
+// segment is a single selector within a compiledPath
+type segment struct {
+	kind segmentKind
+	// names for segmentChild
+	names []string
+	// firstOnly is set for dotted children, which yamlpath resolves to the first matching key of a mapping
+	firstOnly bool
+	// subscript for segmentIndex
+	subscript string
+	// filter for segmentFilter, evaluated against a single node
+	filter *yamlpath.Path
+	// compiled is the filter evaluated without yamlpath, when the filter expression is simple enough to compile
+	compiled fnFilter
+}
+
+// compiledPath is a [yamlpath] expression which can be evaluated incrementally against the frames of a traversal,
+// rather than finding all matching nodes from the document root.
+//
+// Only a subset of the syntax is supported: child names, wildcards, recursive descent, array indexes and slices, and
+// filters which don't refer to the document root. Expressions requiring lookahead beyond a node's own subtree
+// (such as property names via ~, recursive filters, or filters referring to $) aren't compiled.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+type compiledPath struct {
+	segments []segment
+}
+
+var errUnsupportedPath = errors.New("path expression is not supported for incremental matching")
+
+// compilePath parses the yamlpath expression into a compiledPath, or returns errUnsupportedPath.
+func compilePath(path string) (*compiledPath, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errUnsupportedPath
+	}
+
+	segments := make([]segment, 0)
+	rest := path[1:]
+	// yamlpath treats a filter immediately following a recursive descent such as $..name[?(...)] as a recursive filter
+	afterDescent := false
+	for len(rest) > 0 {
+		var err error
+		if afterDescent && strings.HasPrefix(rest, "[?(") {
+			return nil, errUnsupportedPath
+		}
+		afterDescent = strings.HasPrefix(rest, "..")
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			segments = append(segments, segment{kind: segmentDescendants})
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[?(") || !strings.HasPrefix(rest, "[") {
+				// recursive filters require lookahead, and other recursive descents must name a child
+				if strings.HasPrefix(rest, "[") || rest == "" || strings.HasPrefix(rest, ".") {
+					return nil, errUnsupportedPath
+				}
+				var seg segment
+				seg, rest, err = parseDottedChild(rest)
+				if err != nil {
+					return nil, err
+				}
+				segments = append(segments, seg)
+			}
+		case strings.HasPrefix(rest, "."):
+			var seg segment
+			seg, rest, err = parseDottedChild(rest[1:])
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, seg)
+		case strings.HasPrefix(rest, "["):
+			var seg segment
+			seg, rest, err = parseBracket(rest)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, seg)
+		default:
+			return nil, errUnsupportedPath
+		}
+	}
+
+	return &compiledPath{segments: segments}, nil
+}
+
+func parseDottedChild(rest string) (segment, string, error) {
+	end := strings.IndexAny(rest, ".[")
+	if end < 0 {
+		end = len(rest)
+	}
+	name := rest[:end]
+	if name == "*" {
+		return segment{kind: segmentWildcard}, rest[end:], nil
+	}
+	if name == "" || strings.ContainsAny(name, " ()[]&|=!<>~\\'\"?@$,*") {
+		return segment{}, rest, errUnsupportedPath
+	}
+	return segment{kind: segmentChild, names: []string{name}, firstOnly: true}, rest[end:], nil
+}
+
+func parseBracket(rest string) (segment, string, error) {
+	if strings.HasPrefix(rest, "[?(") {
+		return parseFilter(rest)
+	}
+
+	end := strings.IndexByte(rest, ']')
+	if end < 0 {
+		return segment{}, rest, errUnsupportedPath
+	}
+	inner := rest[1:end]
+	remaining := rest[end+1:]
+	if strings.HasPrefix(remaining, "~") {
+		return segment{}, rest, errUnsupportedPath
+	}
+
+	if strings.HasPrefix(inner, "'") || strings.HasPrefix(inner, `"`) {
+		names, ok := parseQuotedNames(inner)
+		if !ok {
+			return segment{}, rest, errUnsupportedPath
+		}
+		return segment{kind: segmentChild, names: names}, remaining, nil
+	}
+
+	if strings.TrimSpace(inner) == "*" {
+		return segment{kind: segmentWildcard}, remaining, nil
+	}
+
+	if strings.Trim(inner, "0123456789-:, ") != "" {
+		return segment{}, rest, errUnsupportedPath
+	}
+	if _, err := subscriptIndices(inner, 0); err != nil {
+		return segment{}, rest, errUnsupportedPath
+	}
+	return segment{kind: segmentIndex, subscript: inner}, remaining, nil
+}
+
+// parseQuotedNames parses the comma-separated names of a bracket child such as 'a','b' or "a.b"
+func parseQuotedNames(inner string) ([]string, bool) {
+	names := make([]string, 0)
+	for len(inner) > 0 {
+		quote := inner[0]
+		if quote != '\'' && quote != '"' {
+			return nil, false
+		}
+		end := strings.IndexByte(inner[1:], quote)
+		if end < 0 {
+			return nil, false
+		}
+		name := inner[1 : end+1]
+		if strings.ContainsAny(name, `\'"`) {
+			return nil, false
+		}
+		names = append(names, name)
+		inner = inner[end+2:]
+		if inner == "" {
+			break
+		}
+		if !strings.HasPrefix(inner, ",") || len(inner) == 1 {
+			return nil, false
+		}
+		inner = inner[1:]
+	}
+	return names, len(names) > 0
+}
+
+func parseFilter(rest string) (segment, string, error) {
+	// the end of a filter is the first ")]" at which the filter can be parsed; earlier candidates will fail
+	// to parse as they end within string or regular expression literals, or within nested filters
+	for offset := 0; ; {
+		end := strings.Index(rest[offset:], ")]")
+		if end < 0 {
+			return segment{}, rest, errUnsupportedPath
+		}
+		end += offset + 2
+		expr := rest[:end]
+		if referencesRoot(expr) {
+			// filters referencing the root node require lookahead
+			return segment{}, rest, errUnsupportedPath
+		}
+		if filter, err := yamlpath.NewPath("$" + expr); err == nil {
+			if strings.HasPrefix(rest[end:], "~") {
+				return segment{}, rest, errUnsupportedPath
+			}
+			compiled, _ := compileFilter(expr[len("[?(") : len(expr)-len(")]")])
+			return segment{kind: segmentFilter, filter: filter, compiled: compiled}, rest[end:], nil
+		}
+		offset = end
+	}
+}
+
+// referencesRoot determines whether a filter expression refers to the root node outside of string and regular expression literals
+func referencesRoot(expr string) bool {
+	var delimiter rune
+	escaped := false
+	for _, r := range expr {
+		switch {
+		case escaped:
+			escaped = false
+		case delimiter != 0 && r == '\\':
+			escaped = true
+		case delimiter != 0:
+			if r == delimiter {
+				delimiter = 0
+			}
+		case r == '\'' || r == '"' || r == '/':
+			delimiter = r
+		case r == '$':
+			return true
+		}
+	}
+	return false
+}
+
+// accepts evaluates a filter segment against a single node
+func (s segment) accepts(node *yaml.Node) bool {
+	if s.compiled != nil {
+		return s.compiled(node)
+	}
+	wrapper := &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{node}}
+	found, err := s.filter.Find(wrapper)
+	return err == nil && len(found) == 1 && found[0] == node
+}
+
+// selects determines whether child, a direct descendant of parent, is selected by a child, wildcard, or index segment
+func (s segment) selects(parent *yaml.Node, child frame) bool {
+	switch s.kind {
+	case segmentWildcard:
+		return parent.Kind == yaml.MappingNode || parent.Kind == yaml.SequenceNode
+	case segmentChild:
+		if parent.Kind != yaml.MappingNode || child.key == nil {
+			return false
+		}
+		for _, name := range s.names {
+			if child.key.Value != name {
+				continue
+			}
+			if !s.firstOnly {
+				return true
+			}
+			for i := 0; i < len(parent.Content); i += 2 {
+				if parent.Content[i].Value == name {
+					return i/2 == child.index
+				}
+			}
+		}
+	case segmentIndex:
+		if parent.Kind != yaml.SequenceNode {
+			return false
+		}
+		indices, err := subscriptIndices(s.subscript, len(parent.Content))
+		if err != nil {
+			return false
+		}
+		for _, i := range indices {
+			if i == child.index {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Match determines whether the last of frames is selected by the path
+func (c *compiledPath) Match(frames []frame) bool {
+	return c.matchFrom(0, 0, frames)
+}
+
+func (c *compiledPath) matchFrom(s int, i int, frames []frame) bool {
+	last := len(frames) - 1
+	if s == len(c.segments) {
+		return i == last
+	}
+
+	seg := c.segments[s]
+	switch seg.kind {
+	case segmentDescendants:
+		for j := i; j <= last; j++ {
+			if c.matchFrom(s+1, j, frames) {
+				return true
+			}
+		}
+		return false
+	case segmentFilter:
+		if frames[i].node.Kind != yaml.SequenceNode {
+			return seg.accepts(frames[i].node) && c.matchFrom(s+1, i, frames)
+		}
+		return i < last && seg.accepts(frames[i+1].node) && c.matchFrom(s+1, i+1, frames)
+	default:
+		return i < last && seg.selects(frames[i].node, frames[i+1]) && c.matchFrom(s+1, i+1, frames)
+	}
+}
+
+// subscriptIndices resolves an array subscript such as 1, -1, 1:3, ::2, or 0,2 to indices of a sequence with
+// the given length, following the same semantics as yamlpath.
+func subscriptIndices(subscript string, length int) ([]int, error) {
+	if union := strings.Split(subscript, ","); len(union) > 1 {
+		combination := make([]int, 0)
+		for _, member := range union {
+			indices, err := subscriptIndices(member, length)
+			if err != nil {
+				return nil, err
+			}
+			combination = append(combination, indices...)
+		}
+		return combination, nil
+	}
+
+	parts := strings.Split(strings.TrimSpace(subscript), ":")
+	if len(parts) > 3 {
+		return nil, errors.New("malformed array index, too many colons")
+	}
+	values := make([]*int, 3)
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, errors.New("non-integer array index")
+		}
+		values[i] = &n
+	}
+
+	if len(parts) == 1 {
+		if values[0] == nil {
+			return nil, errors.New("array index missing")
+		}
+		from := *values[0]
+		if from < 0 {
+			from += length
+		}
+		return indicesBetween(from, from+1, 1, length), nil
+	}
+
+	step := 1
+	if values[2] != nil {
+		step = *values[2]
+		if step == 0 {
+			return nil, errors.New("array index step value must be non-zero")
+		}
+	}
+
+	var from, to int
+	if values[0] != nil {
+		from = *values[0]
+		if from < 0 {
+			from += length
+		}
+	} else if step < 0 {
+		from = length - 1
+	}
+	if values[1] != nil {
+		to = *values[1]
+		if to < 0 {
+			to += length
+		}
+	} else if step > 0 {
+		to = length
+	} else {
+		to = -1
+	}
+
+	return indicesBetween(from, to, step, length), nil
+}
+
+func indicesBetween(from, to, step, length int) []int {
+	indices := make([]int, 0)
+	if step > 0 {
+		from = max(from, 0)
+		to = min(to, length)
+		for i := from; i < to; i += step {
+			indices = append(indices, i)
+		}
+	} else {
+		from = min(from, length-1)
+		to = max(to, -1)
+		for i := from; i > to; i += step {
+			if i < length {
+				indices = append(indices, i)
+			}
+		}
+	}
+	return indices
+}
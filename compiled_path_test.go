@@ -0,0 +1,364 @@
+package yay
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware-labs/yaml-jsonpath/pkg/yamlpath"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestCompilePath(t *testing.T) {
+	tests := map[string]struct {
+		path      string
+		supported bool
+		kinds     []segmentKind
+	}{
+		"root":                     {"$", true, []segmentKind{}},
+		"dotted children":          {"$.a.b", true, []segmentKind{segmentChild, segmentChild}},
+		"wildcard":                 {"$.a.*", true, []segmentKind{segmentChild, segmentWildcard}},
+		"bracket wildcard":         {"$.a[*]", true, []segmentKind{segmentChild, segmentWildcard}},
+		"bracket children":         {`$['a.b']["c",'d']`, true, []segmentKind{segmentChild, segmentChild}},
+		"index":                    {"$.a[0]", true, []segmentKind{segmentChild, segmentIndex}},
+		"negative index":           {"$.a[-1]", true, []segmentKind{segmentChild, segmentIndex}},
+		"slice":                    {"$.a[1:3]", true, []segmentKind{segmentChild, segmentIndex}},
+		"union":                    {"$.a[0,2]", true, []segmentKind{segmentChild, segmentIndex}},
+		"recursive descent":        {"$..a", true, []segmentKind{segmentDescendants, segmentChild}},
+		"recursive wildcard":       {"$..*", true, []segmentKind{segmentDescendants, segmentWildcard}},
+		"recursive index":          {"$..[0]", true, []segmentKind{segmentDescendants, segmentIndex}},
+		"filter":                   {"$.a[?(@.b == 'x')].c", true, []segmentKind{segmentChild, segmentFilter, segmentChild}},
+		"filter with brackets":     {"$.a[?(@.b == ')]')]", true, []segmentKind{segmentChild, segmentFilter}},
+		"filter with regex":        {"$.a[?(@.b =~ /^S.*$/)]", true, []segmentKind{segmentChild, segmentFilter}},
+		"implicit root":            {"a.b", false, nil},
+		"property name":            {"$.a.b~", false, nil},
+		"bracket property name":    {"$.a['b']~", false, nil},
+		"recursive filter":         {"$..[?(@.b)]", false, nil},
+		"recursive named filter":   {"$..a[?(@.b)]", false, nil},
+		"filter referencing root":  {"$.a[?(@.b == $.c)]", false, nil},
+		"filter with literal root": {"$.a[?(@.b == '$.c')]", true, []segmentKind{segmentChild, segmentFilter}},
+		"escaped names":            {`$['a\'b']`, false, nil},
+		"wildcard union":           {"$.a[*,1]", false, nil},
+		"dangling recursion":       {"$..", false, nil},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := compilePath(tt.path)
+			if !tt.supported {
+				assert.ErrorIs(t, err, errUnsupportedPath)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			kinds := make([]segmentKind, 0)
+			for _, seg := range got.segments {
+				kinds = append(kinds, seg.kind)
+			}
+			assert.Equal(t, tt.kinds, kinds)
+		})
+	}
+}
+
+func TestSubscriptIndices(t *testing.T) {
+	tests := map[string][]int{
+		"0":     {0},
+		"-1":    {4},
+		"1:3":   {1, 2},
+		"::2":   {0, 2, 4},
+		"::-1":  {4, 3, 2, 1, 0},
+		"3:":    {3, 4},
+		":-3":   {0, 1},
+		"0,2":   {0, 2},
+		"1,-1":  {1, 4},
+		"10":    {},
+		"-10:2": {0, 1},
+	}
+	for subscript, want := range tests {
+		t.Run(subscript, func(t *testing.T) {
+			got, err := subscriptIndices(subscript, 5)
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+// matchCollector records every node visited for which the path matches
+type matchCollector struct {
+	path    string
+	matched map[*yaml.Node]struct{}
+}
+
+func (m *matchCollector) collect(ctx context.Context, value *yaml.Node) error {
+	pm, err := PathMatcherFor(ctx, m.path)
+	if err != nil {
+		return err
+	}
+	ok, err := pm.Match(value)
+	if ok {
+		m.matched[value] = struct{}{}
+	}
+	return err
+}
+
+func (m *matchCollector) VisitSequenceNode(ctx context.Context, _ *yaml.Node, value *yaml.Node) error {
+	return m.collect(ctx, value)
+}
+
+func (m *matchCollector) VisitMappingNode(ctx context.Context, _ *yaml.Node, value *yaml.Node) error {
+	return m.collect(ctx, value)
+}
+
+func (m *matchCollector) VisitScalarNode(ctx context.Context, _ *yaml.Node, value *yaml.Node) error {
+	return m.collect(ctx, value)
+}
+
+func TestPathMatcher_incremental_matches_find(t *testing.T) {
+	documents := map[string]string{
+		"store": trimmed(`---
+			|store:
+			|  book:
+			|  - author: Ernest Hemingway
+			|    title: The Old Man and the Sea
+			|    price: 8.99
+			|  - author: Jane Austen
+			|    title: Sense and Sensibility
+			|    price: 12
+			|    tags: [classic, romance]
+			|  - author: Kurt Vonnegut Jr.
+			|    title: Slaughterhouse-Five
+			|    price: 9.5
+			|    tags: [classic, satire]
+			|  bicycle:
+			|    color: red
+			|    price: 19.95
+			|  title: The Store`),
+		"kubernetes": trimmed(`---
+			|kind: Deployment
+			|spec:
+			|  template:
+			|    spec:
+			|      containers:
+			|      - name: app
+			|        image: app:1.0
+			|        env:
+			|        - name: A
+			|          value: "1"
+			|      - name: sidecar
+			|        image: proxy:2.0
+			|      initContainers:
+			|      - name: init
+			|        image: busybox`),
+		"nested sequences": trimmed(`---
+			|- [1, 2, 3]
+			|- [4, [5, 6]]
+			|- a: [7, 8]
+			|  b: {c: 9}`),
+		"duplicate and dotted keys": trimmed(`---
+			|a.b: dotted
+			|a:
+			|  b: nested
+			|c: {d: 1}`),
+	}
+
+	paths := []string{
+		"$",
+		"$.store",
+		"$.store.book",
+		"$.store.book[*]",
+		"$.store.book.*",
+		"$.store.book[0]",
+		"$.store.book[-1].title",
+		"$.store.book[1:].author",
+		"$.store.book[::2]",
+		"$.store.book[0,2].price",
+		"$.store.*.price",
+		"$..price",
+		"$..title",
+		"$..*",
+		"$..[0]",
+		"$..tags[1]",
+		"$.store.book[?(@.price > 9)]",
+		"$.store.book[?(@.price > 9)].title",
+		"$.store.book[?(@.tags)].tags[*]",
+		"$.store.book[?(@.author =~ /^J.*$/)]",
+		"$.store.bicycle[?(@.color == 'red')]",
+		"$.store.bicycle[?(@.color == 'red')].price",
+		"$.store['bicycle','book'][*]",
+		"$..book[*][?(@.title == 'Sense and Sensibility')].tags",
+		"$.spec.template.spec.containers[*].image",
+		"$.spec..containers[0][?(@.name == 'app')].env[*].value",
+		"$.spec..containers[*].env[?(@.name == 'A')].value",
+		"$..image",
+		"$.spec.template.spec.*[*].name",
+		"$[0][1]",
+		"$[1][1][0]",
+		"$[*][*]",
+		"$[2].a[-1]",
+		"$[?(@.b)].b.c",
+		"$['a.b']",
+		"$.a.b",
+		"$.c.d",
+		"$[1]..*",
+	}
+
+	for docName, input := range documents {
+		doc := &yaml.Node{}
+		assert.NoError(t, yaml.Unmarshal([]byte(input), doc))
+
+		for _, path := range paths {
+			t.Run(fmt.Sprintf("%s %s", docName, path), func(t *testing.T) {
+				_, err := compilePath(path)
+				assert.NoError(t, err, "expected path to be compiled for incremental matching")
+
+				yp, err := yamlpath.NewPath(path)
+				assert.NoError(t, err)
+				found, err := yp.Find(doc)
+				assert.NoError(t, err)
+
+				expected := make(map[*yaml.Node]struct{})
+				for _, n := range found {
+					// the document's root node and keys aren't visited
+					if n != doc.Content[0] && !isMappingKey(doc, n) {
+						expected[n] = struct{}{}
+					}
+				}
+
+				collector := &matchCollector{path: path, matched: make(map[*yaml.Node]struct{})}
+				v, err := NewVisitor(collector)
+				assert.NoError(t, err)
+				assert.NoError(t, v.Visit(context.TODO(), doc))
+
+				assert.Equal(t, describeNodes(expected), describeNodes(collector.matched))
+			})
+		}
+	}
+}
+
+func TestPathMatcher_incremental_falls_back(t *testing.T) {
+	input := trimmed(`---
+		|defaults: &defaults
+		|  image: base:1.0
+		|containers:
+		|- <<: *defaults
+		|  name: app
+		|- name: sidecar
+		|  image: proxy:2.0`)
+	doc := &yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte(input), doc))
+
+	collector := &matchCollector{path: "$.containers[*].image", matched: make(map[*yaml.Node]struct{})}
+	v, err := NewVisitor(collector)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), doc))
+
+	// merged values are matched at their anchored location, which is only possible by finding from the root
+	values := make([]string, 0)
+	for n := range collector.matched {
+		values = append(values, n.Value)
+	}
+	assert.ElementsMatch(t, []string{"base:1.0", "proxy:2.0"}, values)
+}
+
+func TestPathMatcher_incremental_matches_children(t *testing.T) {
+	input := trimmed(`---
+		|items:
+		|- name: a
+		|- name: b
+		|- name: c`)
+	doc := &yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte(input), doc))
+
+	matched := make([]string, 0)
+	handler, err := NewConditionalHandler(OnVisitSequenceNode("$.items", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+		pm, err := PathMatcherFor(ctx, "$.items[1:]")
+		if err != nil {
+			return err
+		}
+		for _, child := range value.Content {
+			if _, ok := pm.incrementalFrames(child); !ok {
+				t.Error("expected children of the current node to be matched incrementally")
+			}
+			if pm.MustMatch(child) {
+				matched = append(matched, child.Content[1].Value)
+			}
+		}
+		return nil
+	}))
+	assert.NoError(t, err)
+
+	v, err := NewVisitor(handler)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), doc))
+	assert.Equal(t, []string{"b", "c"}, matched)
+}
+
+func isMappingKey(parent *yaml.Node, node *yaml.Node) bool {
+	if parent.Kind == yaml.MappingNode {
+		for i := 0; i < len(parent.Content); i += 2 {
+			if parent.Content[i] == node {
+				return true
+			}
+		}
+	}
+	for _, child := range parent.Content {
+		if isMappingKey(child, node) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeNodes(nodes map[*yaml.Node]struct{}) []string {
+	result := make([]string, 0, len(nodes))
+	for n := range nodes {
+		result = append(result, fmt.Sprintf("%d:%d %s", n.Line, n.Column, strings.TrimSpace(n.Value)))
+	}
+	slices.Sort(result)
+	return result
+}
+
+func BenchmarkPathMatcher(b *testing.B) {
+	var sb strings.Builder
+	for d := 0; d < 10; d++ {
+		sb.WriteString("---\nitems:\n")
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(&sb, "- name: item-%d\n  spec:\n    replicas: %d\n    labels: {app: a%d, tier: web}\n", i, i%5, i)
+		}
+	}
+	documents := make([]*yaml.Node, 0)
+	decoder := yaml.NewDecoder(strings.NewReader(sb.String()))
+	for {
+		doc := &yaml.Node{}
+		if err := decoder.Decode(doc); err != nil {
+			break
+		}
+		documents = append(documents, doc)
+	}
+
+	noop := func(ctx context.Context, key *yaml.Node, value *yaml.Node) error { return nil }
+	handler, err := NewConditionalHandler(
+		OnVisitScalarNode("$.items[*].spec.replicas", noop),
+		OnVisitScalarNode("$..labels.app", noop),
+		OnVisitMappingNode("$.items[?(@.name == 'item-10')]", noop),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	v, err := NewVisitor(handler)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range documents {
+			if err := v.Visit(context.TODO(), doc); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
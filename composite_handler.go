@@ -13,7 +13,9 @@ var _ VisitsSequenceNode = (*compositeHandler)(nil)
 var _ VisitsMappingNode = (*compositeHandler)(nil)
 var _ VisitsScalarNode = (*compositeHandler)(nil)
 var _ VisitsAliasNode = (*compositeHandler)(nil)
+var _ VisitsMappingKey = (*compositeHandler)(nil)
 
+// compositeHandler invokes each of its handlers in order, skipping handlers suppressed by inline directives
 type compositeHandler struct {
 	handlers []any
 }
@@ -33,7 +35,7 @@ func (c *compositeHandler) VisitDocumentNode(ctx context.Context, key *yaml.Node
 func (c *compositeHandler) VisitSequenceNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
 	var err error
 	for _, handler := range c.handlers {
-		if h, ok := handler.(VisitsSequenceNode); ok {
+		if h, ok := handler.(VisitsSequenceNode); ok && !suppressed(ctx, handler, key, value) {
 			err = errors.Join(err, h.VisitSequenceNode(ctx, key, value))
 		}
 	}
@@ -44,7 +46,7 @@ func (c *compositeHandler) VisitSequenceNode(ctx context.Context, key *yaml.Node
 func (c *compositeHandler) VisitMappingNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
 	var err error
 	for _, handler := range c.handlers {
-		if h, ok := handler.(VisitsMappingNode); ok {
+		if h, ok := handler.(VisitsMappingNode); ok && !suppressed(ctx, handler, key, value) {
 			err = errors.Join(err, h.VisitMappingNode(ctx, key, value))
 		}
 	}
@@ -55,7 +57,7 @@ func (c *compositeHandler) VisitMappingNode(ctx context.Context, key *yaml.Node,
 func (c *compositeHandler) VisitScalarNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
 	var err error
 	for _, handler := range c.handlers {
-		if h, ok := handler.(VisitsScalarNode); ok {
+		if h, ok := handler.(VisitsScalarNode); ok && !suppressed(ctx, handler, key, value) {
 			err = errors.Join(err, h.VisitScalarNode(ctx, key, value))
 		}
 	}
@@ -66,9 +68,20 @@ func (c *compositeHandler) VisitScalarNode(ctx context.Context, key *yaml.Node,
 func (c *compositeHandler) VisitAliasNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
 	var err error
 	for _, handler := range c.handlers {
-		if h, ok := handler.(VisitsAliasNode); ok {
+		if h, ok := handler.(VisitsAliasNode); ok && !suppressed(ctx, handler, key, value) {
 			err = errors.Join(err, h.VisitAliasNode(ctx, key, value))
 		}
 	}
 	return err
 }
+
+// VisitMappingKey satisfies VisitsMappingKey such that a visitor always invokes this method, which defers to the handler passed by the user
+func (c *compositeHandler) VisitMappingKey(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	var err error
+	for _, handler := range c.handlers {
+		if h, ok := handler.(VisitsMappingKey); ok && !suppressed(ctx, handler, key, value) {
+			err = errors.Join(err, h.VisitMappingKey(ctx, key, value))
+		}
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/vmware-labs/yaml-jsonpath/pkg/yamlpath"
+	"go.yaml.in/yaml/v3"
+)
+
+// PathCondition is satisfied by the paths accepted by Match:
+// either a raw [yamlpath] selector string, or a Condition composed via Selector, All, Any, and Not.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+type PathCondition interface {
+	string | Condition
+}
+
+// fnMatchCondition evaluates a compiled Condition against a visited node, returning the PathMatcher which matched (if any)
+type fnMatchCondition func(ctx context.Context, node *yaml.Node) (*PathMatcher, bool, error)
+
+// Condition is a composable precondition for ConditionalHandler functions, passed to the OnVisit*If functions.
+// Conditions are evaluated once per visited node, so a node matching multiple selectors of a combined Condition
+// will invoke the handler function exactly once.
+type Condition struct {
+	expr    string
+	compile func() fnMatchCondition
+	// validate reports an invalid selector of the condition before it's evaluated, if non-nil
+	validate func() error
+}
+
+// String returns a human-readable representation of the condition
+func (c Condition) String() string {
+	return c.expr
+}
+
+// Selector creates a Condition which matches nodes selected by the [yamlpath] expression path.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func Selector(path string) Condition {
+	return Condition{
+		expr: path,
+		validate: func() error {
+			_, err := yamlpath.NewPath(path)
+			return err
+		},
+		compile: func() fnMatchCondition {
+			var pm *PathMatcher
+			return func(ctx context.Context, node *yaml.Node) (*PathMatcher, bool, error) {
+				if pm == nil {
+					var err error
+					pm, err = PathMatcherFor(ctx, path)
+					if err != nil {
+						return nil, false, err
+					}
+				} else if root, ok := rootNode(ctx); ok && pm.root != root {
+					pm.resetRoot(root)
+				}
+				pm.traversal, _ = traversalFrom(ctx)
+
+				ok, err := pm.Match(node)
+				if err != nil {
+					return nil, false, err
+				}
+				return pm, ok, nil
+			}
+		},
+	}
+}
+
+// All creates a Condition which matches nodes satisfying every one of the provided conditions.
+// An empty All matches every node.
+func All(conditions ...Condition) Condition {
+	return Condition{
+		expr: describe("all", conditions),
+		validate: func() error {
+			return validateAll(conditions)
+		},
+		compile: func() fnMatchCondition {
+			matchers := compileAll(conditions)
+			return func(ctx context.Context, node *yaml.Node) (*PathMatcher, bool, error) {
+				var first *PathMatcher
+				for _, match := range matchers {
+					pm, ok, err := match(ctx, node)
+					if err != nil || !ok {
+						return nil, false, err
+					}
+					if first == nil {
+						first = pm
+					}
+				}
+				return first, true, nil
+			}
+		},
+	}
+}
+
+// Any creates a Condition which matches nodes satisfying at least one of the provided conditions.
+// An empty Any matches no nodes.
+func Any(conditions ...Condition) Condition {
+	return Condition{
+		expr: describe("any", conditions),
+		validate: func() error {
+			return validateAll(conditions)
+		},
+		compile: func() fnMatchCondition {
+			matchers := compileAll(conditions)
+			return func(ctx context.Context, node *yaml.Node) (*PathMatcher, bool, error) {
+				for _, match := range matchers {
+					pm, ok, err := match(ctx, node)
+					if err != nil {
+						return nil, false, err
+					}
+					if ok {
+						return pm, true, nil
+					}
+				}
+				return nil, false, nil
+			}
+		},
+	}
+}
+
+// Not creates a Condition which matches nodes that do not satisfy condition.
+func Not(condition Condition) Condition {
+	return Condition{
+		expr:     describe("not", []Condition{condition}),
+		validate: condition.err,
+		compile: func() fnMatchCondition {
+			match := condition.compile()
+			return func(ctx context.Context, node *yaml.Node) (*PathMatcher, bool, error) {
+				_, ok, err := match(ctx, node)
+				if err != nil {
+					return nil, false, err
+				}
+				// a negated match has no meaningful matcher to pass along to the handler function
+				return nil, !ok, nil
+			}
+		},
+	}
+}
+
+// errZeroCondition is reported for a Condition which wasn't created by Selector, All, Any, Not, or Glob
+var errZeroCondition = errors.New("zero Condition, create conditions with Selector, All, Any, Not, or Glob")
+
+// err reports an invalid selector of the condition, or a zero Condition, without evaluating it
+func (c Condition) err() error {
+	if c.compile == nil {
+		return errZeroCondition
+	}
+	if c.validate == nil {
+		return nil
+	}
+	return c.validate()
+}
+
+func validateAll(conditions []Condition) error {
+	for _, condition := range conditions {
+		if err := condition.err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileAll(conditions []Condition) []fnMatchCondition {
+	matchers := make([]fnMatchCondition, 0, len(conditions))
+	for _, condition := range conditions {
+		matchers = append(matchers, condition.compile())
+	}
+	return matchers
+}
+
+func describe(op string, conditions []Condition) string {
+	parts := make([]string, 0, len(conditions))
+	for _, condition := range conditions {
+		parts = append(parts, condition.String())
+	}
+	return op + "(" + strings.Join(parts, ", ") + ")"
+}
+
+func conditionOf[P PathCondition](path P) Condition {
+	if c, ok := any(path).(Condition); ok {
+		return c
+	}
+	return Selector(any(path).(string))
+}
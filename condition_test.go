@@ -0,0 +1,228 @@
+package yay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestCondition_String(t *testing.T) {
+	tests := map[string]struct {
+		condition Condition
+		want      string
+	}{
+		"selector": {Selector("$.a"), "$.a"},
+		"all":      {All(Selector("$.a"), Selector("$.b")), "all($.a, $.b)"},
+		"any":      {Any(Selector("$.a"), Selector("$.b")), "any($.a, $.b)"},
+		"not":      {Not(Selector("$.a")), "not($.a)"},
+		"nested":   {All(Selector("$..a"), Not(Any(Selector("$.b.a"), Selector("$.c.a")))), "all($..a, not(any($.b.a, $.c.a)))"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.condition.String())
+		})
+	}
+}
+
+func TestConditionalHandler_combinators(t *testing.T) {
+	mustCreate := func(t *testing.T, opts ...conditionalHandlerOpt) *ConditionalHandler {
+		t.Helper()
+		h, err := NewConditionalHandler(opts...)
+		if err != nil {
+			t.Fatalf("unable to create ConditionalHandler: %s", err)
+		}
+		return h
+	}
+
+	commonDoc := trimmed(`---
+					|store:
+					|  book:
+					|  - author: Ernest Hemingway
+					|    title: The Old Man and the Sea
+					|  - author: Fyodor Mikhailovich Dostoevsky
+					|    title: Crime and Punishment
+					|  - author: Jane Austen
+					|    title: Sense and Sensibility
+					|  - author: Kurt Vonnegut Jr.
+					|    title: Slaughterhouse-Five
+					|  - author: J. R. R. Tolkien
+					|    title: The Lord of the Rings
+					|  magazine:
+					|  - title: Scientific American`)
+
+	collect := func(processed *[]string) FnVisitKeyValueNode {
+		return func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+			*processed = append(*processed, value.Value)
+			return nil
+		}
+	}
+
+	tests := map[string]func() (visitorScenario[ConditionalHandler], *[]string, []string){
+		"any invokes each matched node once": func() (visitorScenario[ConditionalHandler], *[]string, []string) {
+			processed := make([]string, 0)
+			return visitorScenario[ConditionalHandler]{
+				input: commonDoc,
+				handler: mustCreate(t, OnVisitScalarNodeIf(Any(
+					Selector("$.store.book[?(@.title=~/^S.*$/)].title"),
+					Selector("$.store.book[*].title"),
+					Selector("$..title"),
+				), collect(&processed))),
+			}, &processed, []string{
+				"The Old Man and the Sea",
+				"Crime and Punishment",
+				"Sense and Sensibility",
+				"Slaughterhouse-Five",
+				"The Lord of the Rings",
+				"Scientific American",
+			}
+		},
+		"all requires each condition": func() (visitorScenario[ConditionalHandler], *[]string, []string) {
+			processed := make([]string, 0)
+			return visitorScenario[ConditionalHandler]{
+				input: commonDoc,
+				handler: mustCreate(t, OnVisitScalarNodeIf(All(
+					Selector("$..title"),
+					Selector("$.store.book[?(@.title=~/^S.*$/)].title"),
+				), collect(&processed))),
+			}, &processed, []string{
+				"Sense and Sensibility",
+				"Slaughterhouse-Five",
+			}
+		},
+		"not excludes matched nodes": func() (visitorScenario[ConditionalHandler], *[]string, []string) {
+			processed := make([]string, 0)
+			return visitorScenario[ConditionalHandler]{
+				input: commonDoc,
+				handler: mustCreate(t, OnVisitScalarNodeIf(All(
+					Selector("$..title"),
+					Not(Selector("$.store.book[*].title")),
+				), collect(&processed))),
+			}, &processed, []string{
+				"Scientific American",
+			}
+		},
+		"not alone matches everything else": func() (visitorScenario[ConditionalHandler], *[]string, []string) {
+			processed := make([]string, 0)
+			return visitorScenario[ConditionalHandler]{
+				input:   "a: 1\nb: 2\nc: 3",
+				handler: mustCreate(t, OnVisitScalarNodeIf(Not(Selector("$.b")), collect(&processed))),
+			}, &processed, []string{"1", "3"}
+		},
+		"empty any matches nothing": func() (visitorScenario[ConditionalHandler], *[]string, []string) {
+			processed := make([]string, 0)
+			return visitorScenario[ConditionalHandler]{
+				input:   "a: 1\nb: 2",
+				handler: mustCreate(t, OnVisitScalarNodeIf(Any(), collect(&processed))),
+			}, &processed, []string{}
+		},
+		"combinators apply across documents": func() (visitorScenario[ConditionalHandler], *[]string, []string) {
+			processed := make([]string, 0)
+			return visitorScenario[ConditionalHandler]{
+				input: trimmed(`---
+							|kind: Deployment
+							|name: first
+							|---
+							|kind: Service
+							|name: second
+							|---
+							|kind: ConfigMap
+							|name: third`),
+				handler: mustCreate(t, OnVisitScalarNodeIf(Any(
+					Selector("$[?(@.kind == 'Deployment')].name"),
+					Selector("$[?(@.kind == 'ConfigMap')].name"),
+				), collect(&processed))),
+			}, &processed, []string{"first", "third"}
+		},
+	}
+
+	for name, setup := range tests {
+		t.Run(name, func(t *testing.T) {
+			scenario, processed, expected := setup()
+			scenario.validator = func(t *testing.T, h ConditionalHandler) error {
+				assert.Equal(t, expected, *processed)
+				return nil
+			}
+			validateScenario(t, context.TODO(), scenario)
+		})
+	}
+}
+
+func TestConditionalHandler_combinators_pass_path_matcher(t *testing.T) {
+	input := trimmed(`---
+		|spec:
+		|  containers:
+		|  - name: app
+		|    image: app:latest
+		|  - name: sidecar
+		|    image: proxy:1.0`)
+
+	matched := make([]string, 0)
+	handler, err := NewConditionalHandler(
+		OnVisitMappingNodeIf(Any(Selector("$.spec.containers[?(@.name == 'app')]"), Selector("$.spec.initContainers[*]")),
+			func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+				pm, err := PathMatcherFor(ctx, "$.spec.containers[?(@.name == 'app')]")
+				assert.NoError(t, err)
+				assert.True(t, pm.MustMatch(value))
+				matched = append(matched, value.Content[1].Value)
+				return nil
+			}),
+	)
+	assert.NoError(t, err)
+
+	doc := &yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte(input), doc))
+
+	v, err := NewVisitor(handler)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), doc))
+	assert.Equal(t, []string{"app"}, matched)
+}
+
+func TestConditionalHandler_invalidConditions(t *testing.T) {
+	fn := func(ctx context.Context, key *yaml.Node, value *yaml.Node) error { return nil }
+	tests := map[string]struct {
+		condition Condition
+		expected  string
+	}{
+		"zero":        {condition: Condition{}, expected: `invalid condition "": zero Condition`},
+		"nested zero": {condition: All(Selector("$.a"), Not(Condition{})), expected: `invalid condition "all($.a, not())": zero Condition`},
+		"invalid":     {condition: Any(Selector("$.[")), expected: `invalid condition "any($.[)": `},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewConditionalHandler(OnVisitScalarNodeIf(tt.condition, fn))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestConditionalHandler_stringSignatures(t *testing.T) {
+	type selector string
+	const names selector = "$.items[*].name"
+
+	// the OnVisit* functions accept selectors of named string types via conversion, and may be used as function values
+	onVisit := OnVisitScalarNode
+	visited := make([]string, 0)
+	handler, err := NewConditionalHandler(onVisit(string(names), func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+		visited = append(visited, value.Value)
+		return nil
+	}))
+	assert.NoError(t, err)
+
+	doc := &yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte("items:\n- name: a\n- name: b\n"), doc))
+	v, err := NewVisitor(handler)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), doc))
+	assert.Equal(t, []string{"a", "b"}, visited)
+
+	var _ func(string, FnVisitKeyValueNode) conditionalHandlerOpt = OnVisitSequenceNode
+	var _ func(string, FnVisitKeyValueNode) conditionalHandlerOpt = OnVisitMappingNode
+	var _ func(string, FnVisitKeyValueNode) conditionalHandlerOpt = OnVisitAliasNode
+	var _ func(string, FnVisitKeyValueNode) conditionalHandlerOpt = OnVisitMappingKey
+	var _ func(Condition, FnVisitKeyValueNode) conditionalHandlerOpt = OnVisitScalarNodeIf
+}
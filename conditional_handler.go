@@ -3,6 +3,7 @@ package yay
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"go.yaml.in/yaml/v3"
 )
@@ -11,68 +12,163 @@ type FnVisitValueNode func(ctx context.Context, value *yaml.Node) error
 type FnVisitKeyValueNode func(ctx context.Context, key *yaml.Node, value *yaml.Node) error
 type FnConditional func(path string, fn FnVisitKeyValueNode) FnVisitKeyValueNode
 
-func precondition(path string, fn FnVisitKeyValueNode) FnVisitKeyValueNode {
-	var pm *PathMatcher
+func precondition(condition Condition, fn FnVisitKeyValueNode) FnVisitKeyValueNode {
+	match := condition.compile()
 	return func(parent context.Context, key *yaml.Node, value *yaml.Node) error {
-		if pm == nil {
-			var err error
-			pm, err = PathMatcherFor(parent, path)
-			if err != nil {
-				return err
-			}
-		} else if root, ok := rootNode(parent); ok && pm.root != root {
-			pm.root = root
-			pm.matches = nil
-			if err := pm.ensureMatchLookup(); err != nil {
-				return err
-			}
+		pm, ok, err := match(parent, value)
+		if err != nil {
+			return err
 		}
 
-		if pm.MustMatch(value) {
+		if ok {
 			// We will only invoke this function if it's applicable to the current node.
 			// Passing the path matcher along on context allows the user to obtain the path matcher and match
 			// against any nested children if needed
-			return fn(WithPathMatcher(parent, pm), key, value)
+			ctx := parent
+			if pm != nil {
+				ctx = WithPathMatcher(parent, pm)
+			}
+			return fn(ctx, key, value)
 		}
 
 		return nil
 	}
 }
 
-type conditionalHandlerOpt func(handler *ConditionalHandler)
+// preconditionIf validates condition before creating its precondition, such that an invalid or zero Condition is
+// reported by NewConditionalHandler
+func preconditionIf(condition Condition, fn FnVisitKeyValueNode) (FnVisitKeyValueNode, error) {
+	if err := condition.err(); err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", condition, err)
+	}
+	return precondition(condition, fn), nil
+}
+
+type conditionalHandlerOpt func(handler *ConditionalHandler) error
 
 //goland:noinspection GoExportedFuncWithUnexportedType
 func OnVisitDocumentNode(fn FnVisitValueNode) conditionalHandlerOpt {
-	return func(handler *ConditionalHandler) {
+	return func(handler *ConditionalHandler) error {
 		handler.fnVisitDocumentNode = append(handler.fnVisitDocumentNode, fn)
+		return nil
 	}
 }
 
 //goland:noinspection GoExportedFuncWithUnexportedType
 func OnVisitSequenceNode(path string, fn FnVisitKeyValueNode) conditionalHandlerOpt {
-	return func(handler *ConditionalHandler) {
-		handler.fnVisitSequenceNode = append(handler.fnVisitSequenceNode, precondition(path, fn))
+	return func(handler *ConditionalHandler) error {
+		handler.fnVisitSequenceNode = append(handler.fnVisitSequenceNode, precondition(Selector(path), fn))
+		return nil
 	}
 }
 
 //goland:noinspection GoExportedFuncWithUnexportedType
 func OnVisitMappingNode(path string, fn FnVisitKeyValueNode) conditionalHandlerOpt {
-	return func(handler *ConditionalHandler) {
-		handler.fnVisitMappingNode = append(handler.fnVisitMappingNode, precondition(path, fn))
+	return func(handler *ConditionalHandler) error {
+		handler.fnVisitMappingNode = append(handler.fnVisitMappingNode, precondition(Selector(path), fn))
+		return nil
 	}
 }
 
 //goland:noinspection GoExportedFuncWithUnexportedType
 func OnVisitScalarNode(path string, fn FnVisitKeyValueNode) conditionalHandlerOpt {
-	return func(handler *ConditionalHandler) {
-		handler.fnVisitScalarNode = append(handler.fnVisitScalarNode, precondition(path, fn))
+	return func(handler *ConditionalHandler) error {
+		handler.fnVisitScalarNode = append(handler.fnVisitScalarNode, precondition(Selector(path), fn))
+		return nil
 	}
 }
 
 //goland:noinspection GoExportedFuncWithUnexportedType
 func OnVisitAliasNode(path string, fn FnVisitKeyValueNode) conditionalHandlerOpt {
-	return func(handler *ConditionalHandler) {
-		handler.fnVisitAliasNode = append(handler.fnVisitAliasNode, precondition(path, fn))
+	return func(handler *ConditionalHandler) error {
+		handler.fnVisitAliasNode = append(handler.fnVisitAliasNode, precondition(Selector(path), fn))
+		return nil
+	}
+}
+
+// OnVisitMappingKey invokes fn for each key of a mapping entry whose value matches path, including nodes nested within
+// complex keys. The key argument of fn is the key node, and value is the value of the mapping entry.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func OnVisitMappingKey(path string, fn FnVisitKeyValueNode) conditionalHandlerOpt {
+	return func(handler *ConditionalHandler) error {
+		handler.fnVisitMappingKey = append(handler.fnVisitMappingKey, precondition(Selector(path), fn))
+		return nil
+	}
+}
+
+// OnVisitSequenceNodeIf is OnVisitSequenceNode with a Condition composed via Selector, All, Any, Not, or Glob.
+// NewConditionalHandler returns an error if condition is invalid, or the zero Condition.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func OnVisitSequenceNodeIf(condition Condition, fn FnVisitKeyValueNode) conditionalHandlerOpt {
+	return func(handler *ConditionalHandler) error {
+		fn, err := preconditionIf(condition, fn)
+		if err != nil {
+			return err
+		}
+		handler.fnVisitSequenceNode = append(handler.fnVisitSequenceNode, fn)
+		return nil
+	}
+}
+
+// OnVisitMappingNodeIf is OnVisitMappingNode with a Condition composed via Selector, All, Any, Not, or Glob.
+// NewConditionalHandler returns an error if condition is invalid, or the zero Condition.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func OnVisitMappingNodeIf(condition Condition, fn FnVisitKeyValueNode) conditionalHandlerOpt {
+	return func(handler *ConditionalHandler) error {
+		fn, err := preconditionIf(condition, fn)
+		if err != nil {
+			return err
+		}
+		handler.fnVisitMappingNode = append(handler.fnVisitMappingNode, fn)
+		return nil
+	}
+}
+
+// OnVisitScalarNodeIf is OnVisitScalarNode with a Condition composed via Selector, All, Any, Not, or Glob.
+// NewConditionalHandler returns an error if condition is invalid, or the zero Condition.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func OnVisitScalarNodeIf(condition Condition, fn FnVisitKeyValueNode) conditionalHandlerOpt {
+	return func(handler *ConditionalHandler) error {
+		fn, err := preconditionIf(condition, fn)
+		if err != nil {
+			return err
+		}
+		handler.fnVisitScalarNode = append(handler.fnVisitScalarNode, fn)
+		return nil
+	}
+}
+
+// OnVisitAliasNodeIf is OnVisitAliasNode with a Condition composed via Selector, All, Any, Not, or Glob.
+// NewConditionalHandler returns an error if condition is invalid, or the zero Condition.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func OnVisitAliasNodeIf(condition Condition, fn FnVisitKeyValueNode) conditionalHandlerOpt {
+	return func(handler *ConditionalHandler) error {
+		fn, err := preconditionIf(condition, fn)
+		if err != nil {
+			return err
+		}
+		handler.fnVisitAliasNode = append(handler.fnVisitAliasNode, fn)
+		return nil
+	}
+}
+
+// OnVisitMappingKeyIf is OnVisitMappingKey with a Condition composed via Selector, All, Any, Not, or Glob.
+// NewConditionalHandler returns an error if condition is invalid, or the zero Condition.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func OnVisitMappingKeyIf(condition Condition, fn FnVisitKeyValueNode) conditionalHandlerOpt {
+	return func(handler *ConditionalHandler) error {
+		fn, err := preconditionIf(condition, fn)
+		if err != nil {
+			return err
+		}
+		handler.fnVisitMappingKey = append(handler.fnVisitMappingKey, fn)
+		return nil
 	}
 }
 
@@ -85,6 +181,7 @@ type ConditionalHandler struct {
 	fnVisitMappingNode  []FnVisitKeyValueNode
 	fnVisitScalarNode   []FnVisitKeyValueNode
 	fnVisitAliasNode    []FnVisitKeyValueNode
+	fnVisitMappingKey   []FnVisitKeyValueNode
 }
 
 // VisitDocumentNode satisfies VisitsDocumentNode such that a visitor always invokes this method, which defers to the handler passed by the user
@@ -147,6 +244,18 @@ func (c *ConditionalHandler) VisitAliasNode(ctx context.Context, key *yaml.Node,
 	return err
 }
 
+// VisitMappingKey satisfies VisitsMappingKey such that a visitor always invokes this method, which defers to the handler passed by the user
+func (c *ConditionalHandler) VisitMappingKey(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	var err error
+	for _, fn := range c.fnVisitMappingKey {
+		if err != nil {
+			break
+		}
+		err = fn(ctx, key, value)
+	}
+	return err
+}
+
 // NewConditionalHandler creates a new ConditionalHandler, allowing the user to provide 1..n handler functions with [yamlpath] preconditions.
 //
 // [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
@@ -160,10 +269,13 @@ func NewConditionalHandler(opts ...conditionalHandlerOpt) (*ConditionalHandler,
 		fnVisitMappingNode:  make([]FnVisitKeyValueNode, 0),
 		fnVisitScalarNode:   make([]FnVisitKeyValueNode, 0),
 		fnVisitAliasNode:    make([]FnVisitKeyValueNode, 0),
+		fnVisitMappingKey:   make([]FnVisitKeyValueNode, 0),
 	}
 
 	for _, opt := range opts {
-		opt(handler)
+		if err := opt(handler); err != nil {
+			return nil, err
+		}
 	}
 	return handler, nil
 }
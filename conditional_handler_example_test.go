@@ -75,3 +75,70 @@ store:
 	// processed item at index 0
 	// processed item at index 1
 }
+
+func ExampleNewConditionalHandler_combined_selectors() {
+	input := `---
+store:
+  book:
+  - author: Jane Austen
+    title: Sense and Sensibility
+  - author: Kurt Vonnegut Jr.
+    title: Slaughterhouse-Five
+  magazine:
+  - title: Scientific American`
+
+	document := &yaml.Node{}
+	_ = yaml.Unmarshal([]byte(input), document)
+
+	handler, _ := yay.NewConditionalHandler(
+		yay.OnVisitScalarNodeIf(
+			yay.All(yay.Selector("$..title"), yay.Not(yay.Selector("$.store.magazine[*].title"))),
+			func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+				fmt.Printf("processed item: key=%s, value=%q\n", key.Value, value.Value)
+				return nil
+			}))
+
+	visitor, _ := yay.NewVisitor(handler)
+	_ = visitor.Visit(context.TODO(), document)
+	// Output:
+	// processed item: key=title, value="Sense and Sensibility"
+	// processed item: key=title, value="Slaughterhouse-Five"
+}
+
+func ExampleNewConditionalHandler_glob_selectors() {
+	input := `---
+spec:
+  template:
+    metadata:
+      annotations:
+        example.com/owner: platform
+    spec:
+      containers:
+      - name: app
+        image: app:1.2.0
+      - name: proxy
+        image: envoy:1.29`
+
+	document := &yaml.Node{}
+	_ = yaml.Unmarshal([]byte(input), document)
+
+	handler, _ := yay.NewConditionalHandler(
+		yay.OnVisitScalarNodeIf(yay.Any(
+			yay.Glob("spec.template.spec.containers.*.image"),
+			yay.Glob(`**.annotations."example.com/owner"`),
+		), func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+			fmt.Printf("%s=%s\n", key.Value, value.Value)
+			return nil
+		}))
+
+	visitor, _ := yay.NewVisitor(handler)
+	_ = visitor.Visit(context.TODO(), document)
+
+	path, _ := yay.GlobToPath("spec.template.spec.containers[0].image")
+	fmt.Println(path)
+	// Output:
+	// example.com/owner=platform
+	// image=app:1.2.0
+	// image=envoy:1.29
+	// $.spec.template.spec.containers[0].image
+}
@@ -368,6 +368,30 @@ func TestNewConditionalHandler(t *testing.T) {
 				return nil
 			},
 		},
+		"handles mapping keys": {
+			input: trimmed(`document:
+							| First_Name: a
+							| nested:
+							|   Last_Name: b
+							| ? [Complex_Key]
+							| : c`),
+			handler: mustCreate(t, OnVisitMappingKey("$.document.*", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+				// keys are matched by the value of their mapping entry, so the key within nested isn't visited
+				key.Value = strings.ToLower(key.Value)
+				return nil
+			})),
+			validatorWithNode: func(t *testing.T, h ConditionalHandler, node *yaml.Node) error {
+				out, err := yaml.Marshal(node)
+				assert.NoError(t, err)
+				assert.Equal(t, trimmed(`document:
+							|    first_name: a
+							|    nested:
+							|        Last_Name: b
+							|    ? [complex_key]
+							|    : c`), string(out))
+				return nil
+			},
+		},
 	}
 
 	for name, tt := range tests {
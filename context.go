@@ -27,12 +27,12 @@ func PathMatcherFor(ctx context.Context, path string) (*PathMatcher, error) {
 
 	if matcher.root == nil {
 		if node, ok := rootNode(ctx); ok {
-			matcher.root = node
-			matcher.matches = nil
-			// forces re-evaluation of path with new root for alias/anchor lookups
-			matcher.path, _ = yamlpath.NewPathWithRoot(matcher.rawPath, node)
+			matcher.resetRoot(node)
 		}
 	}
+	if t, ok := traversalFrom(ctx); ok {
+		matcher.traversal = t
+	}
 
 	return matcher, err
 }
@@ -41,10 +41,7 @@ func PathMatcherFor(ctx context.Context, path string) (*PathMatcher, error) {
 func WithPathMatcher(ctx context.Context, matcher *PathMatcher) context.Context {
 	if matcher != nil && matcher.root == nil {
 		if node, ok := rootNode(ctx); ok {
-			matcher.root = node
-			matcher.matches = nil
-			// forces re-evaluation of path with new root for alias/anchor lookups
-			matcher.path, _ = yamlpath.NewPathWithRoot(matcher.rawPath, node)
+			matcher.resetRoot(node)
 		}
 	}
 	return context.WithValue(ctx, pathMatchKey{}, matcher)
@@ -64,3 +61,39 @@ func rootNode(ctx context.Context) (*yaml.Node, bool) {
 	n, ok := ctx.Value(rootNodeKey{}).(*yaml.Node)
 	return n, ok
 }
+
+// VisitInfo describes the position of the node being visited within its parent
+type VisitInfo struct {
+	// Index is the item index of a sequence item, the entry index of a mapping entry, or -1 for the root node
+	Index int
+	// Key is the mapping key of the entry being visited, or nil for sequence items and the root node
+	Key *yaml.Node
+	// Parent is the collection containing the node, or nil for the root node
+	Parent *yaml.Node
+	// Depth is the number of ancestors of the node below the root node, which has a depth of 0
+	Depth int
+}
+
+// VisitInfoFrom retrieves the position of the node being visited from a context passed to a handler by a Visitor.
+// Handlers receive a nil key for sequence items, so this allows determining which item is being visited:
+//
+//	func (h *handler) VisitScalarNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+//		if info, ok := yay.VisitInfoFrom(ctx); ok && key == nil {
+//			fmt.Printf("item %d: %s\n", info.Index, value.Value)
+//		}
+//		return nil
+//	}
+//
+// For VisitMappingKey, the position is that of the mapping entry, including for nodes nested within complex keys.
+func VisitInfoFrom(ctx context.Context) (VisitInfo, bool) {
+	t, ok := anyTraversalFrom(ctx)
+	if !ok {
+		return VisitInfo{}, false
+	}
+	current := t.top()
+	info := VisitInfo{Index: current.index, Key: current.key, Depth: len(t.frames) - 1}
+	if len(t.frames) > 1 {
+		info.Parent = t.frames[len(t.frames)-2].node
+	}
+	return info, true
+}
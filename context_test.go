@@ -2,8 +2,10 @@ package yay
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"go.yaml.in/yaml/v3"
 )
 
@@ -73,3 +75,105 @@ func TestRootNode(t *testing.T) {
 		t.Error("expected root node to be found in context")
 	}
 }
+
+func TestVisitInfoFrom(t *testing.T) {
+	describe := func(ctx context.Context, value *yaml.Node) string {
+		info, ok := VisitInfoFrom(ctx)
+		if !ok {
+			return value.Value + " missing"
+		}
+		key := "<nil>"
+		if info.Key != nil {
+			key = info.Key.Value
+		}
+		parent := "<nil>"
+		if info.Parent != nil {
+			parent = info.Parent.Tag
+		}
+		return fmt.Sprintf("%s index=%d key=%s parent=%s depth=%d", value.Value, info.Index, key, parent, info.Depth)
+	}
+
+	tests := map[string]struct {
+		node    func(t *testing.T) *yaml.Node
+		options FnOptions
+		want    []string
+	}{
+		"documents": {
+			node: func(t *testing.T) *yaml.Node {
+				var doc yaml.Node
+				assert.NoError(t, yaml.Unmarshal([]byte("name: demo\nports: [80, 443]\nnested: [[x]]"), &doc))
+				return &doc
+			},
+			want: []string{
+				"demo index=0 key=name parent=!!map depth=1",
+				"80 index=0 key=<nil> parent=!!seq depth=2",
+				"443 index=1 key=<nil> parent=!!seq depth=2",
+				"x index=0 key=<nil> parent=!!seq depth=3",
+			},
+		},
+		"nodes without a document": {
+			node: func(t *testing.T) *yaml.Node {
+				var doc yaml.Node
+				assert.NoError(t, yaml.Unmarshal([]byte("[a, b, c]"), &doc))
+				return doc.Content[0]
+			},
+			options: NewOptions().WithSkipDocumentCheck(true),
+			want: []string{
+				"a index=0 key=<nil> parent=!!seq depth=1",
+				"b index=1 key=<nil> parent=!!seq depth=1",
+				"c index=2 key=<nil> parent=!!seq depth=1",
+			},
+		},
+		"key and value pairs": {
+			node: func(t *testing.T) *yaml.Node {
+				var doc yaml.Node
+				assert.NoError(t, yaml.Unmarshal([]byte("items: [a, b]"), &doc))
+				return &yaml.Node{Content: doc.Content[0].Content}
+			},
+			options: NewOptions().WithSkipDocumentCheck(true),
+			want: []string{
+				"a index=0 key=<nil> parent=!!seq depth=1",
+				"b index=1 key=<nil> parent=!!seq depth=1",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := make([]string, 0)
+			handler, err := NewConditionalHandler(
+				OnVisitScalarNode("$..*", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+					got = append(got, describe(ctx, value))
+					return nil
+				}),
+			)
+			assert.NoError(t, err)
+			v, err := NewVisitorWithOptions(tt.options, handler)
+			assert.NoError(t, err)
+			assert.NoError(t, v.Visit(context.Background(), tt.node(t)))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, ok := VisitInfoFrom(context.Background())
+	assert.False(t, ok)
+}
+
+func TestVisitInfoFrom_mappingKeys(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("a: 1\n? [x, y]\n: 2"), &doc))
+
+	got := make([]string, 0)
+	handler, err := NewConditionalHandler(
+		OnVisitMappingKey("$..*", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+			info, ok := VisitInfoFrom(ctx)
+			assert.True(t, ok)
+			got = append(got, fmt.Sprintf("%s=%d", key.Value, info.Index))
+			return nil
+		}),
+	)
+	assert.NoError(t, err)
+	v, err := NewVisitor(handler)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.Background(), &doc))
+	assert.Equal(t, []string{"a=0", "=1", "x=1", "y=1"}, got)
+}
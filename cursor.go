@@ -0,0 +1,218 @@
+package yay
+
+import (
+	"slices"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ApplyFunc is invoked by Apply for each node, with a Cursor describing the node.
+// See Apply for the meaning of its result.
+type ApplyFunc func(c *Cursor) bool
+
+// iterator is the position of Apply within a collection, adjusted by edits made via a Cursor
+type iterator struct {
+	// index is the item index of a sequence, or the entry index of a mapping
+	index int
+	// step is the number of items or entries to advance once the current one has been applied
+	step int
+}
+
+// Cursor describes a node encountered during Apply, and allows replacing or deleting it, or inserting siblings,
+// without disrupting the traversal. A Cursor is only valid during the ApplyFunc invocation it was passed to.
+type Cursor struct {
+	t      *traversal
+	parent *yaml.Node
+	// iter is nil for the document's root node, which has no siblings
+	iter    *iterator
+	node    *yaml.Node
+	key     *yaml.Node
+	deleted bool
+}
+
+// Node returns the current node, or nil if it was deleted
+func (c *Cursor) Node() *yaml.Node {
+	return c.node
+}
+
+// Key returns the mapping key of the current node, or nil for sequence items and the document's root node
+func (c *Cursor) Key() *yaml.Node {
+	return c.key
+}
+
+// Parent returns the collection containing the current node, or nil for the document's root node
+func (c *Cursor) Parent() *yaml.Node {
+	if c.iter == nil {
+		return nil
+	}
+	return c.parent
+}
+
+// Index returns the position of the current node within its parent: the item index for sequences, the entry index
+// for mappings, or -1 for the document's root node
+func (c *Cursor) Index() int {
+	if c.iter == nil {
+		return -1
+	}
+	return c.iter.index
+}
+
+// Path returns the path of the current node
+func (c *Cursor) Path() Path {
+	return Path{frames: slices.Clone(c.t.frames)}
+}
+
+// Replace replaces the current node with node, retaining its mapping key. When invoked by the pre function of Apply,
+// the descendants of node are walked and node is passed to the post function.
+func (c *Cursor) Replace(node *yaml.Node) {
+	c.mustExist("Replace")
+	switch {
+	case c.iter == nil:
+		c.parent.Content[0] = node
+	case c.parent.Kind == yaml.MappingNode:
+		c.parent.Content[2*c.iter.index+1] = node
+	default:
+		c.parent.Content[c.iter.index] = node
+	}
+	c.node = node
+	c.t.frames[len(c.t.frames)-1].node = node
+}
+
+// Delete removes the current node from its parent, along with its mapping key. When invoked by the pre function of
+// Apply, the descendants of the node aren't walked, and the post function isn't invoked.
+func (c *Cursor) Delete() {
+	c.mustExist("Delete")
+	c.mustHaveParent("Delete")
+	start, width := c.span(c.iter.index)
+	c.parent.Content = slices.Delete(c.parent.Content, start, start+width)
+	c.iter.step--
+	c.node = nil
+	c.deleted = true
+}
+
+// InsertBefore inserts nodes before the current node: sequence items, or alternating keys and values of mapping
+// entries. The inserted nodes aren't walked by Apply.
+func (c *Cursor) InsertBefore(nodes ...*yaml.Node) {
+	c.mustExist("InsertBefore")
+	c.mustHaveParent("InsertBefore")
+	count := c.insertionCount(nodes)
+	start, _ := c.span(c.iter.index)
+	c.parent.Content = slices.Insert(c.parent.Content, start, nodes...)
+	c.iter.index += count
+	c.t.frames[len(c.t.frames)-1].index = c.iter.index
+}
+
+// InsertAfter inserts nodes after the current node: sequence items, or alternating keys and values of mapping
+// entries. The inserted nodes aren't walked by Apply.
+func (c *Cursor) InsertAfter(nodes ...*yaml.Node) {
+	c.mustExist("InsertAfter")
+	c.mustHaveParent("InsertAfter")
+	count := c.insertionCount(nodes)
+	start, width := c.span(c.iter.index)
+	c.parent.Content = slices.Insert(c.parent.Content, start+width, nodes...)
+	c.iter.step += count
+}
+
+// span returns the offset within the parent's content of the item or entry at index, and the number of nodes it spans
+func (c *Cursor) span(index int) (int, int) {
+	if c.parent.Kind == yaml.MappingNode {
+		return 2 * index, 2
+	}
+	return index, 1
+}
+
+// insertionCount returns the number of items or entries within nodes
+func (c *Cursor) insertionCount(nodes []*yaml.Node) int {
+	if c.parent.Kind != yaml.MappingNode {
+		return len(nodes)
+	}
+	if len(nodes)%2 != 0 {
+		panic("yay: mapping entries must be inserted as pairs of keys and values")
+	}
+	return len(nodes) / 2
+}
+
+func (c *Cursor) mustExist(op string) {
+	if c.deleted {
+		panic("yay: Cursor." + op + " invoked after Delete")
+	}
+}
+
+func (c *Cursor) mustHaveParent(op string) {
+	if c.iter == nil {
+		panic("yay: Cursor." + op + " invoked on the document's root node")
+	}
+}
+
+type applier struct {
+	pre  ApplyFunc
+	post ApplyFunc
+	t    *traversal
+}
+
+// Apply walks the document's root node and its descendants in the order they're visited by a Visitor, invoking pre
+// before a node's descendants are walked and post afterward. Either function may be nil. The Cursor passed to each
+// function allows replacing or deleting the node, or inserting siblings before or after it, while traversal continues
+// with the following original sibling: unlike a Visitor, siblings aren't skipped or visited twice when a collection
+// is modified during the walk.
+//
+// If pre returns false, the node's descendants aren't walked and post isn't invoked for it. If post returns false,
+// Apply stops. Aliases aren't followed.
+//
+// doc may be a document node, or any other node treated as a root. Apply returns doc, or the replacement of doc if a
+// root node other than a document node was replaced.
+func Apply(doc *yaml.Node, pre ApplyFunc, post ApplyFunc) *yaml.Node {
+	t, ok := iterationTraversal(doc)
+	if !ok {
+		return doc
+	}
+	a := &applier{pre: pre, post: post, t: t}
+	a.apply(&Cursor{t: t, parent: t.root, node: t.root.Content[0]})
+	if doc.Kind == yaml.DocumentNode {
+		return doc
+	}
+	return t.root.Content[0]
+}
+
+// apply walks the node of c, returning false if Apply should stop
+func (a *applier) apply(c *Cursor) bool {
+	if a.pre != nil && !a.pre(c) {
+		return true
+	}
+	if c.deleted {
+		return true
+	}
+
+	node := c.node
+	switch node.Kind {
+	case yaml.SequenceNode:
+		it := &iterator{}
+		for it.index = 0; it.index < len(node.Content); it.index += it.step {
+			it.step = 1
+			child := node.Content[it.index]
+			a.t.push(frame{node: child, index: it.index})
+			ok := a.apply(&Cursor{t: a.t, parent: node, iter: it, node: child})
+			a.t.pop()
+			if !ok {
+				return false
+			}
+		}
+	case yaml.MappingNode:
+		it := &iterator{}
+		for it.index = 0; 2*it.index+1 < len(node.Content); it.index += it.step {
+			it.step = 1
+			key, child := node.Content[2*it.index], node.Content[2*it.index+1]
+			a.t.push(frame{node: child, key: key, index: it.index})
+			ok := a.apply(&Cursor{t: a.t, parent: node, iter: it, node: child, key: key})
+			a.t.pop()
+			if !ok {
+				return false
+			}
+		}
+	}
+
+	if a.post != nil && !a.post(c) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package yay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func TestApply(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		pre      func(c *Cursor) bool
+		post     func(c *Cursor) bool
+		expected string
+		visited  []string
+	}{
+		"deletes consecutive sequence items": {
+			input: "items: [a, drop, drop, b]",
+			pre: func(c *Cursor) bool {
+				if c.Node().Value == "drop" {
+					c.Delete()
+				}
+				return true
+			},
+			expected: "items: [a, b]\n",
+			visited:  []string{"$", "$.items", "$.items[0]", "$.items[1]", "$.items[1]", "$.items[1]"},
+		},
+		"deletes consecutive mapping entries": {
+			input: trimmed(`
+			|a: 1
+			|b: drop
+			|c: drop
+			|d: 4`),
+			pre: func(c *Cursor) bool {
+				if c.Node().Value == "drop" {
+					c.Delete()
+				}
+				return true
+			},
+			expected: "a: 1\nd: 4\n",
+			visited:  []string{"$", "$.a", "$.b", "$.c", "$.d"},
+		},
+		"inserts sequence items without walking them": {
+			input: "items: [a, b]",
+			pre: func(c *Cursor) bool {
+				if c.Node().Value == "a" {
+					c.InsertBefore(scalar("before"))
+					c.InsertAfter(scalar("after"), scalar("a"))
+				}
+				return true
+			},
+			expected: "items: [before, a, after, a, b]\n",
+			visited:  []string{"$", "$.items", "$.items[0]", "$.items[4]"},
+		},
+		"inserts mapping entries without walking them": {
+			input: trimmed(`
+			|a: 1
+			|b: 2`),
+			pre: func(c *Cursor) bool {
+				if c.Key() != nil && c.Key().Value == "a" {
+					c.InsertBefore(scalar("first"), scalar("zero"))
+					c.InsertAfter(scalar("second"), scalar("half"))
+				}
+				return true
+			},
+			expected: "first: zero\na: 1\nsecond: half\nb: 2\n",
+			visited:  []string{"$", "$.a", "$.b"},
+		},
+		"walks replacements made before descending": {
+			input: "spec: old",
+			pre: func(c *Cursor) bool {
+				if c.Node().Value == "old" {
+					c.Replace(&yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{scalar("x")}})
+				}
+				return true
+			},
+			expected: "spec:\n  - x\n",
+			visited:  []string{"$", "$.spec", "$.spec[0]"},
+		},
+		"replaces in post": {
+			input: "a: {b: 1}",
+			post: func(c *Cursor) bool {
+				if c.Node().Kind == yaml.MappingNode && c.Key() != nil {
+					c.Replace(scalar("flattened"))
+				}
+				return true
+			},
+			expected: "a: flattened\n",
+		},
+		"skips descendants when pre returns false": {
+			input: "a: {b: 1}\nc: 2",
+			pre: func(c *Cursor) bool {
+				return c.Key() == nil || c.Key().Value != "a"
+			},
+			expected: "a: {b: 1}\nc: 2\n",
+			visited:  []string{"$", "$.a", "$.c"},
+		},
+		"stops when post returns false": {
+			input: "a: 1\nb: 2\nc: 3",
+			post: func(c *Cursor) bool {
+				return c.Node().Value != "2"
+			},
+			expected: "a: 1\nb: 2\nc: 3\n",
+			visited:  []string{"$", "$.a", "$.b"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), &doc))
+
+			visited := make([]string, 0)
+			pre := func(c *Cursor) bool {
+				visited = append(visited, c.Path().String())
+				if tt.pre != nil {
+					return tt.pre(c)
+				}
+				return true
+			}
+			result := Apply(&doc, pre, tt.post)
+			assert.Same(t, &doc, result)
+
+			var sb strings.Builder
+			enc := yaml.NewEncoder(&sb)
+			enc.SetIndent(2)
+			assert.NoError(t, enc.Encode(&doc))
+			assert.Equal(t, tt.expected, sb.String())
+			if tt.visited != nil {
+				assert.Equal(t, tt.visited, visited)
+			}
+		})
+	}
+}
+
+func TestApply_cursor(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("a: [x, y]\nb: 2"), &doc))
+
+	Apply(&doc, func(c *Cursor) bool {
+		switch c.Path().String() {
+		case "$":
+			assert.Nil(t, c.Parent())
+			assert.Nil(t, c.Key())
+			assert.Equal(t, -1, c.Index())
+			assert.Panics(t, c.Delete)
+			assert.Panics(t, func() { c.InsertAfter(scalar("z")) })
+		case "$.a[1]":
+			assert.Same(t, doc.Content[0].Content[1], c.Parent())
+			assert.Equal(t, 1, c.Index())
+		case "$.b":
+			assert.Equal(t, "b", c.Key().Value)
+			assert.Equal(t, 1, c.Index())
+			assert.Panics(t, func() { c.InsertBefore(scalar("odd")) })
+			c.Delete()
+			assert.Nil(t, c.Node())
+			assert.Panics(t, func() { c.Replace(scalar("z")) })
+		}
+		return true
+	}, nil)
+}
+
+func TestApply_nonDocuments(t *testing.T) {
+	root := scalar("a")
+	result := Apply(root, func(c *Cursor) bool {
+		c.Replace(scalar("b"))
+		return true
+	}, nil)
+	assert.Equal(t, "b", result.Value)
+	assert.Equal(t, "a", root.Value)
+
+	assert.Nil(t, Apply(nil, nil, nil))
+}
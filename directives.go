@@ -0,0 +1,270 @@
+package yay
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// directivePrefix begins each directive within a comment, e.g. # yay:ignore
+const directivePrefix = "yay:"
+
+type directivesKey struct{}
+
+// Rule is implemented by handlers which may be suppressed by id via inline directives, such as # yay:disable rule-id.
+// Handlers which don't implement Rule are only suppressed by directives which don't name any rules.
+type Rule interface {
+	RuleID() string
+}
+
+// unsuppressible is implemented by internal handlers which must observe every node, regardless of directives
+type unsuppressible interface {
+	unsuppressible()
+}
+
+// directiveRange suppresses rule (or all rules, if empty) for nodes on the lines from start to end inclusive
+type directiveRange struct {
+	rule  string
+	start int
+	end   int
+}
+
+// directives are the suppressed nodes and line ranges of a document, as declared by comments within the document:
+//
+//	# yay:ignore [rule-id...]            the annotated node and its descendants
+//	# yay:ignore-next-line [rule-id...]  the node on the following line
+//	# yay:disable [rule-id...]           all nodes from the annotated node, until a matching # yay:enable [rule-id...]
+type directives struct {
+	// nodes are the rules (or "" for all rules) ignored for each node
+	nodes  map[*yaml.Node][]string
+	ranges []directiveRange
+}
+
+// ignore suppresses rules for node and its descendants, not following aliases
+func (d *directives) ignore(node *yaml.Node, rules []string) {
+	d.nodes[node] = append(d.nodes[node], rules...)
+	for _, child := range node.Content {
+		d.ignore(child, rules)
+	}
+}
+
+// suppresses determines whether rule is suppressed for node
+func (d *directives) suppresses(node *yaml.Node, rule string) bool {
+	for _, r := range d.nodes[node] {
+		if r == "" || r == rule {
+			return true
+		}
+	}
+	for _, r := range d.ranges {
+		if node.Line >= r.start && node.Line <= r.end && (r.rule == "" || r.rule == rule) {
+			return true
+		}
+	}
+	return false
+}
+
+type directive struct {
+	verb  string
+	rules []string
+}
+
+// parseDirectives returns the directives within a comment, one per line
+func parseDirectives(comment string) []directive {
+	result := make([]directive, 0)
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+		if !strings.HasPrefix(line, directivePrefix) {
+			continue
+		}
+		fields := strings.FieldsFunc(line[len(directivePrefix):], func(r rune) bool {
+			return unicode.IsSpace(r) || r == ','
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		result = append(result, directive{verb: fields[0], rules: fields[1:]})
+	}
+	return result
+}
+
+// toggle is a disable or enable directive at a line
+type toggle struct {
+	line    int
+	disable bool
+	rules   []string
+}
+
+// collectDirectives finds the directives within the comments of node and its descendants
+func collectDirectives(node *yaml.Node) *directives {
+	d := &directives{nodes: make(map[*yaml.Node][]string)}
+	toggles := make([]toggle, 0)
+
+	// apply declares the directives of comment, which annotates owners (if any) or otherwise the line at
+	apply := func(comment string, at int, owners []*yaml.Node) {
+		for _, dir := range parseDirectives(comment) {
+			rules := dir.rules
+			if len(rules) == 0 {
+				rules = []string{""}
+			}
+			switch dir.verb {
+			case "ignore":
+				for _, owner := range owners {
+					d.ignore(owner, rules)
+				}
+				if len(owners) == 0 {
+					for _, rule := range rules {
+						d.ranges = append(d.ranges, directiveRange{rule: rule, start: at, end: at})
+					}
+				}
+			case "ignore-next-line":
+				for _, rule := range rules {
+					d.ranges = append(d.ranges, directiveRange{rule: rule, start: at, end: at})
+				}
+			case "disable":
+				toggles = append(toggles, toggle{line: at, disable: true, rules: dir.rules})
+			case "enable":
+				toggles = append(toggles, toggle{line: at, rules: dir.rules})
+			}
+		}
+	}
+
+	// entry visits a node along with its mapping key, if any; comments of the entry may be on either node
+	var entry func(key *yaml.Node, value *yaml.Node)
+	entry = func(key *yaml.Node, value *yaml.Node) {
+		start, end := value.Line, lastLine(value)
+		owners := []*yaml.Node{value}
+		if key != nil {
+			start = key.Line
+			end = max(end, lastLine(key))
+			owners = []*yaml.Node{key, value}
+		}
+		for _, owner := range owners {
+			// head comments precede the entry and line comments are on its first line, both annotating the entry, while
+			// foot comments follow it and annotate the following line
+			apply(owner.HeadComment, start, owners)
+			apply(owner.LineComment, start+1, owners)
+			apply(owner.FootComment, end+1, nil)
+		}
+
+		switch value.Kind {
+		case yaml.DocumentNode:
+			for _, child := range value.Content {
+				entry(nil, child)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(value.Content); i += 2 {
+				entry(value.Content[i], value.Content[i+1])
+			}
+		case yaml.SequenceNode:
+			for _, child := range value.Content {
+				entry(nil, child)
+			}
+		}
+	}
+	entry(nil, node)
+
+	// pair each disable with the following enable of the same rule
+	slices.SortStableFunc(toggles, func(a, b toggle) int {
+		return a.line - b.line
+	})
+	open := make(map[string]int)
+	closeRange := func(rule string, line int) {
+		if start, ok := open[rule]; ok {
+			d.ranges = append(d.ranges, directiveRange{rule: rule, start: start, end: line - 1})
+			delete(open, rule)
+		}
+	}
+	for _, t := range toggles {
+		switch {
+		case t.disable && len(t.rules) == 0:
+			if _, ok := open[""]; !ok {
+				open[""] = t.line
+			}
+		case t.disable:
+			for _, rule := range t.rules {
+				if _, ok := open[rule]; !ok {
+					open[rule] = t.line
+				}
+			}
+		case len(t.rules) == 0:
+			for rule := range open {
+				closeRange(rule, t.line)
+			}
+		default:
+			for _, rule := range t.rules {
+				closeRange(rule, t.line)
+			}
+		}
+	}
+	for rule, start := range open {
+		d.ranges = append(d.ranges, directiveRange{rule: rule, start: start, end: math.MaxInt})
+	}
+	return d
+}
+
+// lastLine returns the greatest line of node and its descendants, not following aliases
+func lastLine(node *yaml.Node) int {
+	line := node.Line
+	for _, child := range node.Content {
+		line = max(line, lastLine(child))
+	}
+	return line
+}
+
+func withDirectives(ctx context.Context, d *directives) context.Context {
+	if len(d.nodes) == 0 && len(d.ranges) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, directivesKey{}, d)
+}
+
+// Suppressed determines whether rule is suppressed for node by an inline directive of the visited document, allowing
+// functions such as ConditionalHandler callbacks to honor directives for a specific rule. An empty rule is only
+// suppressed by directives which don't name any rules. See ForRule for a convenient wrapper.
+func Suppressed(ctx context.Context, node *yaml.Node, rule string) bool {
+	d, ok := ctx.Value(directivesKey{}).(*directives)
+	return ok && node != nil && d.suppresses(node, rule)
+}
+
+// suppressed determines whether handler should be skipped for the entry of key and value
+func suppressed(ctx context.Context, handler any, key *yaml.Node, value *yaml.Node) bool {
+	d, ok := ctx.Value(directivesKey{}).(*directives)
+	if !ok {
+		return false
+	}
+	handler = unwrapHandler(handler)
+	if _, ok := handler.(unsuppressible); ok {
+		return false
+	}
+	rule := ""
+	if r, ok := handler.(Rule); ok {
+		rule = r.RuleID()
+	}
+	node := value
+	if key != nil {
+		node = key
+	}
+	return d.suppresses(node, rule)
+}
+
+// ForRule wraps fn such that it's skipped for nodes on which rule is suppressed by an inline directive, for example:
+//
+//	OnVisitScalarNode("$..image", ForRule("pinned-images", fn))
+//
+// is skipped for an image annotated with # yay:ignore pinned-images.
+func ForRule(rule string, fn FnVisitKeyValueNode) FnVisitKeyValueNode {
+	return func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+		node := value
+		if key != nil {
+			node = key
+		}
+		if Suppressed(ctx, node, rule) {
+			return nil
+		}
+		return fn(ctx, key, value)
+	}
+}
@@ -0,0 +1,194 @@
+package yay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+// scalarRule collects the scalar values visited, and may be suppressed by id
+type scalarRule struct {
+	id     string
+	values []string
+}
+
+func (s *scalarRule) RuleID() string {
+	return s.id
+}
+
+func (s *scalarRule) VisitScalarNode(_ context.Context, _ *yaml.Node, value *yaml.Node) error {
+	s.values = append(s.values, value.Value)
+	return nil
+}
+
+func TestParseDirectives(t *testing.T) {
+	actual := parseDirectives("# regular comment\n# yay:ignore a, b\n#yay:enable\n# not yay:ignore")
+	assert.Equal(t, []directive{{verb: "ignore", rules: []string{"a", "b"}}, {verb: "enable", rules: []string{}}}, actual)
+}
+
+func TestVisitor_directives(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		first  []string
+		second []string
+	}{
+		"ignores the annotated node and its descendants": {
+			input: trimmed(`a: 1
+				|# yay:ignore
+				|b:
+				|  c: 2
+				|  d: [3, 4]
+				|e: 5`),
+			first:  []string{"1", "5"},
+			second: []string{"1", "5"},
+		},
+		"ignores the annotated node via line comments": {
+			input:  "a: 1 # yay:ignore\nb: 2",
+			first:  []string{"2"},
+			second: []string{"2"},
+		},
+		"ignores named rules": {
+			input: trimmed(`a: 1
+				|# yay:ignore first
+				|b:
+				|  c: 2
+				|e: 5`),
+			first:  []string{"1", "5"},
+			second: []string{"1", "2", "5"},
+		},
+		"ignores the next line": {
+			input: trimmed(`items:
+				|  # yay:ignore-next-line second
+				|  - 1
+				|  - 2
+				|a: b # yay:ignore-next-line
+				|c: d`),
+			first:  []string{"1", "2", "b"},
+			second: []string{"2", "b"},
+		},
+		"disables until enabled": {
+			input: trimmed(`a: 1
+				|# yay:disable
+				|b: 2
+				|c: 3
+				|# yay:enable
+				|d: 4`),
+			first:  []string{"1", "4"},
+			second: []string{"1", "4"},
+		},
+		"disables named rules until enabled": {
+			input: trimmed(`a: 1
+				|# yay:disable first, second
+				|b: 2
+				|# yay:enable second
+				|c: 3
+				|# yay:enable first
+				|d: 4`),
+			first:  []string{"1", "4"},
+			second: []string{"1", "3", "4"},
+		},
+		"disables until the end of the document": {
+			input:  "a: 1\n# yay:disable second\nb: 2\nc: 3",
+			first:  []string{"1", "2", "3"},
+			second: []string{"1"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), &doc))
+
+			first, second := &scalarRule{id: "first"}, &scalarRule{id: "second"}
+			v, err := NewVisitor(first, second)
+			assert.NoError(t, err)
+			assert.NoError(t, v.Visit(context.TODO(), &doc))
+			assert.Equal(t, tt.first, first.values)
+			assert.Equal(t, tt.second, second.values)
+
+			// a single handler is suppressed by the visitor, rather than the composite handler
+			single := &scalarRule{id: "second"}
+			v, err = NewVisitor(single)
+			assert.NoError(t, err)
+			assert.NoError(t, v.Visit(context.TODO(), &doc))
+			assert.Equal(t, tt.second, single.values)
+		})
+	}
+}
+
+// mappingRule collects the keys of the mappings visited
+type mappingRule struct {
+	keys [][]string
+}
+
+func (m *mappingRule) VisitMappingNode(_ context.Context, _ *yaml.Node, value *yaml.Node) error {
+	keys := make([]string, 0)
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		keys = append(keys, value.Content[i].Value)
+	}
+	m.keys = append(m.keys, keys)
+	return nil
+}
+
+func TestVisitor_directives_sharedLines(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("items:\n- a: 1 # yay:ignore\n  b: 2\n- {c: 3, d: 4} # yay:ignore\n"), &doc))
+
+	scalars, mappings := &scalarRule{id: "scalars"}, &mappingRule{}
+	v, err := NewVisitor(scalars, mappings)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), &doc))
+
+	// the ignored entry a: 1 shares its line with the mapping containing it, which is still visited
+	assert.Equal(t, []string{"2"}, scalars.values)
+	assert.Equal(t, [][]string{{"a", "b"}}, mappings.keys)
+}
+
+func TestForRule(t *testing.T) {
+	input := trimmed(`images:
+		|  - nginx:latest # yay:ignore pinned-images
+		|  - redis:latest
+		|  # yay:ignore
+		|  - postgres:latest`)
+
+	visited := make([]string, 0)
+	handler, err := NewConditionalHandler(
+		OnVisitScalarNode("$.images[*]", ForRule("pinned-images", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+			visited = append(visited, value.Value)
+			return nil
+		})),
+	)
+	assert.NoError(t, err)
+
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+	v, err := NewVisitor(handler)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), &doc))
+	assert.Equal(t, []string{"redis:latest"}, visited)
+
+	// the scalar on the third line is suppressed for the rule, while the scalar on the second line isn't
+	items := doc.Content[0].Content[1].Content
+	assert.True(t, Suppressed(withDirectives(context.TODO(), collectDirectives(&doc)), items[0], "pinned-images"))
+	assert.False(t, Suppressed(withDirectives(context.TODO(), collectDirectives(&doc)), items[1], "pinned-images"))
+}
+
+func TestVisitor_directives_builtinRules(t *testing.T) {
+	input := trimmed(`# yay:ignore-next-line yaml11
+		|enabled: yes
+		|other: no
+		|# yay:ignore duplicate-keys
+		|nested: {a: 1, a: 2}`)
+
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+	v, err := NewVisitor(NewYAML11Handler(), NewDuplicateKeyHandler())
+	assert.NoError(t, err)
+
+	errs := NodeErrors(v.Visit(context.TODO(), &doc))
+	if assert.Len(t, errs, 1) {
+		assert.ErrorIs(t, errs[0], ErrAmbiguousScalar)
+		assert.Equal(t, 3, errs[0].Node.Line)
+	}
+}
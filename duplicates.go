@@ -0,0 +1,201 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	_ VisitsDocumentNode = (*duplicateKeyHandler)(nil)
+	_ VisitsMappingNode  = (*duplicateKeyHandler)(nil)
+	_ Rule               = (*duplicateKeyHandler)(nil)
+)
+
+var (
+	// ErrDuplicateKey is wrapped by each DuplicateKeyError reporting a key defined more than once within a mapping
+	ErrDuplicateKey = errors.New("duplicate key")
+	// ErrShadowedKey is wrapped by each DuplicateKeyError reporting a merged key overridden by a key of the mapping itself
+	ErrShadowedKey = errors.New("shadowed merge key")
+	// ErrMergeConflict is wrapped by each DuplicateKeyError reporting a key merged from multiple sources with different values
+	ErrMergeConflict = errors.New("conflicting merge key")
+)
+
+// DuplicateKeyError reports two occurrences of the same key. Kind is one of ErrDuplicateKey, ErrShadowedKey, or
+// ErrMergeConflict. For ErrDuplicateKey, Original is the first occurrence and Duplicate the later one, whose value
+// yaml.v3 retains. Otherwise, the Original occurrence takes precedence over the Duplicate under merge semantics.
+type DuplicateKeyError struct {
+	Kind      error
+	Key       string
+	Original  *yaml.Node
+	Duplicate *yaml.Node
+}
+
+// Error describes the key and the positions of both occurrences
+func (e *DuplicateKeyError) Error() string {
+	if errors.Is(e.Kind, ErrDuplicateKey) {
+		return fmt.Sprintf("%s %q: defined at %d:%d and again at %d:%d", e.Kind, e.Key,
+			e.Original.Line, e.Original.Column, e.Duplicate.Line, e.Duplicate.Column)
+	}
+	return fmt.Sprintf("%s %q: %d:%d takes precedence over %d:%d", e.Kind, e.Key,
+		e.Original.Line, e.Original.Column, e.Duplicate.Line, e.Duplicate.Column)
+}
+
+// Unwrap returns the Kind of the error
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.Kind
+}
+
+// DuplicateKeyOpt is an option for NewDuplicateKeyHandler
+type DuplicateKeyOpt func(handler *duplicateKeyHandler)
+
+// WithKeyNormalizer further normalizes each key after its conversion to a string, such as strings.ToLower to
+// detect keys differing only by case
+func WithKeyNormalizer(fn func(key string) string) DuplicateKeyOpt {
+	return func(handler *duplicateKeyHandler) {
+		handler.normalizer = fn
+	}
+}
+
+// WithRetainedMergeKeyOrder is the counterpart of WithRetainMergeKeyOrder for NewDuplicateKeyHandler, such that keys
+// merged by earlier merge keys take precedence over later merge keys when reporting conflicts
+func WithRetainedMergeKeyOrder() DuplicateKeyOpt {
+	return func(handler *duplicateKeyHandler) {
+		handler.retainMergeKeyOrder = true
+	}
+}
+
+// duplicateKeyHandler detects duplicate, shadowed, and conflicting mapping keys.
+// See NewDuplicateKeyHandler for more information.
+type duplicateKeyHandler struct {
+	normalizer          func(key string) string
+	retainMergeKeyOrder bool
+}
+
+// RuleID identifies the handler within inline directives, e.g. # yay:ignore duplicate-keys
+func (h *duplicateKeyHandler) RuleID() string {
+	return "duplicate-keys"
+}
+
+// VisitDocumentNode checks the document's root mapping, as the visitor doesn't visit a document's root node.
+func (h *duplicateKeyHandler) VisitDocumentNode(ctx context.Context, key *yaml.Node) error {
+	if len(key.Content) == 0 || key.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	return h.VisitMappingNode(ctx, nil, key.Content[0])
+}
+
+// VisitMappingNode checks the keys of the mapping, and the keys of any mappings merged into it
+func (h *duplicateKeyHandler) VisitMappingNode(_ context.Context, _ *yaml.Node, value *yaml.Node) error {
+	var maybeErr error
+	report := func(at *yaml.Node, err *DuplicateKeyError) {
+		maybeErr = errors.Join(maybeErr, &NodeError{Node: at, Err: err})
+	}
+
+	type occurrence struct {
+		key   *yaml.Node
+		value *yaml.Node
+		own   bool
+	}
+	seen := make(map[string]occurrence)
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		k := value.Content[i]
+		if isMergeKey(k) {
+			continue
+		}
+		normalized := h.normalize(k)
+		if first, ok := seen[normalized]; ok {
+			report(k, &DuplicateKeyError{Kind: ErrDuplicateKey, Key: normalized, Original: first.key, Duplicate: k})
+			continue
+		}
+		seen[normalized] = occurrence{key: k, value: value.Content[i+1], own: true}
+	}
+
+	for _, source := range mergeOrder(value, h.retainMergeKeyOrder) {
+		for _, merged := range mergedEntries(source.mapping) {
+			normalized := h.normalize(merged.key)
+			first, ok := seen[normalized]
+			if !ok {
+				seen[normalized] = occurrence{key: merged.key, value: merged.value}
+				continue
+			}
+			if Hash(first.value) == Hash(merged.value) {
+				// merging an identical value is harmless
+				continue
+			}
+			kind := ErrMergeConflict
+			if first.own {
+				kind = ErrShadowedKey
+			}
+			report(source.key, &DuplicateKeyError{Kind: kind, Key: normalized, Original: first.key, Duplicate: merged.key})
+		}
+	}
+	return maybeErr
+}
+
+// mergeSource is a mapping merged by a merge key
+type mergeSource struct {
+	key     *yaml.Node
+	mapping *yaml.Node
+}
+
+// mergeOrder returns the sources merged into mapping by its merge keys, in order of precedence. As consolidated by
+// NewMultipleToSingleMergeHandler, the sources of multiple merge keys are reversed such that later merge keys take
+// precedence, unless retainMergeKeyOrder is set or the value of the first merge key is a sequence.
+func mergeOrder(mapping *yaml.Node, retainMergeKeyOrder bool) []mergeSource {
+	sources := make([]mergeSource, 0)
+	var firstKind yaml.Kind
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if !isMergeKey(key) {
+			continue
+		}
+		if firstKind == 0 {
+			firstKind = value.Kind
+		}
+		for _, source := range mergeSources(value) {
+			sources = append(sources, mergeSource{key: key, mapping: source})
+		}
+	}
+	if firstKind == yaml.AliasNode && !retainMergeKeyOrder {
+		slices.Reverse(sources)
+	}
+	return sources
+}
+
+// normalize converts key to a string, such that keys which collide once converted (e.g. 1 and "1") are equal
+func (h *duplicateKeyHandler) normalize(key *yaml.Node) string {
+	var normalized string
+	if resolved := resolveAlias(key); resolved != nil && resolved.Kind == yaml.ScalarNode {
+		_, normalized = canonicalScalar(resolved)
+	} else {
+		normalized = Hash(key)
+	}
+	if h.normalizer != nil {
+		normalized = h.normalizer(normalized)
+	}
+	return normalized
+}
+
+// NewDuplicateKeyHandler creates a handler which reports keys occurring more than once within a mapping. Keys are
+// compared once converted to strings, so 1, "1", and 0x1 are duplicates of each other. Merge keys are resolved to
+// report merged keys whose value is overridden by the mapping itself (ErrShadowedKey) or by a merge source taking
+// precedence (ErrMergeConflict). Within a single merge key, earlier sources take precedence over later sources. As with
+// NewMultipleToSingleMergeHandler, later merge keys take precedence over earlier merge keys unless
+// WithRetainedMergeKeyOrder is provided. Merged keys with identical values aren't reported.
+//
+// Each occurrence is reported as a NodeError wrapping a DuplicateKeyError, which wraps one of ErrDuplicateKey,
+// ErrShadowedKey, or ErrMergeConflict. Duplicate keys are positioned at the duplicate key, while shadowed and
+// conflicting keys are positioned at the merge key; the DuplicateKeyError provides the positions of both occurrences.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func NewDuplicateKeyHandler(opts ...DuplicateKeyOpt) *duplicateKeyHandler {
+	handler := &duplicateKeyHandler{}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
@@ -0,0 +1,111 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestNewDuplicateKeyHandler(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []DuplicateKeyOpt
+		expected []string
+		kinds    []error
+	}{
+		"ignores unique keys": {
+			input:    "a: 1\nb: {c: 2, d: 3}",
+			expected: []string{},
+		},
+		"reports duplicate keys of the root mapping": {
+			input:    "a: 1\nb: 2\na: 3",
+			expected: []string{`3:1: duplicate key "a": defined at 1:1 and again at 3:1`},
+			kinds:    []error{ErrDuplicateKey},
+		},
+		"reports duplicate keys after string normalization": {
+			input: trimmed(`nested:
+				|  1: one
+				|  "1": also one
+				|  0x1: hex one
+				|  true: yes
+				|  "true": no`),
+			expected: []string{
+				`3:3: duplicate key "1": defined at 2:3 and again at 3:3`,
+				`4:3: duplicate key "1": defined at 2:3 and again at 4:3`,
+				`6:3: duplicate key "true": defined at 5:3 and again at 6:3`,
+			},
+			kinds: []error{ErrDuplicateKey, ErrDuplicateKey, ErrDuplicateKey},
+		},
+		"supports custom normalization": {
+			input:    "nested:\n  Name: a\n  name: b",
+			opts:     []DuplicateKeyOpt{WithKeyNormalizer(strings.ToLower)},
+			expected: []string{`3:3: duplicate key "name": defined at 2:3 and again at 3:3`},
+			kinds:    []error{ErrDuplicateKey},
+		},
+		"reports shadowed merge keys": {
+			input: trimmed(`base: &base {x: 1, y: 2}
+				|use:
+				|  <<: *base
+				|  x: 1
+				|  y: 3`),
+			expected: []string{`3:3: shadowed merge key "y": 5:3 takes precedence over 1:20`},
+			kinds:    []error{ErrShadowedKey},
+		},
+		"reports conflicting merge sources": {
+			input: trimmed(`a: &a {x: 1, y: 1}
+				|b: &b {x: 2, y: 1}
+				|use:
+				|  <<: [*a, *b]`),
+			expected: []string{`4:3: conflicting merge key "x": 1:8 takes precedence over 2:8`},
+			kinds:    []error{ErrMergeConflict},
+		},
+		"reports conflicts across multiple merge keys": {
+			input: trimmed(`a: &a {x: 1}
+				|b: &b {x: 2}
+				|use:
+				|  <<: *a
+				|  <<: *b`),
+			expected: []string{`4:3: conflicting merge key "x": 2:8 takes precedence over 1:8`},
+			kinds:    []error{ErrMergeConflict},
+		},
+		"reports conflicts across multiple merge keys in their original order": {
+			input: trimmed(`a: &a {x: 1}
+				|b: &b {x: 2}
+				|use:
+				|  <<: *a
+				|  <<: *b`),
+			opts:     []DuplicateKeyOpt{WithRetainedMergeKeyOrder()},
+			expected: []string{`5:3: conflicting merge key "x": 1:8 takes precedence over 2:8`},
+			kinds:    []error{ErrMergeConflict},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), &doc))
+
+			v, err := NewVisitor(NewDuplicateKeyHandler(tt.opts...))
+			assert.NoError(t, err)
+			err = v.Visit(context.TODO(), &doc)
+
+			actual := make([]string, 0)
+			kinds := make([]error, 0)
+			for _, e := range NodeErrors(err) {
+				actual = append(actual, e.Error())
+				var duplicate *DuplicateKeyError
+				if assert.True(t, errors.As(e, &duplicate)) {
+					assert.ErrorIs(t, e, duplicate.Kind)
+					kinds = append(kinds, duplicate.Kind)
+				}
+			}
+			assert.Equal(t, tt.expected, actual)
+			if len(tt.kinds) > 0 {
+				assert.Equal(t, tt.kinds, kinds)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package yay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ErrOverlappingEdits is returned when applying text edits whose byte ranges overlap
+var ErrOverlappingEdits = errors.New("overlapping text edits")
+
+// TextEdit replaces the bytes from Start inclusive to End exclusive with Text
+type TextEdit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// String describes the edit, e.g. 12:15 "new"
+func (e TextEdit) String() string {
+	return fmt.Sprintf("%d:%d %q", e.Start, e.End, e.Text)
+}
+
+// ApplyEdits applies edits to source, returning the edited copy. Offsets of edits refer to the original source,
+// so edits may be provided in any order, but must not overlap.
+func ApplyEdits(source []byte, edits []TextEdit) ([]byte, error) {
+	sorted := slices.Clone(edits)
+	slices.SortStableFunc(sorted, func(a, b TextEdit) int {
+		return a.Start - b.Start
+	})
+
+	var buf bytes.Buffer
+	offset := 0
+	for _, edit := range sorted {
+		if edit.Start < offset || edit.End < edit.Start || edit.End > len(source) {
+			return nil, fmt.Errorf("%w: %s", ErrOverlappingEdits, edit)
+		}
+		buf.Write(source[offset:edit.Start])
+		buf.WriteString(edit.Text)
+		offset = edit.End
+	}
+	buf.Write(source[offset:])
+	return buf.Bytes(), nil
+}
+
+// nodeState is the state of a node when its source was tracked
+type nodeState struct {
+	kind    yaml.Kind
+	style   yaml.Style
+	tag     string
+	value   string
+	anchor  string
+	alias   *yaml.Node
+	content []*yaml.Node
+}
+
+func stateOf(node *yaml.Node) nodeState {
+	return nodeState{
+		kind:    node.Kind,
+		style:   node.Style,
+		tag:     node.Tag,
+		value:   node.Value,
+		anchor:  node.Anchor,
+		alias:   node.Alias,
+		content: slices.Clone(node.Content),
+	}
+}
+
+// SourceTracker records the byte offsets of each node of a document within its source, and the state of each node,
+// such that changes made to the document (e.g. by a handler) may be written as minimal text edits of the source.
+// See TrackSource.
+type SourceTracker struct {
+	source []byte
+	doc    *yaml.Node
+	index  *PositionIndex
+	states map[*yaml.Node]nodeState
+}
+
+// TrackSource records the source of doc, a document node decoded from source, prior to modifying doc.
+// Once modified, Edits computes the text edits reproducing the changes, and Apply applies them to the source.
+//
+// Changed scalars and replaced nodes are rewritten individually, while collections whose items or entries were added
+// or removed are rewritten entirely. Everything else, including formatting and comments, is retained from the source.
+// Comments are only written for nodes which are rewritten.
+func TrackSource(source []byte, doc *yaml.Node) (*SourceTracker, error) {
+	index, err := NewPositionIndex(source, doc)
+	if err != nil {
+		return nil, err
+	}
+	tracker := &SourceTracker{
+		source: source,
+		doc:    doc,
+		index:  index,
+		states: make(map[*yaml.Node]nodeState),
+	}
+	var record func(node *yaml.Node)
+	record = func(node *yaml.Node) {
+		if _, ok := tracker.states[node]; ok {
+			return
+		}
+		tracker.states[node] = stateOf(node)
+		for _, child := range node.Content {
+			record(child)
+		}
+	}
+	record(doc)
+	return tracker, nil
+}
+
+// Range returns the source range of node, as it was when the source was tracked
+func (s *SourceTracker) Range(node *yaml.Node) (Range, bool) {
+	if _, ok := s.states[node]; !ok {
+		return Range{}, false
+	}
+	return s.index.Range(node)
+}
+
+// Edits computes the text edits which apply the changes made to the document since its source was tracked
+func (s *SourceTracker) Edits() ([]TextEdit, error) {
+	edits := make([]TextEdit, 0)
+	var maybeErr error
+
+	// replace rewrites the source of original, a tracked node, as replacement
+	replace := func(original *yaml.Node, replacement *yaml.Node, flow bool) {
+		r, ok := s.index.Range(original)
+		if !ok {
+			maybeErr = errors.Join(maybeErr, &NodeError{Node: original, Err: fmt.Errorf("source range of node is unknown")})
+			return
+		}
+		// a block collection may only be written where the original node was one, otherwise it's written inline
+		block := !flow && isBlockCollection(original)
+		indent := r.Start.Column - 1
+		if !block {
+			indent = s.indentation(r.Start.Offset)
+		}
+		excluded, end := s.boundaryComments(original, replacement, r, block)
+		text, err := s.encode(replacement, indent, !block, flow, excluded)
+		if err != nil {
+			maybeErr = errors.Join(maybeErr, &NodeError{Node: original, Err: err})
+			return
+		}
+		edits = append(edits, TextEdit{Start: r.Start.Offset, End: end, Text: text})
+	}
+
+	var diff func(node *yaml.Node, flow bool)
+	diff = func(node *yaml.Node, flow bool) {
+		state := s.states[node]
+		childFlow := flow || node.Style&yaml.FlowStyle != 0
+		switch {
+		case !s.changed(node, state):
+			for _, child := range node.Content {
+				diff(child, childFlow)
+			}
+		case s.replacedChildren(node, state):
+			// children replaced in place are rewritten individually
+			for i, child := range node.Content {
+				if child == state.content[i] {
+					diff(child, childFlow)
+				} else {
+					replace(state.content[i], child, childFlow)
+				}
+			}
+		case node.Kind == yaml.DocumentNode:
+			if len(state.content) == 0 || len(node.Content) == 0 {
+				maybeErr = errors.Join(maybeErr, fmt.Errorf("unable to add or remove the root node of a document"))
+				return
+			}
+			replace(state.content[0], node.Content[0], false)
+		default:
+			replace(node, node, flow)
+		}
+	}
+	diff(s.doc, false)
+	return edits, maybeErr
+}
+
+// Apply applies the edits computed by Edits to the tracked source
+func (s *SourceTracker) Apply() ([]byte, error) {
+	edits, err := s.Edits()
+	if err != nil {
+		return nil, err
+	}
+	return ApplyEdits(s.source, edits)
+}
+
+// changed determines whether node must be rewritten, rather than its descendants
+func (s *SourceTracker) changed(node *yaml.Node, state nodeState) bool {
+	if _, ok := s.states[node]; !ok {
+		return true
+	}
+	return node.Kind != state.kind ||
+		node.Style != state.style ||
+		node.Tag != state.tag ||
+		node.Value != state.value ||
+		node.Anchor != state.anchor ||
+		node.Alias != state.alias ||
+		!slices.Equal(node.Content, state.content)
+}
+
+// replacedChildren determines whether the only change to node is the replacement of children, retaining the
+// number of children
+func (s *SourceTracker) replacedChildren(node *yaml.Node, state nodeState) bool {
+	return node.Kind == state.kind &&
+		node.Style == state.style &&
+		node.Tag == state.tag &&
+		node.Value == state.value &&
+		node.Anchor == state.anchor &&
+		node.Alias == state.alias &&
+		len(node.Content) == len(state.content)
+}
+
+// indentation returns the number of spaces indenting the line containing offset
+func (s *SourceTracker) indentation(offset int) int {
+	start := bytes.LastIndexByte(s.source[:offset], '\n') + 1
+	n := 0
+	for start+n < len(s.source) && s.source[start+n] == ' ' {
+		n++
+	}
+	return n
+}
+
+// excludedComments are the comments of a node which are excluded when encoding a replacement
+type excludedComments struct {
+	head bool
+	line bool
+	foot bool
+}
+
+// boundaryComments determines which comments of the descendants of original lie outside of r, its source range, and
+// are therefore retained by the source rather than encoded: head comments of its first descendants, and line and
+// foot comments of its last descendants. These nodes may be anywhere within the replacement, e.g. once an item is
+// appended after the original last item. If a last descendant of a block collection is no longer last, the line
+// comment trailing it is instead included in the edit, so it's encoded once along with its node. The end of the edit
+// is returned.
+func (s *SourceTracker) boundaryComments(original *yaml.Node, replacement *yaml.Node, r Range, block bool) (map[*yaml.Node]excludedComments, int) {
+	excluded := make(map[*yaml.Node]excludedComments)
+	for node := original; len(s.states[node].content) > 0; {
+		node = s.states[node].content[0]
+		excluded[node] = excludedComments{head: true}
+	}
+
+	last := make(map[*yaml.Node]bool)
+	for node := replacement; len(node.Content) > 0; {
+		node = node.Content[len(node.Content)-1]
+		last[node] = true
+	}
+
+	end := r.End.Offset
+	for node := original; len(s.states[node].content) > 0; {
+		content := s.states[node].content
+		node = content[len(content)-1]
+		comments := excluded[node]
+		comments.foot = true
+		comments.line = true
+		if node.LineComment != "" && block && !last[node] {
+			if commentEnd, ok := s.trailingComment(end); ok {
+				comments.line = false
+				end = commentEnd
+			}
+		}
+		excluded[node] = comments
+	}
+	return excluded, end
+}
+
+// trailingComment returns the end of the comment following offset on the same line, excluding the line break
+func (s *SourceTracker) trailingComment(offset int) (int, bool) {
+	for offset < len(s.source) && (s.source[offset] == ' ' || s.source[offset] == '\t') {
+		offset++
+	}
+	if offset >= len(s.source) || s.source[offset] != '#' {
+		return 0, false
+	}
+	for offset < len(s.source) && s.source[offset] != '\n' && s.source[offset] != '\r' {
+		offset++
+	}
+	return offset, true
+}
+
+// encode writes node as it should appear at a position indented by indent columns. Comments of node and excluded
+// comments of its descendants are retained by the source, so they're not encoded.
+func (s *SourceTracker) encode(node *yaml.Node, indent int, inline bool, flow bool, excluded map[*yaml.Node]excludedComments) (string, error) {
+	clone := cloneNode(node)
+	var exclude func(original *yaml.Node, clone *yaml.Node)
+	exclude = func(original *yaml.Node, clone *yaml.Node) {
+		comments := excluded[original]
+		if comments.head {
+			clone.HeadComment = ""
+		}
+		if comments.line {
+			clone.LineComment = ""
+		}
+		if comments.foot {
+			clone.FootComment = ""
+		}
+		for i, child := range original.Content {
+			exclude(child, clone.Content[i])
+		}
+	}
+	exclude(node, clone)
+	clone.HeadComment, clone.LineComment, clone.FootComment = "", "", ""
+	if inline {
+		inlineStyle(clone, flow)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{clone}}); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	text := strings.TrimSuffix(buf.String(), "\n")
+	return strings.ReplaceAll(text, "\n", "\n"+strings.Repeat(" ", indent)), nil
+}
+
+// inlineStyle writes collections of node in flow style, as well as block scalars if within a flow collection
+func inlineStyle(node *yaml.Node, flow bool) {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		node.Style |= yaml.FlowStyle
+		for _, child := range node.Content {
+			inlineStyle(child, true)
+		}
+	case yaml.ScalarNode:
+		if flow && node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+			node.Style = node.Style&^(yaml.LiteralStyle|yaml.FoldedStyle) | yaml.DoubleQuotedStyle
+		}
+	}
+}
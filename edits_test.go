@@ -0,0 +1,303 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestApplyEdits(t *testing.T) {
+	tests := map[string]struct {
+		edits    []TextEdit
+		expected string
+		err      error
+	}{
+		"applies edits in any order": {
+			edits:    []TextEdit{{Start: 6, End: 11, Text: "there"}, {Start: 0, End: 5, Text: "hi"}},
+			expected: "hi there!",
+		},
+		"inserts text":            {edits: []TextEdit{{Start: 5, End: 5, Text: ","}}, expected: "hello, world!"},
+		"rejects overlaps":        {edits: []TextEdit{{Start: 0, End: 5}, {Start: 4, End: 6}}, err: ErrOverlappingEdits},
+		"rejects invalid offsets": {edits: []TextEdit{{Start: 0, End: 50}}, err: ErrOverlappingEdits},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := ApplyEdits([]byte("hello world!"), tt.edits)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(actual))
+		})
+	}
+}
+
+func TestSourceTracker(t *testing.T) {
+	input := trimmed(`# settings
+		|name:   demo    # keep this spacing
+		|replicas: 1
+		|script: |
+		|  echo one
+		|labels: {app: demo,   tier: web}
+		|env:
+		|  # first
+		|  - name: A
+		|    value: "1"
+		|  - name: B
+		|    value: '2'
+		|ports: [80]
+		|`)
+
+	tests := map[string]struct {
+		edit     func(doc *yaml.Node)
+		expected string
+	}{
+		"retains unchanged documents": {
+			edit:     func(doc *yaml.Node) {},
+			expected: input,
+		},
+		"rewrites changed scalars": {
+			edit: func(doc *yaml.Node) {
+				root := doc.Content[0]
+				root.Content[1].Value = "renamed"
+				root.Content[3].Value = "3"
+				root.Content[9].Content[1].Content[3].Value = "two"
+			},
+			expected: trimmed(`# settings
+				|name:   renamed    # keep this spacing
+				|replicas: 3
+				|script: |
+				|  echo one
+				|labels: {app: demo,   tier: web}
+				|env:
+				|  # first
+				|  - name: A
+				|    value: "1"
+				|  - name: B
+				|    value: 'two'
+				|ports: [80]
+				|`),
+		},
+		"rewrites block scalars": {
+			edit: func(doc *yaml.Node) {
+				doc.Content[0].Content[5].Value = "echo one\necho two\n"
+			},
+			expected: trimmed(`# settings
+				|name:   demo    # keep this spacing
+				|replicas: 1
+				|script: |
+				|  echo one
+				|  echo two
+				|labels: {app: demo,   tier: web}
+				|env:
+				|  # first
+				|  - name: A
+				|    value: "1"
+				|  - name: B
+				|    value: '2'
+				|ports: [80]
+				|`),
+		},
+		"rewrites changed keys": {
+			edit: func(doc *yaml.Node) {
+				doc.Content[0].Content[2].Value = "count"
+			},
+			expected: trimmed(`# settings
+				|name:   demo    # keep this spacing
+				|count: 1
+				|script: |
+				|  echo one
+				|labels: {app: demo,   tier: web}
+				|env:
+				|  # first
+				|  - name: A
+				|    value: "1"
+				|  - name: B
+				|    value: '2'
+				|ports: [80]
+				|`),
+		},
+		"rewrites block collections whose entries changed": {
+			edit: func(doc *yaml.Node) {
+				env := doc.Content[0].Content[9]
+				env.Content = append(env.Content, &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+					{Kind: yaml.ScalarNode, Value: "name"}, {Kind: yaml.ScalarNode, Value: "C"},
+				}})
+			},
+			expected: trimmed(`# settings
+				|name:   demo    # keep this spacing
+				|replicas: 1
+				|script: |
+				|  echo one
+				|labels: {app: demo,   tier: web}
+				|env:
+				|  # first
+				|  - name: A
+				|    value: "1"
+				|  - name: B
+				|    value: '2'
+				|  - name: C
+				|ports: [80]
+				|`),
+		},
+		"rewrites flow collections inline": {
+			edit: func(doc *yaml.Node) {
+				root := doc.Content[0]
+				labels := root.Content[7]
+				labels.Content = labels.Content[:2]
+				ports := root.Content[11]
+				ports.Content = append(ports.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "443"})
+			},
+			expected: trimmed(`# settings
+				|name:   demo    # keep this spacing
+				|replicas: 1
+				|script: |
+				|  echo one
+				|labels: {app: demo}
+				|env:
+				|  # first
+				|  - name: A
+				|    value: "1"
+				|  - name: B
+				|    value: '2'
+				|ports: [80, 443]
+				|`),
+		},
+		"writes collections replacing scalars inline": {
+			edit: func(doc *yaml.Node) {
+				doc.Content[0].Content[3] = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+					{Kind: yaml.ScalarNode, Value: "min"}, {Kind: yaml.ScalarNode, Value: "1"},
+				}}
+			},
+			expected: trimmed(`# settings
+				|name:   demo    # keep this spacing
+				|replicas: {min: 1}
+				|script: |
+				|  echo one
+				|labels: {app: demo,   tier: web}
+				|env:
+				|  # first
+				|  - name: A
+				|    value: "1"
+				|  - name: B
+				|    value: '2'
+				|ports: [80]
+				|`),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+			tracker, err := TrackSource([]byte(input), &doc)
+			assert.NoError(t, err)
+
+			tt.edit(&doc)
+			actual, err := tracker.Apply()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(actual))
+		})
+	}
+}
+
+func TestSourceTracker_boundaryComments(t *testing.T) {
+	item := func(value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	}
+	tests := map[string]struct {
+		input    string
+		edit     func(seq *yaml.Node)
+		expected string
+	}{
+		"appends after a commented last item": {
+			input: "b:\n  - x\n  - y   # why\nc: 1\n",
+			edit: func(seq *yaml.Node) {
+				seq.Content = append(seq.Content, item("w"))
+			},
+			expected: "b:\n  - x\n  - y # why\n  - w\nc: 1\n",
+		},
+		"removes a commented last item": {
+			input: "b:\n  - x\n  - y   # why\nc: 1\n",
+			edit: func(seq *yaml.Node) {
+				seq.Content = seq.Content[:1]
+			},
+			expected: "b:\n  - x\nc: 1\n",
+		},
+		"prepends before a commented first item": {
+			input: "b:\n  # first\n  - x\n  - y\n",
+			edit: func(seq *yaml.Node) {
+				seq.Content = append([]*yaml.Node{item("w")}, seq.Content...)
+			},
+			expected: "b:\n  # first\n  - w\n  - x\n  - y\n",
+		},
+		"appends to flow collections followed by comments": {
+			input: "b: [x, y] # why\n",
+			edit: func(seq *yaml.Node) {
+				seq.Content = append(seq.Content, item("w"))
+			},
+			expected: "b: [x, y, w] # why\n",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), &doc))
+			tracker, err := TrackSource([]byte(tt.input), &doc)
+			assert.NoError(t, err)
+
+			tt.edit(doc.Content[0].Content[1])
+			actual, err := tracker.Apply()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(actual))
+		})
+	}
+}
+
+func TestSourceTracker_handlers(t *testing.T) {
+	input := "image: nginx:1.25  # pinned\nreplicas:    2\n"
+
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+	tracker, err := TrackSource([]byte(input), &doc)
+	assert.NoError(t, err)
+
+	handler, err := NewConditionalHandler(OnVisitScalarNode("$.image", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+		value.Value = "nginx:1.27"
+		return nil
+	}))
+	assert.NoError(t, err)
+	v, err := NewVisitor(handler)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), &doc))
+
+	edits, err := tracker.Edits()
+	assert.NoError(t, err)
+	assert.Equal(t, []TextEdit{{Start: 7, End: 17, Text: "nginx:1.27"}}, edits)
+
+	r, ok := tracker.Range(doc.Content[0].Content[3])
+	assert.True(t, ok)
+	assert.Equal(t, Position{Line: 2, Column: 14, Offset: 41}, r.Start)
+
+	// nodes added after tracking have no source range
+	_, ok = tracker.Range(&yaml.Node{Kind: yaml.ScalarNode})
+	assert.False(t, ok)
+}
+
+func TestSourceTracker_unknownRange(t *testing.T) {
+	input := "a: 1\n"
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+	tracker, err := TrackSource([]byte(input), &doc)
+	assert.NoError(t, err)
+
+	// nodes created by a previous transformation have no position
+	doc.Content[0].Content[1].Line = 0
+	doc.Content[0].Content[1].Value = "2"
+	_, err = tracker.Edits()
+	var nodeErr *NodeError
+	assert.True(t, errors.As(err, &nodeErr))
+}
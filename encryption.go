@@ -0,0 +1,394 @@
+package yay
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	// ErrAlreadyEncrypted is returned by EncryptDocument when the document already contains encryption metadata
+	ErrAlreadyEncrypted = errors.New("document is already encrypted")
+	// ErrNotEncrypted is returned by DecryptDocument when the document doesn't contain encryption metadata
+	ErrNotEncrypted = errors.New("document is not encrypted")
+	// ErrIntegrity is returned by DecryptDocument when the document's MAC doesn't match its decrypted contents
+	ErrIntegrity = errors.New("document integrity check failed")
+)
+
+const encryptedValuePrefix = "ENC[AES_GCM,"
+
+// KeyProvider provides the data key used to encrypt and decrypt values
+type KeyProvider interface {
+	// DataKey returns the AES key used to encrypt and decrypt values, which must be 16, 24, or 32 bytes
+	DataKey(ctx context.Context) ([]byte, error)
+}
+
+// StaticKey is a KeyProvider returning a fixed data key
+type StaticKey []byte
+
+// DataKey satisfies KeyProvider
+func (k StaticKey) DataKey(context.Context) ([]byte, error) {
+	return k, nil
+}
+
+type encryptionOptions struct {
+	paths       []Condition
+	tag         string
+	metadataKey string
+}
+
+// EncryptionOpt is an option for EncryptDocument and DecryptDocument
+type EncryptionOpt func(o *encryptionOptions)
+
+// WithEncryptPaths is an option for EncryptDocument which encrypts only the scalars selected by any of the [yamlpath]
+// expressions, rather than all scalars. When a mapping or sequence is selected, every scalar within it is encrypted.
+// May be provided multiple times.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func WithEncryptPaths(paths ...string) EncryptionOpt {
+	return func(o *encryptionOptions) {
+		for _, p := range paths {
+			o.paths = append(o.paths, Selector(p))
+		}
+	}
+}
+
+// WithEncryptedTag changes the tag of encrypted scalars, which defaults to !encrypted
+func WithEncryptedTag(tag string) EncryptionOpt {
+	return func(o *encryptionOptions) {
+		o.tag = shortTag(tag)
+	}
+}
+
+// WithEncryptionMetadataKey changes the key of the root mapping under which encryption metadata is stored, which defaults to yay
+func WithEncryptionMetadataKey(key string) EncryptionOpt {
+	return func(o *encryptionOptions) {
+		o.metadataKey = key
+	}
+}
+
+// cryptHandler encrypts or decrypts the scalars of a document, while computing a MAC over its plaintext.
+// Changes are collected during the visit and applied once the visit completes successfully.
+type cryptHandler struct {
+	options encryptionOptions
+	aead    cipher.AEAD
+	mac     hash.Hash
+	decrypt bool
+	match   fnMatchCondition
+	// matched are collections selected by the configured paths, whose nested scalars are all encrypted
+	matched map[*yaml.Node]struct{}
+	changes []func()
+}
+
+func (c *cryptHandler) VisitSequenceNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return c.visitCollection(ctx, value)
+}
+
+func (c *cryptHandler) VisitMappingNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return c.visitCollection(ctx, value)
+}
+
+func (c *cryptHandler) visitCollection(ctx context.Context, value *yaml.Node) error {
+	t, ok := traversalFrom(ctx)
+	if !ok {
+		return &NodeError{Node: value, Err: errors.New("unable to determine the path of the node")}
+	}
+	if c.isMetadata(t) {
+		return nil
+	}
+	c.digest(t, value, value.ShortTag(), "")
+	if c.match == nil || c.decrypt {
+		return nil
+	}
+	ok, err := c.selects(ctx, value)
+	if ok {
+		c.matched[value] = struct{}{}
+	}
+	return err
+}
+
+func (c *cryptHandler) VisitAliasNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	t, ok := traversalFrom(ctx)
+	if !ok {
+		return &NodeError{Node: value, Err: errors.New("unable to determine the path of the node")}
+	}
+	if !c.isMetadata(t) {
+		c.digest(t, value, "", value.Value)
+	}
+	return nil
+}
+
+func (c *cryptHandler) VisitScalarNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	t, ok := traversalFrom(ctx)
+	if !ok {
+		return &NodeError{Node: value, Err: errors.New("unable to determine the path of the node")}
+	}
+	if c.isMetadata(t) {
+		return nil
+	}
+	path := t.path()
+
+	if c.decrypt {
+		tag, plaintext := value.ShortTag(), value.Value
+		if tag == c.options.tag {
+			var style yaml.Style
+			var err error
+			tag, plaintext, style, err = c.open(path, value.Value)
+			if err != nil {
+				return &NodeError{Node: value, Err: err}
+			}
+			c.changes = append(c.changes, func() {
+				value.Tag = tag
+				value.Value = plaintext
+				value.Style = style
+			})
+		}
+		c.digest(t, value, tag, plaintext)
+		return nil
+	}
+
+	tag := value.ShortTag()
+	c.digest(t, value, tag, value.Value)
+	if tag == c.options.tag {
+		return &NodeError{Node: value, Err: fmt.Errorf("value is already tagged %s", tag)}
+	}
+
+	ok, err := c.selects(ctx, value)
+	if err != nil || !ok {
+		return err
+	}
+	sealed, err := c.seal(path, tag, value)
+	if err != nil {
+		return &NodeError{Node: value, Err: err}
+	}
+	c.changes = append(c.changes, func() {
+		value.Tag = c.options.tag
+		value.Value = sealed
+	})
+	return nil
+}
+
+// selects determines whether the node is selected by a configured path, or nested within a selected collection
+func (c *cryptHandler) selects(ctx context.Context, node *yaml.Node) (bool, error) {
+	if c.match == nil {
+		return true, nil
+	}
+	if t, ok := traversalFrom(ctx); ok {
+		for _, f := range t.frames {
+			if _, ok := c.matched[f.node]; ok {
+				return true, nil
+			}
+		}
+	}
+	_, ok, err := c.match(ctx, node)
+	return ok, err
+}
+
+// isMetadata determines whether the traversal is within the encryption metadata of the document's root mapping
+func (c *cryptHandler) isMetadata(t *traversal) bool {
+	return len(t.frames) > 1 && t.frames[1].key != nil && t.frames[1].key.Value == c.options.metadataKey
+}
+
+// digest adds a node to the MAC of the document's plaintext. The node's kind, path, and the position of each entry
+// along its path are included, such that nodes can't be re-typed, moved, or reordered.
+func (c *cryptHandler) digest(t *traversal, node *yaml.Node, tag string, value string) {
+	positions := make([]string, 0, len(t.frames))
+	for _, f := range t.frames {
+		positions = append(positions, strconv.Itoa(f.index))
+	}
+	for _, part := range []string{strconv.Itoa(int(node.Kind)), t.path(), strings.Join(positions, "/"), tag, value} {
+		c.mac.Write([]byte(part))
+		c.mac.Write([]byte{0})
+	}
+}
+
+// seal encrypts the value of node, authenticating its path and tag such that encrypted values can't be moved or re-typed.
+// The style of node is retained within the encrypted value, as the encrypted value may require a different style.
+func (c *cryptHandler) seal(path string, tag string, node *yaml.Node) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := c.aead.Seal(nil, nonce, []byte(node.Value), []byte(path+"\x00"+tag))
+	return fmt.Sprintf("%sdata:%s,iv:%s,type:%s,style:%d]", encryptedValuePrefix,
+		base64.StdEncoding.EncodeToString(data), base64.StdEncoding.EncodeToString(nonce), tag, node.Style), nil
+}
+
+// open decrypts a value created by seal, returning the original tag, value, and style
+func (c *cryptHandler) open(path string, sealed string) (string, string, yaml.Style, error) {
+	if !strings.HasPrefix(sealed, encryptedValuePrefix) || !strings.HasSuffix(sealed, "]") {
+		return "", "", 0, errors.New("malformed encrypted value")
+	}
+	fields := make(map[string]string)
+	for _, field := range strings.Split(sealed[len(encryptedValuePrefix):len(sealed)-1], ",") {
+		name, val, _ := strings.Cut(field, ":")
+		fields[name] = val
+	}
+	data, err := base64.StdEncoding.DecodeString(fields["data"])
+	if err != nil {
+		return "", "", 0, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(fields["iv"])
+	if err != nil || len(nonce) != c.aead.NonceSize() {
+		return "", "", 0, errors.New("malformed encrypted value: invalid iv")
+	}
+	style, err := strconv.Atoi(fields["style"])
+	if err != nil {
+		return "", "", 0, errors.New("malformed encrypted value: invalid style")
+	}
+	tag := fields["type"]
+	plaintext, err := c.aead.Open(nil, nonce, data, []byte(path+"\x00"+tag))
+	if err != nil {
+		return "", "", 0, fmt.Errorf("unable to decrypt value: %w", err)
+	}
+	return tag, string(plaintext), yaml.Style(style), nil
+}
+
+// EncryptDocument encrypts scalar values of doc in place using AES-GCM with the data key of provider, similar to SOPS.
+// Each encrypted scalar is tagged !encrypted, retaining its comments and style, and its original tag is restored by
+// DecryptDocument. Each value is authenticated with its path, so encrypted values can't be moved within the document.
+//
+// All scalars are encrypted unless restricted by WithEncryptPaths. A MAC over the document's plaintext, including
+// unencrypted values and the structure of the document, is stored in a metadata mapping (see WithEncryptionMetadataKey)
+// added to the document's root mapping. An error is returned if the root mapping already defines the metadata key.
+func EncryptDocument(ctx context.Context, doc *yaml.Node, provider KeyProvider, opts ...EncryptionOpt) error {
+	c, root, err := newCryptHandler(ctx, doc, provider, false, opts)
+	if err != nil {
+		return err
+	}
+	if metadata := metadataOf(root, c.options.metadataKey); metadata != nil && scalarValue(metadata, "mac") != "" {
+		return ErrAlreadyEncrypted
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == c.options.metadataKey {
+			// the key isn't encryption metadata, and would be neither encrypted nor authenticated
+			return &NodeError{Node: root.Content[i], Err: fmt.Errorf("the encryption metadata key %q is already defined, see WithEncryptionMetadataKey", c.options.metadataKey)}
+		}
+	}
+
+	if err := visitWith(ctx, doc, c); err != nil {
+		return err
+	}
+	for _, change := range c.changes {
+		change()
+	}
+
+	metadata := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "cipher"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "AES_GCM"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "mac"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: base64.StdEncoding.EncodeToString(c.mac.Sum(nil))},
+	}}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: c.options.metadataKey}, metadata)
+	return nil
+}
+
+// DecryptDocument decrypts the values of doc encrypted by EncryptDocument in place, restoring their original tags.
+// The document is only modified once the MAC of its decrypted contents has been verified, otherwise ErrIntegrity is returned.
+// The metadata mapping is removed from the document.
+func DecryptDocument(ctx context.Context, doc *yaml.Node, provider KeyProvider, opts ...EncryptionOpt) error {
+	c, root, err := newCryptHandler(ctx, doc, provider, true, opts)
+	if err != nil {
+		return err
+	}
+	metadata := metadataOf(root, c.options.metadataKey)
+	if metadata == nil {
+		return ErrNotEncrypted
+	}
+
+	if err := visitWith(ctx, doc, c); err != nil {
+		return err
+	}
+	expected, err := base64.StdEncoding.DecodeString(scalarValue(metadata, "mac"))
+	if err != nil || !hmac.Equal(expected, c.mac.Sum(nil)) {
+		return ErrIntegrity
+	}
+
+	for _, change := range c.changes {
+		change()
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == c.options.metadataKey {
+			root.Content = append(root.Content[:i], root.Content[i+2:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func newCryptHandler(ctx context.Context, doc *yaml.Node, provider KeyProvider, decrypt bool, opts []EncryptionOpt) (*cryptHandler, *yaml.Node, error) {
+	if doc == nil || doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, errors.New("encryption requires a document with a root mapping")
+	}
+
+	options := encryptionOptions{tag: "!encrypted", metadataKey: "yay"}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	key, err := provider.DataKey(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to retrieve data key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the MAC key is derived from, rather than equal to, the data key
+	derived := hmac.New(sha256.New, key)
+	derived.Write([]byte("yay mac"))
+
+	c := &cryptHandler{
+		options: options,
+		aead:    aead,
+		mac:     hmac.New(sha256.New, derived.Sum(nil)),
+		decrypt: decrypt,
+		matched: make(map[*yaml.Node]struct{}),
+	}
+	if len(options.paths) > 0 {
+		c.match = Any(options.paths...).compile()
+	}
+	return c, doc.Content[0], nil
+}
+
+func visitWith(ctx context.Context, doc *yaml.Node, handler any) error {
+	v, err := NewVisitor(handler)
+	if err != nil {
+		return err
+	}
+	return v.Visit(ctx, doc)
+}
+
+func metadataOf(root *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key && root.Content[i+1].Kind == yaml.MappingNode {
+			return root.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalarValue(mapping *yaml.Node, key string) string {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1].Value
+		}
+	}
+	return ""
+}
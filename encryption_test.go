@@ -0,0 +1,183 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+type failingKeyProvider struct{}
+
+func (failingKeyProvider) DataKey(context.Context) ([]byte, error) {
+	return nil, errors.New("key unavailable")
+}
+
+func TestEncryptDocument(t *testing.T) {
+	key := StaticKey("0123456789abcdef0123456789abcdef")
+	input := trimmed(`# database settings
+		|database:
+		|    host: localhost # the host
+		|    port: 5432
+		|    password: &pw hunter2
+		|    enabled: true
+		|replicas:
+		|    - password: *pw
+		|    - password: other
+		|tokens: [a, "b"]`)
+
+	tests := map[string]struct {
+		opts      []EncryptionOpt
+		encrypted []string
+		plaintext []string
+	}{
+		"encrypts all scalars": {
+			encrypted: []string{"localhost", "5432", "hunter2", "true", "other", "a", "b"},
+		},
+		"encrypts selected paths": {
+			opts:      []EncryptionOpt{WithEncryptPaths("$..password", "$.tokens")},
+			encrypted: []string{"hunter2", "other", "a", "b"},
+			plaintext: []string{"host: localhost # the host", "port: 5432", "enabled: true"},
+		},
+		"supports custom tags and metadata keys": {
+			opts:      []EncryptionOpt{WithEncryptPaths("$.database.host"), WithEncryptedTag("!sealed"), WithEncryptionMetadataKey("sops")},
+			encrypted: []string{"localhost"},
+			plaintext: []string{"password: &pw hunter2"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc := &yaml.Node{}
+			assert.NoError(t, yaml.Unmarshal([]byte(input), doc))
+			assert.NoError(t, EncryptDocument(context.TODO(), doc, key, tt.opts...))
+
+			out, err := yaml.Marshal(doc)
+			assert.NoError(t, err)
+			encrypted := string(out)
+			assert.Contains(t, encrypted, "# database settings")
+			assert.Contains(t, encrypted, "# the host")
+			assert.Contains(t, encrypted, "mac: ")
+			for _, value := range tt.encrypted {
+				assert.NotContains(t, encrypted, ": "+value+"\n")
+			}
+			for _, value := range tt.plaintext {
+				assert.Contains(t, encrypted, value)
+			}
+			assert.ErrorIs(t, EncryptDocument(context.TODO(), doc, key, tt.opts...), ErrAlreadyEncrypted)
+
+			// round-trip through text, as a user would
+			reparsed := &yaml.Node{}
+			assert.NoError(t, yaml.Unmarshal(out, reparsed))
+			assert.NoError(t, DecryptDocument(context.TODO(), reparsed, key, tt.opts...))
+			decrypted, err := yaml.Marshal(reparsed)
+			assert.NoError(t, err)
+			assert.Equal(t, input, string(decrypted))
+		})
+	}
+}
+
+func TestDecryptDocument_integrity(t *testing.T) {
+	key := StaticKey("0123456789abcdef")
+	encrypt := func(t *testing.T, input string) *yaml.Node {
+		t.Helper()
+		doc := &yaml.Node{}
+		assert.NoError(t, yaml.Unmarshal([]byte(input), doc))
+		assert.NoError(t, EncryptDocument(context.TODO(), doc, key, WithEncryptPaths("$.secret", "$.other")))
+		return doc
+	}
+
+	tests := map[string]struct {
+		tamper  func(root *yaml.Node)
+		key     KeyProvider
+		wantErr string
+		is      error
+	}{
+		"detects modified plaintext": {
+			tamper: func(root *yaml.Node) { root.Content[1].Value = "changed" },
+			is:     ErrIntegrity,
+		},
+		"detects moved values": {
+			tamper: func(root *yaml.Node) {
+				root.Content[3].Value, root.Content[5].Value = root.Content[5].Value, root.Content[3].Value
+			},
+			wantErr: "2:9: unable to decrypt value",
+		},
+		"detects changed kinds": {
+			tamper: func(root *yaml.Node) { root.Content[9].Kind, root.Content[9].Tag = yaml.SequenceNode, "!!seq" },
+			is:     ErrIntegrity,
+		},
+		"detects reordered entries": {
+			tamper: func(root *yaml.Node) {
+				root.Content[0], root.Content[1], root.Content[6], root.Content[7] = root.Content[6], root.Content[7], root.Content[0], root.Content[1]
+			},
+			is: ErrIntegrity,
+		},
+		"detects malformed values": {
+			tamper:  func(root *yaml.Node) { root.Content[3].Value = "ENC[AES_GCM,data:???]" },
+			wantErr: "malformed encrypted value",
+		},
+		"detects wrong keys": {
+			key:     StaticKey("fedcba9876543210"),
+			wantErr: "unable to decrypt value",
+		},
+		"reports key provider errors": {
+			key:     failingKeyProvider{},
+			wantErr: "unable to retrieve data key: key unavailable",
+		},
+		"reports missing metadata": {
+			tamper: func(root *yaml.Node) { root.Content = root.Content[:len(root.Content)-2] },
+			is:     ErrNotEncrypted,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc := encrypt(t, "plain: value\nsecret: hunter2\nother: value\nlist: [a, b]\nempty: {}")
+			root := doc.Content[0]
+			before, _ := yaml.Marshal(doc)
+			if tt.tamper != nil {
+				tt.tamper(root)
+				before, _ = yaml.Marshal(doc)
+			}
+			provider := tt.key
+			if provider == nil {
+				provider = key
+			}
+
+			err := DecryptDocument(context.TODO(), doc, provider)
+			if tt.is != nil {
+				assert.ErrorIs(t, err, tt.is)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+
+			after, _ := yaml.Marshal(doc)
+			assert.Equal(t, string(before), string(after), "failed decryption shouldn't modify the document")
+		})
+	}
+}
+
+func TestEncryptDocument_invalid(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		key     KeyProvider
+		wantErr string
+	}{
+		"requires a root mapping":   {input: "- a", key: StaticKey("0123456789abcdef"), wantErr: "requires a document with a root mapping"},
+		"requires a valid key":      {input: "a: b", key: StaticKey("short"), wantErr: "invalid key size"},
+		"rejects tagged values":     {input: "a: !encrypted b", key: StaticKey("0123456789abcdef"), wantErr: "1:4: value is already tagged !encrypted"},
+		"rejects metadata keys":     {input: "a: b\nyay: c", key: StaticKey("0123456789abcdef"), wantErr: `2:1: the encryption metadata key "yay" is already defined`},
+		"rejects metadata mappings": {input: "yay: {a: b}", key: StaticKey("0123456789abcdef"), wantErr: `1:1: the encryption metadata key "yay" is already defined`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc := &yaml.Node{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), doc))
+			err := EncryptDocument(context.TODO(), doc, tt.key)
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.False(t, strings.Contains(tt.input, "ENC["))
+		})
+	}
+}
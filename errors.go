@@ -0,0 +1,47 @@
+package yay
+
+import (
+	"fmt"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// NodeError is an error associated with the position of a node within a document
+type NodeError struct {
+	Node *yaml.Node
+	Err  error
+}
+
+// Error formats the error prefixed with the line and column of the node, e.g. 3:7: required variable is not set
+func (e *NodeError) Error() string {
+	if e.Node == nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Node.Line, e.Node.Column, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// NodeErrors flattens err, which may be joined or wrapped, returning each NodeError in the order it occurred
+func NodeErrors(err error) []*NodeError {
+	result := make([]*NodeError, 0)
+	var collect func(err error)
+	collect = func(err error) {
+		switch e := err.(type) {
+		case nil:
+		case *NodeError:
+			result = append(result, e)
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				collect(inner)
+			}
+		case interface{ Unwrap() error }:
+			collect(e.Unwrap())
+		}
+	}
+	collect(err)
+	return result
+}
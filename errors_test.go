@@ -0,0 +1,44 @@
+package yay
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestNodeError(t *testing.T) {
+	inner := errors.New("failure")
+	err := &NodeError{Node: &yaml.Node{Line: 3, Column: 7}, Err: inner}
+	assert.Equal(t, "3:7: failure", err.Error())
+	assert.ErrorIs(t, err, inner)
+
+	assert.Equal(t, "failure", (&NodeError{Err: inner}).Error())
+}
+
+func TestNodeErrors(t *testing.T) {
+	first := &NodeError{Node: &yaml.Node{Line: 1, Column: 1}, Err: errors.New("first")}
+	second := &NodeError{Node: &yaml.Node{Line: 2, Column: 1}, Err: errors.New("second")}
+	third := &NodeError{Node: &yaml.Node{Line: 3, Column: 1}, Err: errors.New("third")}
+
+	tests := map[string]struct {
+		err  error
+		want []*NodeError
+	}{
+		"nil":       {err: nil, want: []*NodeError{}},
+		"unrelated": {err: errors.New("other"), want: []*NodeError{}},
+		"single":    {err: first, want: []*NodeError{first}},
+		"wrapped":   {err: fmt.Errorf("context: %w", first), want: []*NodeError{first}},
+		"joined": {
+			err:  errors.Join(first, errors.New("other"), errors.Join(second, fmt.Errorf("wrapped: %w", third))),
+			want: []*NodeError{first, second, third},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NodeErrors(tt.err))
+		})
+	}
+}
@@ -0,0 +1,460 @@
+package yay
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// IndexFormat determines how sequence indexes are written within flattened paths
+type IndexFormat int
+
+const (
+	// IndexBrackets writes indexes in brackets, e.g. a.b[0].c
+	IndexBrackets IndexFormat = iota
+	// IndexSegments writes indexes as path segments, e.g. a.b.0.c. Keys consisting only of digits are escaped.
+	IndexSegments
+)
+
+// FlatPair is a scalar value and its flattened path, such as a.b[0].c=value
+type FlatPair struct {
+	Path  string
+	Value string
+	// Node is the scalar from which the pair was flattened, providing its position and tag. Unflatten uses the tag
+	// and style of Node when present.
+	Node *yaml.Node
+}
+
+type flattenOptions struct {
+	separator   string
+	escape      rune
+	indexFormat IndexFormat
+}
+
+// FlattenOpt is an option for Flatten and Unflatten
+type FlattenOpt func(o *flattenOptions)
+
+// WithSeparator changes the separator between path segments, which defaults to "."
+func WithSeparator(separator string) FlattenOpt {
+	return func(o *flattenOptions) {
+		o.separator = separator
+	}
+}
+
+// WithIndexFormat changes how sequence indexes are written, which defaults to IndexBrackets
+func WithIndexFormat(format IndexFormat) FlattenOpt {
+	return func(o *flattenOptions) {
+		o.indexFormat = format
+	}
+}
+
+// WithEscape changes the character escaping separators, brackets, and itself within keys, which defaults to a backslash
+func WithEscape(escape rune) FlattenOpt {
+	return func(o *flattenOptions) {
+		o.escape = escape
+	}
+}
+
+func flattenOptionsOf(opts []FlattenOpt) (flattenOptions, error) {
+	o := flattenOptions{separator: ".", escape: '\\'}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.separator == "" {
+		return o, errors.New("separator must not be empty")
+	}
+	if strings.ContainsRune(o.separator, o.escape) {
+		return o, fmt.Errorf("separator %q must not contain the escape character %q", o.separator, o.escape)
+	}
+	return o, nil
+}
+
+// Flatten converts node to a list of path/value pairs, one per scalar, in document order. For example:
+//
+//	a:
+//	  b:
+//	    - c: value
+//
+// flattens to a.b[0].c=value. Aliases and merge keys are resolved, null values flatten to an empty string, and empty
+// mappings and sequences are omitted. Keys containing the separator or brackets are escaped, e.g. a\.b for the key
+// "a.b". Keys which aren't scalars are reported as a NodeError.
+func Flatten(node *yaml.Node, opts ...FlattenOpt) ([]FlatPair, error) {
+	o, err := flattenOptionsOf(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([]FlatPair, 0)
+	active := make(map[*yaml.Node]struct{})
+	var walk func(path string, node *yaml.Node) error
+	walk = func(path string, node *yaml.Node) error {
+		resolved := resolveAlias(node)
+		if resolved == nil {
+			return nil
+		}
+		if _, ok := active[resolved]; ok {
+			return &NodeError{Node: node, Err: fmt.Errorf("recursive alias %q", node.Value)}
+		}
+		active[resolved] = struct{}{}
+		defer delete(active, resolved)
+
+		var err error
+		switch resolved.Kind {
+		case yaml.DocumentNode:
+			for _, child := range resolved.Content {
+				err = errors.Join(err, walk(path, child))
+			}
+		case yaml.SequenceNode:
+			for i, child := range resolved.Content {
+				err = errors.Join(err, walk(o.joinIndex(path, i), child))
+			}
+		case yaml.MappingNode:
+			for _, e := range mergedEntries(resolved) {
+				key := resolveAlias(e.key)
+				if key == nil || key.Kind != yaml.ScalarNode {
+					err = errors.Join(err, &NodeError{Node: e.key, Err: errors.New("unable to flatten a key which isn't a scalar")})
+					continue
+				}
+				err = errors.Join(err, walk(o.joinKey(path, key.Value), e.value))
+			}
+		case yaml.ScalarNode:
+			value := resolved.Value
+			if resolved.ShortTag() == "!!null" {
+				value = ""
+			}
+			pairs = append(pairs, FlatPair{Path: path, Value: value, Node: resolved})
+		}
+		return err
+	}
+	if err := walk("", node); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+func (o flattenOptions) joinKey(path string, key string) string {
+	escaped := o.escapeKey(key)
+	if path == "" {
+		return escaped
+	}
+	return path + o.separator + escaped
+}
+
+func (o flattenOptions) joinIndex(path string, index int) string {
+	if o.indexFormat == IndexSegments {
+		if path == "" {
+			return strconv.Itoa(index)
+		}
+		return path + o.separator + strconv.Itoa(index)
+	}
+	return path + "[" + strconv.Itoa(index) + "]"
+}
+
+func (o flattenOptions) escapeKey(key string) string {
+	var b strings.Builder
+	if o.indexFormat == IndexSegments && isDigits(key) {
+		// distinguishes the key from an index
+		b.WriteRune(o.escape)
+	}
+	for i := 0; i < len(key); {
+		switch {
+		case strings.HasPrefix(key[i:], o.separator):
+			b.WriteRune(o.escape)
+			b.WriteString(o.separator)
+			i += len(o.separator)
+			continue
+		case key[i] == '[' || key[i] == ']' || strings.HasPrefix(key[i:], string(o.escape)):
+			b.WriteRune(o.escape)
+		}
+		r, size := utf8.DecodeRuneInString(key[i:])
+		b.WriteRune(r)
+		i += size
+	}
+	return b.String()
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// pathSegment is a key or an index of a flattened path
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// split parses a flattened path into its segments
+func (o flattenOptions) split(path string) ([]pathSegment, error) {
+	segments := make([]pathSegment, 0)
+	if path == "" {
+		return segments, nil
+	}
+
+	var current strings.Builder
+	escaped := false
+	pending := true
+	endKey := func() {
+		if !pending {
+			return
+		}
+		key := current.String()
+		if o.indexFormat == IndexSegments && !escaped && isDigits(key) {
+			i, _ := strconv.Atoi(key)
+			segments = append(segments, pathSegment{index: i, isIndex: true})
+		} else {
+			segments = append(segments, pathSegment{key: key})
+		}
+		current.Reset()
+		escaped = false
+		pending = false
+	}
+
+	for i := 0; i < len(path); {
+		r, size := utf8.DecodeRuneInString(path[i:])
+		switch {
+		case r == o.escape:
+			if i+size >= len(path) {
+				return nil, fmt.Errorf("path %q ends with an escape character", path)
+			}
+			next, nextSize := utf8.DecodeRuneInString(path[i+size:])
+			if strings.HasPrefix(path[i+size:], o.separator) {
+				current.WriteString(o.separator)
+				nextSize = len(o.separator)
+			} else {
+				current.WriteRune(next)
+			}
+			escaped = true
+			pending = true
+			i += size + nextSize
+		case strings.HasPrefix(path[i:], o.separator):
+			endKey()
+			pending = true
+			i += len(o.separator)
+		case r == '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q has an unterminated index", path)
+			}
+			index, err := strconv.Atoi(path[i+1 : i+end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %q has an invalid index %q", path, path[i+1:i+end])
+			}
+			if current.Len() > 0 || escaped {
+				endKey()
+			}
+			pending = false
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+			i += end + 1
+		default:
+			current.WriteRune(r)
+			pending = true
+			i += size
+		}
+	}
+	endKey()
+	return segments, nil
+}
+
+// Unflatten rebuilds a document from path/value pairs, such as those returned by Flatten, using the same options.
+// Values are resolved as plain scalars, unless the pair's Node provides a tag and style. Sequence indexes must be
+// introduced in order, and a path may not be both a scalar and a collection.
+func Unflatten(pairs []FlatPair, opts ...FlattenOpt) (*yaml.Node, error) {
+	o, err := flattenOptionsOf(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	for _, pair := range pairs {
+		segments, err := o.split(pair.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		scalar := &yaml.Node{Kind: yaml.ScalarNode, Value: pair.Value}
+		if pair.Node != nil && pair.Node.Kind == yaml.ScalarNode {
+			scalar.Tag = pair.Node.Tag
+			scalar.Style = pair.Node.Style
+		}
+
+		parent, slot := doc, -1
+		for i, segment := range segments {
+			kind := yaml.MappingNode
+			if segment.isIndex {
+				kind = yaml.SequenceNode
+			}
+			container, err := unflattenContainer(parent, slot, kind, pair.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			last := i == len(segments)-1
+			if segment.isIndex {
+				switch {
+				case segment.index == len(container.Content):
+					container.Content = append(container.Content, nil)
+				case segment.index > len(container.Content):
+					return nil, fmt.Errorf("path %q: index %d is out of order, expected at most %d", pair.Path, segment.index, len(container.Content))
+				}
+				parent, slot = container, segment.index
+			} else {
+				slot = -1
+				for j := 0; j+1 < len(container.Content); j += 2 {
+					if container.Content[j].Value == segment.key {
+						slot = j + 1
+						break
+					}
+				}
+				if slot < 0 {
+					container.Content = append(container.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: segment.key}, nil)
+					slot = len(container.Content) - 1
+				}
+				parent = container
+			}
+			if last && parent.Content[slot] != nil {
+				return nil, fmt.Errorf("path %q is defined more than once", pair.Path)
+			}
+		}
+
+		if slot < 0 {
+			// the root scalar
+			if len(doc.Content) > 0 {
+				return nil, fmt.Errorf("path %q is defined more than once", pair.Path)
+			}
+			doc.Content = append(doc.Content, scalar)
+			continue
+		}
+		parent.Content[slot] = scalar
+	}
+	return doc, nil
+}
+
+// unflattenContainer returns the collection at parent.Content[slot] (or the root of the document when slot is -1),
+// creating it when absent
+func unflattenContainer(parent *yaml.Node, slot int, kind yaml.Kind, path string) (*yaml.Node, error) {
+	var existing *yaml.Node
+	if slot < 0 {
+		if len(parent.Content) > 0 {
+			existing = parent.Content[0]
+		}
+	} else {
+		existing = parent.Content[slot]
+	}
+
+	if existing == nil {
+		created := &yaml.Node{Kind: kind}
+		if slot < 0 {
+			parent.Content = append(parent.Content, created)
+		} else {
+			parent.Content[slot] = created
+		}
+		return created, nil
+	}
+	if existing.Kind != kind {
+		return nil, fmt.Errorf("path %q conflicts with a previously defined value", path)
+	}
+	return existing, nil
+}
+
+// WriteProperties writes pairs in the Java .properties format, escaping keys and values as necessary
+func WriteProperties(w io.Writer, pairs []FlatPair) error {
+	bw := bufio.NewWriter(w)
+	for _, pair := range pairs {
+		bw.WriteString(escapeProperty(pair.Path, true))
+		bw.WriteByte('=')
+		bw.WriteString(escapeProperty(pair.Value, false))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == ' ' && (key || i == 0):
+			b.WriteString(`\ `)
+		case (r == '=' || r == ':') && key, (r == '#' || r == '!') && i == 0:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			if r > 0xffff {
+				r1, r2 := utf16.EncodeRune(r)
+				fmt.Fprintf(&b, `\u%04x\u%04x`, r1, r2)
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// WriteEnv writes pairs in the .env format. Paths are converted to variable names by upper-casing them and replacing
+// any character other than a letter, digit, or underscore with an underscore, dropping the closing brackets of indexes,
+// so a.b[0] becomes A_B_0. Values containing whitespace or special characters are double-quoted.
+func WriteEnv(w io.Writer, pairs []FlatPair) error {
+	bw := bufio.NewWriter(w)
+	for _, pair := range pairs {
+		bw.WriteString(envName(pair.Path))
+		bw.WriteByte('=')
+		bw.WriteString(envValue(pair.Value))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+func envName(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'):
+			b.WriteRune(unicode.ToUpper(r))
+		case r == ']':
+			// a.b[0].c becomes A_B_0_C rather than A_B_0__C
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := b.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+func envValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\r\n\"'\\$#`=") {
+		return value
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(value) + `"`
+}
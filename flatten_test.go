@@ -0,0 +1,198 @@
+package yay
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func describePairs(pairs []FlatPair) []string {
+	result := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		result = append(result, pair.Path+"="+pair.Value)
+	}
+	return result
+}
+
+func TestFlatten(t *testing.T) {
+	input := trimmed(`server:
+		|  host: localhost
+		|  ports: [80, 443]
+		|  "a.b": dotted
+		|  "8080": numeric
+		|base: &base {x: 1}
+		|merged:
+		|  <<: *base
+		|  y: ~
+		|list:
+		|  - name: first
+		|  - [nested]`)
+
+	tests := map[string]struct {
+		opts     []FlattenOpt
+		expected []string
+	}{
+		"flattens with dots and brackets": {
+			expected: []string{
+				"server.host=localhost",
+				"server.ports[0]=80",
+				"server.ports[1]=443",
+				`server.a\.b=dotted`,
+				"server.8080=numeric",
+				"base.x=1",
+				"merged.x=1",
+				"merged.y=",
+				"list[0].name=first",
+				"list[1][0]=nested",
+			},
+		},
+		"supports separators and index segments": {
+			opts: []FlattenOpt{WithSeparator("__"), WithIndexFormat(IndexSegments)},
+			expected: []string{
+				"server__host=localhost",
+				"server__ports__0=80",
+				"server__ports__1=443",
+				"server__a.b=dotted",
+				`server__\8080=numeric`,
+				"base__x=1",
+				"merged__x=1",
+				"merged__y=",
+				"list__0__name=first",
+				"list__1__0=nested",
+			},
+		},
+		"supports escape characters": {
+			opts: []FlattenOpt{WithEscape('^')},
+			expected: []string{
+				"server.host=localhost",
+				"server.ports[0]=80",
+				"server.ports[1]=443",
+				"server.a^.b=dotted",
+				"server.8080=numeric",
+				"base.x=1",
+				"merged.x=1",
+				"merged.y=",
+				"list[0].name=first",
+				"list[1][0]=nested",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+
+			pairs, err := Flatten(&doc, tt.opts...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, describePairs(pairs))
+			assert.Equal(t, 2, pairs[0].Node.Line, "pairs provide the position of their scalar")
+
+			// round trip, which resolves merge keys
+			rebuilt, err := Unflatten(pairs, tt.opts...)
+			assert.NoError(t, err)
+			again, err := Flatten(rebuilt, tt.opts...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, describePairs(again))
+		})
+	}
+}
+
+func TestFlatten_errors(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("a:\n  [complex]: key"), &doc))
+	_, err := Flatten(&doc)
+	assert.EqualError(t, err, "2:3: unable to flatten a key which isn't a scalar")
+
+	_, err = Flatten(&doc, WithSeparator(""))
+	assert.Error(t, err)
+}
+
+func TestUnflatten(t *testing.T) {
+	tests := map[string]struct {
+		pairs    []FlatPair
+		expected string
+		err      string
+	}{
+		"rebuilds nested documents": {
+			pairs: []FlatPair{
+				{Path: "a.b[0].c", Value: "1"},
+				{Path: "a.b[0].d", Value: "text"},
+				{Path: "a.b[1]", Value: "true"},
+				{Path: `a.e\.f`, Value: "dotted"},
+			},
+			expected: trimmed(`a:
+				|    b:
+				|        - c: 1
+				|          d: text
+				|        - true
+				|    e.f: dotted`),
+		},
+		"retains tags of source nodes": {
+			pairs:    []FlatPair{{Path: "a", Value: "1", Node: &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: yaml.SingleQuotedStyle}}},
+			expected: "a: '1'\n",
+		},
+		"rebuilds root scalars": {
+			pairs:    []FlatPair{{Path: "", Value: "text"}},
+			expected: "text\n",
+		},
+		"rejects indexes out of order": {
+			pairs: []FlatPair{{Path: "a[1]", Value: "x"}},
+			err:   `path "a[1]": index 1 is out of order, expected at most 0`,
+		},
+		"rejects conflicting paths": {
+			pairs: []FlatPair{{Path: "a", Value: "x"}, {Path: "a.b", Value: "y"}},
+			err:   `path "a.b" conflicts with a previously defined value`,
+		},
+		"rejects duplicate paths": {
+			pairs: []FlatPair{{Path: "a.b", Value: "x"}, {Path: "a.b", Value: "y"}},
+			err:   `path "a.b" is defined more than once`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc, err := Unflatten(tt.pairs)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			out, err := yaml.Marshal(doc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(out))
+		})
+	}
+}
+
+func TestWriteProperties(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteProperties(&buf, []FlatPair{
+		{Path: "a.b[0]", Value: "value"},
+		{Path: "key with=spaces", Value: " leading"},
+		{Path: "multi", Value: "line\nbreak"},
+		{Path: "unicode", Value: "café"},
+		{Path: "comment", Value: "#not"},
+	}))
+	assert.Equal(t, trimmed(`a.b[0]=value
+		|key\ with\=spaces=\ leading
+		|multi=line\nbreak
+		|unicode=caf\u00e9
+		|comment=\#not`), buf.String())
+}
+
+func TestWriteEnv(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteEnv(&buf, []FlatPair{
+		{Path: "server.host", Value: "localhost"},
+		{Path: "server.ports[0]", Value: "80"},
+		{Path: "list[0].name", Value: "with space"},
+		{Path: "0.leading", Value: `quote " and $HOME`},
+		{Path: "empty", Value: ""},
+	}))
+	assert.Equal(t, trimmed(`SERVER_HOST=localhost
+		|SERVER_PORTS_0=80
+		|LIST_0_NAME="with space"
+		|_0_LEADING="quote \" and \$HOME"
+		|EMPTY=""`), buf.String())
+}
@@ -0,0 +1,208 @@
+package yay
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// yamlpathReserved are characters which can't be used in a yamlpath dotted child name, requiring bracket notation
+const yamlpathReserved = " ()[]&|=!<>~\\'\"?@$,*."
+
+// Glob creates a Condition which matches nodes selected by a simplified, dotted glob expression, such as
+// spec.template.spec.containers.*.image. The glob syntax supports:
+//
+//   - dotted mapping keys, e.g. metadata.name
+//   - quoted mapping keys, which may contain dots or other reserved characters, e.g. metadata.annotations."example.com/owner"
+//   - * to match any single mapping value or sequence item, e.g. items.*.name
+//   - ** to match at any depth, e.g. **.image; a trailing ** matches all descendants
+//   - [n] to match a sequence item by index, which may be negative, e.g. containers[0].image or [-1]
+//
+// Globs are compiled to the equivalent [yamlpath] expression (see GlobToPath), so evaluation is identical to Selector.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func Glob(expr string) Condition {
+	path, err := GlobToPath(expr)
+	if err != nil {
+		return Condition{
+			expr: expr,
+			compile: func() fnMatchCondition {
+				return func(ctx context.Context, node *yaml.Node) (*PathMatcher, bool, error) {
+					return nil, false, err
+				}
+			},
+			validate: func() error {
+				return err
+			},
+		}
+	}
+	selector := Selector(path)
+	return Condition{expr: expr, compile: selector.compile, validate: selector.validate}
+}
+
+// GlobToPath converts a glob expression (see Glob) to the equivalent [yamlpath] expression.
+// For example, spec.containers.*.image converts to $.spec.containers[*].image.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func GlobToPath(glob string) (string, error) {
+	if strings.TrimSpace(glob) == "" {
+		return "", fmt.Errorf("invalid glob %q: expression is empty", glob)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("$")
+	descend := false
+	rest := glob
+	for first := true; len(rest) > 0; first = false {
+		// elements are separated by dots, although an index may directly follow the previous element, e.g. containers[0]
+		if !first && !strings.HasPrefix(rest, "[") {
+			if !strings.HasPrefix(rest, ".") || len(rest) == 1 {
+				return "", fmt.Errorf("invalid glob %q: expected '.' or '[' at offset %d", glob, len(glob)-len(rest))
+			}
+			rest = rest[1:]
+		}
+
+		var element string
+		switch {
+		case strings.HasPrefix(rest, "**"):
+			rest = rest[2:]
+			descend = true
+			if rest == "" {
+				// a trailing ** selects all descendants
+				sb.WriteString("..*")
+				descend = false
+			}
+			continue
+		case strings.HasPrefix(rest, "*"):
+			rest = rest[1:]
+			element = "*"
+			if !descend {
+				element = "[*]"
+			}
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return "", fmt.Errorf("invalid glob %q: unterminated index", glob)
+			}
+			index := strings.TrimSpace(rest[1:end])
+			if index == "*" {
+				element = "[*]"
+			} else if _, err := strconv.Atoi(index); err != nil {
+				return "", fmt.Errorf("invalid glob %q: index %q is not an integer", glob, index)
+			} else {
+				element = "[" + index + "]"
+			}
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, "'"):
+			end := strings.IndexByte(rest[1:], rest[0])
+			if end < 0 {
+				return "", fmt.Errorf("invalid glob %q: unterminated quoted key", glob)
+			}
+			name := rest[1 : end+1]
+			rest = rest[end+2:]
+			quoted, err := quotedChild(name)
+			if err != nil {
+				return "", fmt.Errorf("invalid glob %q: %w", glob, err)
+			}
+			element = quoted
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			if name == "" || strings.ContainsAny(name, `*'"]`) {
+				return "", fmt.Errorf("invalid glob %q: invalid key %q", glob, name)
+			}
+			if strings.ContainsAny(name, yamlpathReserved) {
+				quoted, err := quotedChild(name)
+				if err != nil {
+					return "", fmt.Errorf("invalid glob %q: %w", glob, err)
+				}
+				element = quoted
+			} else {
+				element = "." + name
+			}
+		}
+
+		if descend {
+			// yamlpath's recursive descent is followed directly by a name or bracket, e.g. $..name or $..[0]
+			sb.WriteString("..")
+			element = strings.TrimPrefix(element, ".")
+			descend = false
+		}
+		sb.WriteString(element)
+	}
+
+	return sb.String(), nil
+}
+
+// PathToGlob converts a [yamlpath] expression to the equivalent glob expression (see Glob), for display.
+// Expressions which can't be represented as a glob, such as filters, slices, or unions, result in an error.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func PathToGlob(path string) (string, error) {
+	compiled, err := compilePath(path)
+	if err != nil {
+		return "", fmt.Errorf("path %q can't be represented as a glob", path)
+	}
+
+	elements := make([]string, 0, len(compiled.segments))
+	for i := 0; i < len(compiled.segments); i++ {
+		seg := compiled.segments[i]
+		switch seg.kind {
+		case segmentDescendants:
+			if i+1 < len(compiled.segments) && compiled.segments[i+1].kind == segmentWildcard {
+				i++
+			}
+			elements = append(elements, "**")
+		case segmentWildcard:
+			elements = append(elements, "*")
+		case segmentChild:
+			if len(seg.names) != 1 {
+				return "", fmt.Errorf("path %q can't be represented as a glob: union of keys", path)
+			}
+			name := seg.names[0]
+			if name == "" || name == "**" || strings.ContainsAny(name, yamlpathReserved) {
+				if strings.Contains(name, `"`) {
+					name = "'" + name + "'"
+				} else {
+					name = `"` + name + `"`
+				}
+			}
+			elements = append(elements, name)
+		case segmentIndex:
+			if _, err := strconv.Atoi(strings.TrimSpace(seg.subscript)); err != nil {
+				return "", fmt.Errorf("path %q can't be represented as a glob: slice or union of indexes", path)
+			}
+			index := "[" + strings.TrimSpace(seg.subscript) + "]"
+			if n := len(elements); n > 0 {
+				elements[n-1] += index
+			} else {
+				elements = append(elements, index)
+			}
+		default:
+			return "", fmt.Errorf("path %q can't be represented as a glob: filters aren't supported", path)
+		}
+	}
+
+	if len(elements) == 0 {
+		return "", fmt.Errorf("path %q can't be represented as a glob: the root node has no glob equivalent", path)
+	}
+	return strings.Join(elements, "."), nil
+}
+
+// quotedChild returns the yamlpath bracket notation for a mapping key, e.g. ['a.b']
+func quotedChild(name string) (string, error) {
+	switch {
+	case !strings.Contains(name, "'"):
+		return "['" + name + "']", nil
+	case !strings.Contains(name, `"`):
+		return `["` + name + `"]`, nil
+	}
+	return "", fmt.Errorf("key %q can't contain both single and double quotes", name)
+}
@@ -0,0 +1,147 @@
+package yay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestGlobToPath(t *testing.T) {
+	tests := map[string]struct {
+		glob    string
+		want    string
+		wantErr bool
+	}{
+		"dotted keys":             {glob: "spec.template.spec", want: "$.spec.template.spec"},
+		"wildcard":                {glob: "spec.containers.*.image", want: "$.spec.containers[*].image"},
+		"leading wildcard":        {glob: "*.name", want: "$[*].name"},
+		"descendants":             {glob: "**.image", want: "$..image"},
+		"nested descendants":      {glob: "spec.**.image", want: "$.spec..image"},
+		"repeated descendants":    {glob: "spec.**.**.image", want: "$.spec..image"},
+		"trailing descendants":    {glob: "spec.**", want: "$.spec..*"},
+		"descendant wildcard":     {glob: "spec.**.*", want: "$.spec..*"},
+		"index":                   {glob: "spec.containers[0].image", want: "$.spec.containers[0].image"},
+		"negative index":          {glob: "items[-1]", want: "$.items[-1]"},
+		"leading index":           {glob: "[1].name", want: "$[1].name"},
+		"wildcard index":          {glob: "items[*].name", want: "$.items[*].name"},
+		"descendant index":        {glob: "**[0]", want: "$..[0]"},
+		"double quoted key":       {glob: `metadata.annotations."example.com/owner"`, want: `$.metadata.annotations['example.com/owner']`},
+		"single quoted key":       {glob: `a.'b.c'.d`, want: `$.a['b.c'].d`},
+		"key with quote":          {glob: `a."it's"`, want: `$.a["it's"]`},
+		"descendant quoted key":   {glob: `**."a.b"`, want: `$..['a.b']`},
+		"reserved characters":     {glob: "a.b@c", want: "$.a['b@c']"},
+		"empty":                   {glob: "", wantErr: true},
+		"empty key":               {glob: "a..b", wantErr: true},
+		"trailing dot":            {glob: "a.", wantErr: true},
+		"leading dot":             {glob: ".a", wantErr: true},
+		"unterminated index":      {glob: "a[0", wantErr: true},
+		"non-integer index":       {glob: "a[x]", wantErr: true},
+		"unterminated quote":      {glob: `a."b`, wantErr: true},
+		"partial wildcard":        {glob: "a.b*", wantErr: true},
+		"missing separator":       {glob: `a."b"c`, wantErr: true},
+		"mixed quotes within key": {glob: `a."it's \"x\""`, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GlobToPath(tt.glob)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPathToGlob(t *testing.T) {
+	tests := map[string]struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		"dotted keys":       {path: "$.spec.template.spec", want: "spec.template.spec"},
+		"wildcard":          {path: "$.spec.containers[*].image", want: "spec.containers.*.image"},
+		"dotted wildcard":   {path: "$.spec.*", want: "spec.*"},
+		"descendants":       {path: "$..image", want: "**.image"},
+		"all descendants":   {path: "$.spec..*", want: "spec.**"},
+		"index":             {path: "$.spec.containers[0].image", want: "spec.containers[0].image"},
+		"leading index":     {path: "$[1].name", want: "[1].name"},
+		"quoted key":        {path: "$.metadata.annotations['example.com/owner']", want: `metadata.annotations."example.com/owner"`},
+		"key with quote":    {path: `$.a["say \"hi\""]`, wantErr: true},
+		"root":              {path: "$", wantErr: true},
+		"filter":            {path: "$.items[?(@.name == 'a')]", wantErr: true},
+		"slice":             {path: "$.items[0:2]", wantErr: true},
+		"union of keys":     {path: "$['a','b']", wantErr: true},
+		"property names":    {path: "$.a.*~", wantErr: true},
+		"invalid yamlpath":  {path: "$.a[", wantErr: true},
+		"implicit root key": {path: "a.b", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := PathToGlob(tt.path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			// conversions are expected to round-trip
+			path, err := GlobToPath(got)
+			assert.NoError(t, err)
+			glob, err := PathToGlob(path)
+			assert.NoError(t, err)
+			assert.Equal(t, got, glob)
+		})
+	}
+}
+
+func TestGlob(t *testing.T) {
+	input := trimmed(`---
+		|spec:
+		|  containers:
+		|  - name: app
+		|    image: app:latest
+		|  - name: sidecar
+		|    image: proxy:1.0
+		|  volumes:
+		|  - name: data`)
+
+	tests := map[string]struct {
+		condition Condition
+		want      []string
+		wantErr   bool
+	}{
+		"wildcard":    {condition: Glob("spec.containers.*.image"), want: []string{"app:latest", "proxy:1.0"}},
+		"descendants": {condition: Glob("**.name"), want: []string{"app", "sidecar", "data"}},
+		"index":       {condition: Glob("spec.containers[-1].name"), want: []string{"sidecar"}},
+		"combined":    {condition: All(Glob("**.name"), Not(Glob("spec.volumes.**"))), want: []string{"app", "sidecar"}},
+		"invalid":     {condition: Glob("spec..name"), wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			processed := make([]string, 0)
+			handler, err := NewConditionalHandler(OnVisitScalarNodeIf(tt.condition,
+				func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+					processed = append(processed, value.Value)
+					return nil
+				}))
+			if tt.wantErr {
+				// invalid conditions are reported before the document is visited
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			doc := &yaml.Node{}
+			assert.NoError(t, yaml.Unmarshal([]byte(input), doc))
+			v, err := NewVisitor(handler)
+			assert.NoError(t, err)
+			assert.NoError(t, v.Visit(context.TODO(), doc))
+			assert.Equal(t, tt.want, processed)
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vmware-labs/yaml-jsonpath/pkg/yamlpath"
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	_ VisitsDocumentNode = (*IncludeHandler)(nil)
+	_ VisitsMappingNode  = (*IncludeHandler)(nil)
+	_ VisitsScalarNode   = (*IncludeHandler)(nil)
+)
+
+// ErrIncludeCycle is returned by IncludeHandler when a file directly or indirectly includes itself
+var ErrIncludeCycle = errors.New("include cycle detected")
+
+type includeStackKey struct{}
+
+// IncludeOpt is an option for NewIncludeHandler
+type IncludeOpt func(handler *IncludeHandler)
+
+// WithIncludeTag changes the tag of scalars resolved as file inclusions, which defaults to !include
+func WithIncludeTag(tag string) IncludeOpt {
+	return func(handler *IncludeHandler) {
+		handler.tag = shortTag(tag)
+	}
+}
+
+// WithRefKey changes the key of mappings resolved as references, which defaults to $ref
+func WithRefKey(key string) IncludeOpt {
+	return func(handler *IncludeHandler) {
+		handler.refKey = key
+	}
+}
+
+// WithIncludeSource sets the name of the visited file within the handler's fs.FS.
+// Relative inclusions within the visited document are resolved from the directory of this file, and local
+// references such as #/definitions/name refer to this file. By default, inclusions are resolved from the root of the fs.FS.
+func WithIncludeSource(name string) IncludeOpt {
+	return func(handler *IncludeHandler) {
+		handler.source = name
+	}
+}
+
+// IncludeHandler resolves file inclusions by splicing the referenced node in place of the including node.
+// See NewIncludeHandler for more information.
+type IncludeHandler struct {
+	fsys   fs.FS
+	tag    string
+	refKey string
+	source string
+
+	mu      *sync.Mutex
+	sources map[*yaml.Node]string
+}
+
+// VisitDocumentNode resolves a document whose root node is itself an inclusion, as the visitor doesn't visit a document's root node.
+func (h *IncludeHandler) VisitDocumentNode(ctx context.Context, key *yaml.Node) error {
+	if len(key.Content) == 0 {
+		return nil
+	}
+	return h.resolve(ctx, key.Content[0])
+}
+
+// VisitMappingNode resolves mappings containing a reference key, such as {$ref: other.yaml#/definitions/name}.
+// Any other keys within the mapping are discarded, following the semantics of JSON Reference.
+func (h *IncludeHandler) VisitMappingNode(ctx context.Context, _ *yaml.Node, value *yaml.Node) error {
+	return h.resolve(ctx, value)
+}
+
+// VisitScalarNode resolves tagged scalars, such as !include other.yaml
+func (h *IncludeHandler) VisitScalarNode(ctx context.Context, _ *yaml.Node, value *yaml.Node) error {
+	return h.resolve(ctx, value)
+}
+
+// SourceOf returns the name of the file from which node was spliced, if node was included by this handler.
+// Nodes spliced from nested inclusions report the most deeply nested file.
+func (h *IncludeHandler) SourceOf(node *yaml.Node) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	source, ok := h.sources[node]
+	return source, ok
+}
+
+// reference returns the target of node if it's an inclusion or reference
+func (h *IncludeHandler) reference(node *yaml.Node) (string, bool) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag != "" && node.ShortTag() == h.tag {
+			return node.Value, true
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == h.refKey && node.Content[i+1].Kind == yaml.ScalarNode {
+				return node.Content[i+1].Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (h *IncludeHandler) resolve(ctx context.Context, node *yaml.Node) error {
+	target, ok := h.reference(node)
+	if !ok {
+		return nil
+	}
+
+	file, fragment, _ := strings.Cut(target, "#")
+	local := file == ""
+	var doc *yaml.Node
+	if local {
+		// a local reference, e.g. #/definitions/name
+		root, ok := rootNode(ctx)
+		if !ok {
+			return &NodeError{Node: node, Err: fmt.Errorf("unable to resolve %q: no document root", target)}
+		}
+		doc = root
+	} else {
+		file = h.resolvePath(file)
+		stack, ok := ctx.Value(includeStackKey{}).([]string)
+		if !ok && h.source != "" {
+			stack = []string{path.Clean(h.source)}
+		}
+		for _, included := range stack {
+			if included == file {
+				return &NodeError{Node: node, Err: fmt.Errorf("%w: %s", ErrIncludeCycle, strings.Join(append(stack, file), " -> "))}
+			}
+		}
+
+		var err error
+		doc, err = h.load(context.WithValue(ctx, includeStackKey{}, append(stack[:len(stack):len(stack)], file)), file)
+		if err != nil {
+			return &NodeError{Node: node, Err: fmt.Errorf("unable to include %q: %w", target, err)}
+		}
+	}
+
+	selected, err := selectFragment(doc, fragment)
+	if err != nil {
+		return &NodeError{Node: node, Err: fmt.Errorf("unable to include %q: %w", target, err)}
+	}
+	if local {
+		// the referenced node may itself be a local reference, which is followed regardless of the order nodes are visited
+		chain := []string{target}
+		for {
+			if contains(selected, node) {
+				return &NodeError{Node: node, Err: fmt.Errorf("%w: %s references itself", ErrIncludeCycle, quoteAll(chain))}
+			}
+			next, ok := h.reference(selected)
+			if !ok || !strings.HasPrefix(next, "#") {
+				break
+			}
+			if slices.Contains(chain, next) {
+				return &NodeError{Node: node, Err: fmt.Errorf("%w: %s", ErrIncludeCycle, quoteAll(append(chain, next)))}
+			}
+			chain = append(chain, next)
+			selected, err = selectFragment(doc, next[1:])
+			if err != nil {
+				return &NodeError{Node: node, Err: fmt.Errorf("unable to include %q: %w", next, err)}
+			}
+		}
+
+		// local references are copied, so the referenced node isn't shared between both locations
+		*node = *cloneNode(selected)
+		if _, ok := h.reference(node); ok {
+			// a local reference to an inclusion of another file
+			return h.resolve(ctx, node)
+		}
+		return nil
+	}
+
+	*node = *selected
+	h.record(node, file)
+	return nil
+}
+
+// quoteAll quotes and joins a chain of references, e.g. "#/a" -> "#/b"
+func quoteAll(chain []string) string {
+	quoted := make([]string, 0, len(chain))
+	for _, target := range chain {
+		quoted = append(quoted, strconv.Quote(target))
+	}
+	return strings.Join(quoted, " -> ")
+}
+
+// contains determines whether node is within the subtree of parent, including parent itself
+func contains(parent *yaml.Node, node *yaml.Node) bool {
+	if parent == node {
+		return true
+	}
+	for _, child := range parent.Content {
+		if contains(child, node) {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneNode deeply copies node, retaining aliases to anchors within the copy
+func cloneNode(node *yaml.Node) *yaml.Node {
+	clones := make(map[*yaml.Node]*yaml.Node)
+	var clone func(n *yaml.Node) *yaml.Node
+	clone = func(n *yaml.Node) *yaml.Node {
+		if n == nil {
+			return nil
+		}
+		result := *n
+		clones[n] = &result
+		if n.Content != nil {
+			result.Content = make([]*yaml.Node, len(n.Content))
+			for i, child := range n.Content {
+				result.Content[i] = clone(child)
+			}
+		}
+		return &result
+	}
+	result := clone(node)
+
+	// aliases are remapped once all nodes are cloned, as an alias may be cloned before its anchor
+	for _, c := range clones {
+		if c.Alias != nil {
+			if anchor, ok := clones[c.Alias]; ok {
+				c.Alias = anchor
+			}
+		}
+	}
+	return result
+}
+
+// resolvePath resolves name relative to the directory of the handler's source file
+func (h *IncludeHandler) resolvePath(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return path.Clean(strings.TrimPrefix(name, "/"))
+	}
+	if h.source == "" {
+		return path.Clean(name)
+	}
+	return path.Join(path.Dir(h.source), name)
+}
+
+// load parses the named file, resolving any inclusions nested within it
+func (h *IncludeHandler) load(ctx context.Context, name string) (*yaml.Node, error) {
+	if !fs.ValidPath(name) {
+		return nil, fmt.Errorf("invalid path %q", name)
+	}
+	b, err := fs.ReadFile(h.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, fmt.Errorf("%s: file is empty", name)
+	}
+
+	nested := *h
+	nested.source = name
+	v, err := NewVisitor(&nested)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Visit(ctx, doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	h.record(doc, name)
+	return doc, nil
+}
+
+// record marks node and its descendants as included from source, unless already spliced from a nested inclusion
+func (h *IncludeHandler) record(node *yaml.Node, source string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sources[node] = source
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		for _, child := range n.Content {
+			if _, ok := h.sources[child]; !ok {
+				h.sources[child] = source
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+}
+
+// selectFragment selects the node identified by fragment within doc, which is either a JSON pointer (e.g. /a/b/0)
+// or a [yamlpath] expression (e.g. $.a.b[0]) selecting exactly one node. An empty fragment selects the root node.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func selectFragment(doc *yaml.Node, fragment string) (*yaml.Node, error) {
+	root := doc
+	if doc.Kind == yaml.DocumentNode {
+		root = doc.Content[0]
+	}
+
+	switch {
+	case fragment == "" || fragment == "/":
+		return root, nil
+	case strings.HasPrefix(fragment, "$"):
+		p, err := yamlpath.NewPath(fragment)
+		if err != nil {
+			return nil, err
+		}
+		found, err := p.Find(doc)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) != 1 {
+			return nil, fmt.Errorf("path %q selected %d nodes, expected exactly one", fragment, len(found))
+		}
+		return found[0], nil
+	case strings.HasPrefix(fragment, "/"):
+		return resolvePointer(root, fragment)
+	}
+	return nil, fmt.Errorf("fragment %q is neither a JSON pointer nor a path expression", fragment)
+}
+
+// resolvePointer resolves a JSON pointer as defined by RFC 6901
+func resolvePointer(node *yaml.Node, pointer string) (*yaml.Node, error) {
+	for _, token := range strings.Split(pointer, "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == token {
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("pointer %q not found", pointer)
+		}
+		node = next
+	}
+	return node, nil
+}
+
+// NewIncludeHandler creates a handler which resolves inclusions of other files within fsys by splicing the
+// referenced node in place of the including node. Two forms are supported:
+//
+//	database: !include database.yaml
+//	server: {$ref: "common.yaml#/defaults/server"}
+//
+// A reference may select a subtree of the included file by a fragment, either as a JSON pointer (#/defaults/server)
+// or a [yamlpath] expression selecting exactly one node (#$.defaults.server). A reference without a file, such as
+// #/defaults/server, refers to the visited document.
+//
+// Included files are resolved relative to the including file, and inclusions nested within included files are
+// resolved recursively. Cyclic inclusions result in an error wrapping ErrIncludeCycle. The source file of each
+// spliced node is available via IncludeHandler.SourceOf.
+//
+// The handler may be composed with a ConditionalHandler to limit where inclusions are resolved, for example
+// OnVisitScalarNode("$.services.*", handler.VisitScalarNode).
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func NewIncludeHandler(fsys fs.FS, opts ...IncludeOpt) *IncludeHandler {
+	handler := &IncludeHandler{
+		fsys:    fsys,
+		tag:     "!include",
+		refKey:  "$ref",
+		mu:      &sync.Mutex{},
+		sources: make(map[*yaml.Node]string),
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
@@ -0,0 +1,221 @@
+package yay
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestIncludeHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		"database.yaml":      {Data: []byte("host: localhost\nport: 5432")},
+		"common.yaml":        {Data: []byte("defaults:\n  server:\n    port: 8080\n  list: [a, b/c]\n  \"a/b\": slash")},
+		"conf/app.yaml":      {Data: []byte("name: app\nlogging: !include logging.yaml")},
+		"conf/logging.yaml":  {Data: []byte("level: info")},
+		"root.yaml":          {Data: []byte("!include database.yaml")},
+		"cycle/a.yaml":       {Data: []byte("b: !include b.yaml")},
+		"cycle/b.yaml":       {Data: []byte("a: !include a.yaml")},
+		"invalid.yaml":       {Data: []byte("a: [")},
+		"multiple.yaml":      {Data: []byte("items: [{name: a}, {name: b}]")},
+		"conf/absolute.yaml": {Data: []byte("db: !include /database.yaml")},
+	}
+
+	tests := map[string]struct {
+		input   string
+		opts    []IncludeOpt
+		want    string
+		wantErr string
+	}{
+		"includes a file": {
+			input: "database: !include database.yaml",
+			want:  "database:\n    host: localhost\n    port: 5432\n",
+		},
+		"includes a JSON pointer fragment": {
+			input: "server: !include common.yaml#/defaults/server\nsecond: !include common.yaml#/defaults/list/1\nescaped: !include common.yaml#/defaults/a~1b",
+			want:  "server:\n    port: 8080\nsecond: b/c\nescaped: slash\n",
+		},
+		"includes a path fragment": {
+			input: "server: !include common.yaml#$.defaults.server.port",
+			want:  "server: 8080\n",
+		},
+		"resolves references": {
+			input: "server:\n  $ref: common.yaml#/defaults/server\n  ignored: true",
+			want:  "server:\n    port: 8080\n",
+		},
+		"resolves local references": {
+			input: "defaults: {port: 1}\nserver: {$ref: '#/defaults'}",
+			want:  "defaults: {port: 1}\nserver: {port: 1}\n",
+		},
+		"resolves nested inclusions relative to the including file": {
+			input: "app: !include conf/app.yaml",
+			want:  "app:\n    name: app\n    logging:\n        level: info\n",
+		},
+		"resolves absolute inclusions from the root": {
+			input: "app: !include conf/absolute.yaml",
+			want:  "app:\n    db:\n        host: localhost\n        port: 5432\n",
+		},
+		"resolves relative to the source file": {
+			input: "logging: !include logging.yaml",
+			opts:  []IncludeOpt{WithIncludeSource("conf/main.yaml")},
+			want:  "logging:\n    level: info\n",
+		},
+		"resolves documents which are inclusions": {
+			input: "!include root.yaml",
+			want:  "host: localhost\nport: 5432\n",
+		},
+		"supports custom tags and keys": {
+			input: "a: !load database.yaml#/port\nb: {ref: database.yaml#/host}\nc: !include ignored.yaml\nd: {$ref: ignored.yaml}",
+			opts:  []IncludeOpt{WithIncludeTag("!load"), WithRefKey("ref")},
+			want:  "a: 5432\nb: localhost\nc: !include ignored.yaml\nd: {$ref: ignored.yaml}\n",
+		},
+		"detects cycles": {
+			input:   "a: !include cycle/a.yaml",
+			wantErr: "include cycle detected: cycle/a.yaml -> cycle/b.yaml -> cycle/a.yaml",
+		},
+		"detects cycles with the source file": {
+			input:   "a: !include a.yaml",
+			opts:    []IncludeOpt{WithIncludeSource("cycle/b.yaml")},
+			wantErr: "include cycle detected: cycle/b.yaml -> cycle/a.yaml -> cycle/b.yaml",
+		},
+		"follows chained local references": {
+			input: "a: {$ref: '#/b'}\nb: {$ref: '#/c'}\nc: {x: 1}",
+			want:  "a: {x: 1}\nb: {x: 1}\nc: {x: 1}\n",
+		},
+		"follows local references regardless of order": {
+			input: "c: {x: 1}\nb: {$ref: '#/c'}\na: {$ref: '#/b'}",
+			want:  "c: {x: 1}\nb: {x: 1}\na: {x: 1}\n",
+		},
+		"follows local references to inclusions": {
+			input: "server: {$ref: '#/defaults'}\ndefaults: !include database.yaml",
+			want:  "server:\n    host: localhost\n    port: 5432\ndefaults:\n    host: localhost\n    port: 5432\n",
+		},
+		"detects indirect local reference cycles": {
+			input:   "a: {$ref: '#/b'}\nb: {$ref: '#/c'}\nc: {$ref: '#/b'}",
+			wantErr: `1:4: include cycle detected: "#/b" -> "#/c" -> "#/b"`,
+		},
+		"detects local references back to the referencing node": {
+			input:   "a: {$ref: '#/b'}\nb: {$ref: '#/a'}",
+			wantErr: `1:4: include cycle detected: "#/b" -> "#/a" references itself`,
+		},
+		"detects local references to ancestors": {
+			input:   "a:\n  b: {$ref: '#/a'}",
+			wantErr: `include cycle detected: "#/a" references itself`,
+		},
+		"reports missing files": {
+			input:   "a: b\nc: !include missing.yaml",
+			wantErr: `2:4: unable to include "missing.yaml"`,
+		},
+		"reports invalid files": {
+			input:   "a: !include invalid.yaml",
+			wantErr: "invalid.yaml: yaml:",
+		},
+		"reports missing fragments": {
+			input:   "a: !include database.yaml#/missing",
+			wantErr: `pointer "/missing" not found`,
+		},
+		"reports ambiguous paths": {
+			input:   "a: !include multiple.yaml#$.items[*].name",
+			wantErr: "selected 2 nodes, expected exactly one",
+		},
+		"reports invalid fragments": {
+			input:   "a: !include database.yaml#host",
+			wantErr: "neither a JSON pointer nor a path expression",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc := &yaml.Node{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), doc))
+
+			v, err := NewVisitor(NewIncludeHandler(fsys, tt.opts...))
+			assert.NoError(t, err)
+			err = v.Visit(context.TODO(), doc)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			out, err := yaml.Marshal(doc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestIncludeHandler_nodeErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"cycle/a.yaml": {Data: []byte("b: !include b.yaml")},
+		"cycle/b.yaml": {Data: []byte("a: !include a.yaml")},
+	}
+	doc := &yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte("name: app\nmissing: !include missing.yaml\ncycle:\n  - !include cycle/a.yaml"), doc))
+
+	v, err := NewVisitor(NewIncludeHandler(fsys))
+	assert.NoError(t, err)
+	err = v.Visit(context.TODO(), doc)
+
+	assert.ErrorIs(t, err, ErrIncludeCycle)
+	positions := make([][2]int, 0)
+	for _, e := range NodeErrors(err) {
+		positions = append(positions, [2]int{e.Node.Line, e.Node.Column})
+	}
+	// errors of nested inclusions are wrapped by the error of the including node
+	assert.Equal(t, [][2]int{{2, 10}, {4, 5}}, positions)
+}
+
+func TestIncludeHandler_SourceOf(t *testing.T) {
+	fsys := fstest.MapFS{
+		"conf/app.yaml":     {Data: []byte("name: app\nlogging: !include logging.yaml")},
+		"conf/logging.yaml": {Data: []byte("level: info")},
+	}
+
+	doc := &yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte("local: value\napp: !include conf/app.yaml"), doc))
+
+	handler := NewIncludeHandler(fsys)
+	v, err := NewVisitor(handler)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), doc))
+
+	root := doc.Content[0]
+	_, ok := handler.SourceOf(root.Content[1])
+	assert.False(t, ok, "nodes which weren't spliced have no source")
+
+	app := root.Content[3]
+	source, ok := handler.SourceOf(app)
+	assert.True(t, ok)
+	assert.Equal(t, "conf/app.yaml", source)
+
+	source, _ = handler.SourceOf(app.Content[1])
+	assert.Equal(t, "conf/app.yaml", source)
+
+	logging := app.Content[3]
+	source, _ = handler.SourceOf(logging)
+	assert.Equal(t, "conf/logging.yaml", source)
+	source, _ = handler.SourceOf(logging.Content[1])
+	assert.Equal(t, "conf/logging.yaml", source)
+}
+
+func TestIncludeHandler_conditional(t *testing.T) {
+	fsys := fstest.MapFS{
+		"database.yaml": {Data: []byte("host: localhost")},
+	}
+
+	doc := &yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte("services:\n  db: !include database.yaml\nother: !include database.yaml"), doc))
+
+	include := NewIncludeHandler(fsys)
+	handler, err := NewConditionalHandler(OnVisitScalarNodeIf(Glob("services.*"), include.VisitScalarNode))
+	assert.NoError(t, err)
+	v, err := NewVisitor(handler)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), doc))
+
+	out, err := yaml.Marshal(doc)
+	assert.NoError(t, err)
+	assert.Equal(t, "services:\n    db:\n        host: localhost\nother: !include database.yaml\n", string(out))
+}
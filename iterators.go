@@ -0,0 +1,151 @@
+package yay
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"slices"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Path locates a node yielded by Nodes, Scalars, or Match within its document
+type Path struct {
+	frames []frame
+}
+
+// String returns the [yamlpath] expression selecting the node, e.g. $.spec.containers[0].image
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func (p Path) String() string {
+	return pathOf(p.frames)
+}
+
+// Key returns the mapping key of the node, or nil for sequence items and the document's root node
+func (p Path) Key() *yaml.Node {
+	return p.frames[len(p.frames)-1].key
+}
+
+// Index returns the position of the node within its parent: the item index for sequences, the entry index for
+// mappings, or -1 for the document's root node
+func (p Path) Index() int {
+	return p.frames[len(p.frames)-1].index
+}
+
+// Depth returns the number of ancestors of the node below the document's root node, which has a depth of 0
+func (p Path) Depth() int {
+	return len(p.frames) - 1
+}
+
+// Parent returns the collection containing the node, or nil for the document's root node
+func (p Path) Parent() *yaml.Node {
+	if len(p.frames) < 2 {
+		return nil
+	}
+	return p.frames[len(p.frames)-2].node
+}
+
+// iterationTraversal creates the traversal of node, which may be a document or any other node
+func iterationTraversal(node *yaml.Node) (*traversal, bool) {
+	if node == nil {
+		return nil, false
+	}
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil, false
+		}
+		return newTraversal(node, node.Content[0]), true
+	}
+	virtualRoot := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{node}}
+	return newTraversal(virtualRoot, node), true
+}
+
+// walk invokes fn for node, the top of t, and its descendants in the order they're visited by a Visitor, until fn
+// returns false. Aliases aren't followed.
+func walk(t *traversal, node *yaml.Node, fn func(node *yaml.Node) bool) bool {
+	if !fn(node) {
+		return false
+	}
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			t.push(frame{node: child, index: i})
+			ok := walk(t, child, fn)
+			t.pop()
+			if !ok {
+				return false
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			child := node.Content[i+1]
+			t.push(frame{node: child, key: node.Content[i], index: i / 2})
+			ok := walk(t, child, fn)
+			t.pop()
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Nodes iterates the document's root node and its descendants along with their paths, in the order they're visited by
+// a Visitor: mapping values in order of their keys, and sequence items by index. Mapping keys aren't yielded, but are
+// available via Path.Key. Aliases aren't followed. doc may be a document node, or any other node treated as a root.
+//
+// Iteration stops without walking the rest of the tree once the loop body breaks:
+//
+//	for path, node := range yay.Nodes(doc) {
+//		if node.Tag == "!secret" {
+//			fmt.Println(path)
+//			break
+//		}
+//	}
+func Nodes(doc *yaml.Node) iter.Seq2[Path, *yaml.Node] {
+	return func(yield func(Path, *yaml.Node) bool) {
+		t, ok := iterationTraversal(doc)
+		if !ok {
+			return
+		}
+		walk(t, t.top().node, func(node *yaml.Node) bool {
+			return yield(Path{frames: slices.Clone(t.frames)}, node)
+		})
+	}
+}
+
+// Scalars iterates the scalar nodes of the document along with their paths. See Nodes.
+func Scalars(doc *yaml.Node) iter.Seq2[Path, *yaml.Node] {
+	return func(yield func(Path, *yaml.Node) bool) {
+		for path, node := range Nodes(doc) {
+			if node.Kind == yaml.ScalarNode && !yield(path, node) {
+				return
+			}
+		}
+	}
+}
+
+// Match iterates the nodes of the document selected by path, either a raw [yamlpath] selector string or a Condition,
+// in the order they're visited by a Visitor. Paths are evaluated as they are for a ConditionalHandler, incrementally
+// where possible. An error is returned for an invalid selector, before any nodes are iterated.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func Match[P PathCondition](doc *yaml.Node, path P) (iter.Seq2[Path, *yaml.Node], error) {
+	condition := conditionOf(path)
+	if err := condition.err(); err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", condition, err)
+	}
+	return func(yield func(Path, *yaml.Node) bool) {
+		t, ok := iterationTraversal(doc)
+		if !ok {
+			return
+		}
+		match := condition.compile()
+		ctx := withTraversal(withRootNode(context.Background(), t.root), t)
+		walk(t, t.top().node, func(node *yaml.Node) bool {
+			// selectors are validated up front, so matching a node doesn't fail
+			_, ok, _ := match(ctx, node)
+			return !ok || yield(Path{frames: slices.Clone(t.frames)}, node)
+		})
+	}, nil
+}
@@ -0,0 +1,188 @@
+package yay
+
+import (
+	"iter"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+const iteratorSource = `name: demo
+spec:
+  containers:
+    - name: web
+      image: nginx
+    - name: sidecar
+      image: envoy
+  replicas: 2
+base: &base
+  image: busybox
+derived:
+  <<: *base
+`
+
+func TestNodes(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(iteratorSource), &doc))
+
+	paths := make([]string, 0)
+	for path, node := range Nodes(&doc) {
+		paths = append(paths, path.String()+" "+node.Value)
+	}
+	assert.Equal(t, []string{
+		"$ ",
+		"$.name demo",
+		"$.spec ",
+		"$.spec.containers ",
+		"$.spec.containers[0] ",
+		"$.spec.containers[0].name web",
+		"$.spec.containers[0].image nginx",
+		"$.spec.containers[1] ",
+		"$.spec.containers[1].name sidecar",
+		"$.spec.containers[1].image envoy",
+		"$.spec.replicas 2",
+		"$.base ",
+		"$.base.image busybox",
+		"$.derived ",
+		"$.derived['<<'] base",
+	}, paths)
+}
+
+func TestNodes_path(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(iteratorSource), &doc))
+
+	for path, node := range Nodes(&doc) {
+		switch path.String() {
+		case "$":
+			assert.Nil(t, path.Key())
+			assert.Nil(t, path.Parent())
+			assert.Equal(t, -1, path.Index())
+			assert.Equal(t, 0, path.Depth())
+		case "$.spec.containers[1]":
+			assert.Nil(t, path.Key())
+			assert.Equal(t, 1, path.Index())
+			assert.Equal(t, 3, path.Depth())
+			assert.Equal(t, yaml.SequenceNode, path.Parent().Kind)
+		case "$.spec.replicas":
+			assert.Equal(t, "replicas", path.Key().Value)
+			assert.Equal(t, 1, path.Index())
+			assert.Equal(t, "2", node.Value)
+		}
+	}
+}
+
+func TestNodes_break(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(iteratorSource), &doc))
+
+	visited := 0
+	for _, node := range Nodes(&doc) {
+		visited++
+		if node.Value == "web" {
+			break
+		}
+	}
+	assert.Equal(t, 6, visited)
+}
+
+func TestNodes_nonDocuments(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("items: [a, b]"), &doc))
+
+	paths := make([]string, 0)
+	for path := range Nodes(doc.Content[0].Content[1]) {
+		paths = append(paths, path.String())
+	}
+	assert.Equal(t, []string{"$", "$[0]", "$[1]"}, paths)
+
+	for range Nodes(&yaml.Node{Kind: yaml.DocumentNode}) {
+		t.Fatal("empty documents have no nodes")
+	}
+	for range Nodes(nil) {
+		t.Fatal("nil has no nodes")
+	}
+}
+
+func TestScalars(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(iteratorSource), &doc))
+
+	values := make([]string, 0)
+	for _, node := range Scalars(&doc) {
+		values = append(values, node.Value)
+		if len(values) == 4 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"demo", "web", "nginx", "sidecar"}, values)
+}
+
+func TestMatch(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(iteratorSource), &doc))
+
+	collect := func(seq iter.Seq2[Path, *yaml.Node], err error) []string {
+		assert.NoError(t, err)
+		result := make([]string, 0)
+		for path, node := range seq {
+			result = append(result, path.String()+"="+node.Value)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"$.spec.containers[0].image=nginx", "$.spec.containers[1].image=envoy"},
+		collect(Match(&doc, "$.spec.containers[*].image")))
+	assert.Equal(t, []string{"$.spec.containers[1].name=sidecar"},
+		collect(Match(&doc, "$.spec.containers[?(@.image == 'envoy')].name")))
+	assert.Equal(t, []string{"$.spec.containers[0].name=web", "$.spec.containers[1].name=sidecar"},
+		collect(Match(&doc, Glob("spec.containers.*.name"))))
+	assert.Equal(t, []string{"$.name=demo"},
+		collect(Match(&doc, All(Selector("$..name"), Not(Glob("**.containers.**"))))))
+	assert.Equal(t, []string{"$=", "$.name=demo"},
+		collect(Match(&doc, Any(Selector("$"), Selector("$.name")))))
+
+	first := ""
+	matches, err := Match(&doc, "$..image")
+	assert.NoError(t, err)
+	for path := range matches {
+		first = path.String()
+		break
+	}
+	assert.Equal(t, "$.spec.containers[0].image", first)
+}
+
+func TestMatch_invalid(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(iteratorSource), &doc))
+
+	tests := map[string]struct {
+		seq      func() (iter.Seq2[Path, *yaml.Node], error)
+		expected string
+	}{
+		"selector": {
+			seq:      func() (iter.Seq2[Path, *yaml.Node], error) { return Match(&doc, "$.[") },
+			expected: `invalid condition "$.[": `,
+		},
+		"glob": {
+			seq:      func() (iter.Seq2[Path, *yaml.Node], error) { return Match(&doc, Glob("spec..name")) },
+			expected: `invalid condition "spec..name": invalid glob "spec..name": `,
+		},
+		"nested selector": {
+			seq: func() (iter.Seq2[Path, *yaml.Node], error) {
+				return Match(&doc, Any(Selector("$.name"), Not(Selector("$.["))))
+			},
+			expected: `invalid condition "any($.name, not($.[))": `,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			seq, err := tt.seq()
+			assert.Nil(t, seq)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.expected)
+			}
+		})
+	}
+}
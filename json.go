@@ -0,0 +1,289 @@
+package yay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	// ErrNonStringKey is returned by ToJSON for each mapping key which isn't a string, as JSON only supports string keys
+	ErrNonStringKey = errors.New("mapping key is not a string")
+	// ErrNotRepresentable is returned by ToJSON for each value which has no JSON representation, such as .inf or .nan
+	ErrNotRepresentable = errors.New("value is not representable in JSON")
+)
+
+// maxSafeInteger is the largest integer exactly representable by a JSON number parsed as an IEEE 754 double
+var maxSafeInteger = big.NewInt(1<<53 - 1)
+
+type jsonOptions struct {
+	prefix         string
+	indent         string
+	bigIntsStrings bool
+}
+
+// JSONOpt is an option for ToJSON
+type JSONOpt func(o *jsonOptions)
+
+// WithJSONIndent pretty-prints the JSON output, with each line beginning with prefix and indented by one or more
+// copies of indent, as with json.MarshalIndent. By default, the output is compact.
+func WithJSONIndent(prefix string, indent string) JSONOpt {
+	return func(o *jsonOptions) {
+		o.prefix = prefix
+		o.indent = indent
+	}
+}
+
+// WithBigIntsAsStrings writes integers beyond ±(2^53-1), which can't be represented exactly by consumers parsing JSON
+// numbers as doubles (such as JavaScript), as strings
+func WithBigIntsAsStrings() JSONOpt {
+	return func(o *jsonOptions) {
+		o.bigIntsStrings = true
+	}
+}
+
+// ToJSON converts node to JSON, retaining the order of mapping keys. Aliases and merge keys are resolved, and scalars
+// are written according to their resolved tag: !!null, !!bool, !!int, and !!float become JSON literals, !!binary
+// becomes its base64 string, and all other scalars (including those with custom tags) become strings.
+//
+// Values which can't be represented in JSON are reported as NodeErrors wrapping ErrNonStringKey or ErrNotRepresentable,
+// joined such that all errors within the document are reported.
+func ToJSON(node *yaml.Node, opts ...JSONOpt) ([]byte, error) {
+	o := jsonOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	w := &jsonWriter{options: o, active: make(map[*yaml.Node]struct{})}
+	w.write(node)
+	if w.err != nil {
+		return nil, w.err
+	}
+	if o.prefix == "" && o.indent == "" {
+		return w.buf.Bytes(), nil
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, w.buf.Bytes(), o.prefix, o.indent); err != nil {
+		return nil, err
+	}
+	return indented.Bytes(), nil
+}
+
+type jsonWriter struct {
+	buf     bytes.Buffer
+	options jsonOptions
+	err     error
+	// active are the nodes currently being written, as an alias may refer to an ancestor
+	active map[*yaml.Node]struct{}
+}
+
+func (w *jsonWriter) fail(node *yaml.Node, err error) {
+	w.err = errors.Join(w.err, &NodeError{Node: node, Err: err})
+}
+
+func (w *jsonWriter) writeString(s string) {
+	b, _ := json.Marshal(s)
+	w.buf.Write(b)
+}
+
+func (w *jsonWriter) write(node *yaml.Node) {
+	resolved := resolveAlias(node)
+	if resolved == nil {
+		w.buf.WriteString("null")
+		return
+	}
+	if _, ok := w.active[resolved]; ok {
+		w.fail(node, fmt.Errorf("%w: recursive alias %q", ErrNotRepresentable, node.Value))
+		w.buf.WriteString("null")
+		return
+	}
+	w.active[resolved] = struct{}{}
+	defer delete(w.active, resolved)
+
+	switch resolved.Kind {
+	case yaml.DocumentNode:
+		if len(resolved.Content) == 0 {
+			w.buf.WriteString("null")
+			return
+		}
+		w.write(resolved.Content[0])
+	case yaml.SequenceNode:
+		w.buf.WriteByte('[')
+		for i, child := range resolved.Content {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.write(child)
+		}
+		w.buf.WriteByte(']')
+	case yaml.MappingNode:
+		w.buf.WriteByte('{')
+		for i, e := range mergedEntries(resolved) {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			key := resolveAlias(e.key)
+			if key == nil || key.Kind != yaml.ScalarNode || !isStringTag(key.ShortTag()) {
+				w.fail(e.key, fmt.Errorf("%w: %s", ErrNonStringKey, describeKey(key)))
+				w.writeString("")
+			} else {
+				w.writeString(key.Value)
+			}
+			w.buf.WriteByte(':')
+			w.write(e.value)
+		}
+		w.buf.WriteByte('}')
+	case yaml.ScalarNode:
+		w.writeScalar(resolved)
+	}
+}
+
+func (w *jsonWriter) writeScalar(node *yaml.Node) {
+	tag, value := canonicalScalar(node)
+	switch tag {
+	case "!!null", "!!bool":
+		w.buf.WriteString(value)
+	case "!!int":
+		n, ok := new(big.Int).SetString(value, 10)
+		switch {
+		case !ok:
+			w.fail(node, fmt.Errorf("%w: invalid integer %q", ErrNotRepresentable, node.Value))
+			w.buf.WriteString("null")
+		case w.options.bigIntsStrings && new(big.Int).Abs(n).Cmp(maxSafeInteger) > 0:
+			w.writeString(value)
+		default:
+			w.buf.WriteString(value)
+		}
+	case "!!float":
+		if !json.Valid([]byte(value)) {
+			w.fail(node, fmt.Errorf("%w: %s", ErrNotRepresentable, node.Value))
+			w.buf.WriteString("null")
+			return
+		}
+		w.buf.WriteString(value)
+	case "!!binary":
+		w.writeString(strings.Join(strings.Fields(value), ""))
+	default:
+		w.writeString(value)
+	}
+}
+
+// isStringTag determines whether a scalar with the tag is a string, i.e. explicitly or implicitly !!str, or a custom tag
+func isStringTag(tag string) bool {
+	return tag == "!!str" || !strings.HasPrefix(tag, "!!")
+}
+
+func describeKey(key *yaml.Node) string {
+	if key == nil {
+		return "null"
+	}
+	switch key.Kind {
+	case yaml.MappingNode:
+		return "mapping"
+	case yaml.SequenceNode:
+		return "sequence"
+	}
+	return key.ShortTag() + " " + key.Value
+}
+
+// FromJSON parses a single JSON value into a yaml.Node document, retaining the order of object keys, such that handlers
+// may process JSON inputs. Numbers are tagged !!int or !!float according to their literal form, and each node is
+// positioned at the line and column of its JSON value.
+func FromJSON(data []byte) (*yaml.Node, error) {
+	p := &jsonParser{data: data, decoder: json.NewDecoder(bytes.NewReader(data))}
+	p.decoder.UseNumber()
+	for i, b := range data {
+		if b == '\n' {
+			p.lines = append(p.lines, i+1)
+		}
+	}
+
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	offset := int(p.decoder.InputOffset())
+	if _, err := p.decoder.Token(); err != io.EOF {
+		line, column := p.position(offset)
+		return nil, fmt.Errorf("%d:%d: unexpected data after JSON value", line, column)
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Line: 1, Column: 1, Content: []*yaml.Node{root}}, nil
+}
+
+type jsonParser struct {
+	data    []byte
+	decoder *json.Decoder
+	// lines are the offsets at which each line after the first begins
+	lines []int
+}
+
+// position returns the 1-based line and column of the first token at or after offset
+func (p *jsonParser) position(offset int) (int, int) {
+	for offset < len(p.data) && strings.IndexByte(" \t\r\n,:", p.data[offset]) >= 0 {
+		offset++
+	}
+	line := sort.SearchInts(p.lines, offset+1)
+	start := 0
+	if line > 0 {
+		start = p.lines[line-1]
+	}
+	return line + 1, offset - start + 1
+}
+
+func (p *jsonParser) parse() (*yaml.Node, error) {
+	line, column := p.position(int(p.decoder.InputOffset()))
+	token, err := p.decoder.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%d:%d: %w", line, column, err)
+	}
+
+	node := &yaml.Node{Line: line, Column: column}
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '[' {
+			node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		} else {
+			node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		}
+		for p.decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := p.parse()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, key)
+			}
+			value, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		// the closing delimiter
+		if _, err := p.decoder.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!str", t
+	case json.Number:
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!int", t.String()
+		if strings.ContainsAny(node.Value, ".eE") {
+			node.Tag = "!!float"
+		}
+	case bool:
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!bool", fmt.Sprint(t)
+	case nil:
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!null", "null"
+	}
+	return node, nil
+}
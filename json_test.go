@@ -0,0 +1,136 @@
+package yay
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestToJSON(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []JSONOpt
+		expected string
+		errors   []string
+	}{
+		"retains key order": {
+			input:    "z: 1\na: 2\nm: [x, y]",
+			expected: `{"z":1,"a":2,"m":["x","y"]}`,
+		},
+		"resolves scalar tags": {
+			input:    "a: ~\nb: yes\nc: True\nd: 0x10\ne: 1.50\nf: '16'\ng: !!str 17\nh: 2001-01-01\ni: !custom text",
+			expected: `{"a":null,"b":"yes","c":true,"d":16,"e":1.5,"f":"16","g":"17","h":"2001-01-01","i":"text"}`,
+		},
+		"writes binary as base64": {
+			input:    "data: !!binary |\n  aGVs\n  bG8=",
+			expected: `{"data":"aGVsbG8="}`,
+		},
+		"resolves aliases and merge keys": {
+			input:    "base: &b {x: 1, y: 2}\nuse:\n  <<: *b\n  y: 3\ncopy: *b",
+			expected: `{"base":{"x":1,"y":2},"use":{"x":1,"y":3},"copy":{"x":1,"y":2}}`,
+		},
+		"writes big integers as numbers by default": {
+			input:    "id: 9007199254740993",
+			expected: `{"id":9007199254740993}`,
+		},
+		"optionally writes big integers as strings": {
+			input:    "id: 9007199254740993\nsafe: 9007199254740991\nnegative: -9007199254740993",
+			opts:     []JSONOpt{WithBigIntsAsStrings()},
+			expected: `{"id":"9007199254740993","safe":9007199254740991,"negative":"-9007199254740993"}`,
+		},
+		"pretty prints": {
+			input:    "a: [1]",
+			opts:     []JSONOpt{WithJSONIndent("", "  ")},
+			expected: "{\n  \"a\": [\n    1\n  ]\n}",
+		},
+		"reports non-string keys and unrepresentable values": {
+			input: "ok: 1\n1: int\n[a]: seq\nn: .nan",
+			errors: []string{
+				"2:1: mapping key is not a string: !!int 1",
+				"3:1: mapping key is not a string: sequence",
+				"4:4: value is not representable in JSON: .nan",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), &doc))
+
+			actual, err := ToJSON(&doc, tt.opts...)
+			if len(tt.errors) > 0 {
+				messages := make([]string, 0)
+				for _, e := range NodeErrors(err) {
+					messages = append(messages, e.Error())
+				}
+				assert.Equal(t, tt.errors, messages)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(actual))
+		})
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	input := `{
+  "z": 1,
+  "a": [true, null, 1.5, "text"],
+  "big": 9007199254740993,
+  "nested": {"x": "y"}
+}`
+	doc, err := FromJSON([]byte(input))
+	assert.NoError(t, err)
+
+	out, err := yaml.Marshal(doc)
+	assert.NoError(t, err)
+	assert.Equal(t, trimmed(`z: 1
+		|a:
+		|    - true
+		|    - null
+		|    - 1.5
+		|    - text
+		|big: 9007199254740993
+		|nested:
+		|    x: y`), string(out))
+
+	// positions refer to the JSON input
+	root := doc.Content[0]
+	assert.Equal(t, [2]int{1, 1}, [2]int{root.Line, root.Column})
+	assert.Equal(t, [2]int{2, 3}, [2]int{root.Content[0].Line, root.Content[0].Column})
+	assert.Equal(t, [2]int{3, 21}, [2]int{root.Content[3].Content[2].Line, root.Content[3].Content[2].Column})
+	assert.Equal(t, [2]int{5, 19}, [2]int{root.Content[7].Content[1].Line, root.Content[7].Content[1].Column})
+
+	// round trip
+	actual, err := ToJSON(doc)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"z":1,"a":[true,null,1.5,"text"],"big":9007199254740993,"nested":{"x":"y"}}`, string(actual))
+
+	// handlers may process JSON inputs
+	v, err := NewVisitor(NewRedactionHandler(WithRedactPaths("$.nested.x")))
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.TODO(), doc))
+	actual, err = ToJSON(doc)
+	assert.NoError(t, err)
+	assert.Contains(t, string(actual), `"nested":{"x":"[REDACTED]"}`)
+}
+
+func TestFromJSON_errors(t *testing.T) {
+	tests := map[string]string{
+		`{"a": }`:    "1:7: ",
+		`[1, 2`:      "1:6: ",
+		`{"a": 1} 2`: "1:10: unexpected data after JSON value",
+	}
+	for input, expected := range tests {
+		t.Run(input, func(t *testing.T) {
+			_, err := FromJSON([]byte(input))
+			if assert.Error(t, err) {
+				// the messages of json.Decoder vary between Go versions, so only the position is compared
+				assert.True(t, strings.HasPrefix(err.Error(), expected), err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package lsp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/jimschubert/yay"
+	"go.yaml.in/yaml/v3"
+)
+
+// parseErrorLine extracts the line of a yaml.v3 parse error, e.g. yaml: line 3: did not find expected key
+var parseErrorLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// parsed are the documents decoded from a text document, each with its position index
+type parsed struct {
+	docs    []*yaml.Node
+	indexes []*yay.PositionIndex
+	// err is the error which stopped decoding, if any; documents preceding the error are retained
+	err error
+}
+
+func parse(text []byte) parsed {
+	result := parsed{}
+	dec := yaml.NewDecoder(bytes.NewReader(text))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return result
+		}
+		if err != nil {
+			result.err = err
+			return result
+		}
+		index, err := yay.NewPositionIndex(text, &doc)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		result.docs = append(result.docs, &doc)
+		result.indexes = append(result.indexes, index)
+	}
+}
+
+// clone deep-copies doc, so a handler may modify the copy. The returned map relates each copied node to its original,
+// e.g. to position the errors of a handler.
+func clone(doc *yaml.Node) (*yaml.Node, map[*yaml.Node]*yaml.Node) {
+	clones := make(map[*yaml.Node]*yaml.Node)
+	originals := make(map[*yaml.Node]*yaml.Node)
+	var copyNode func(n *yaml.Node) *yaml.Node
+	copyNode = func(n *yaml.Node) *yaml.Node {
+		result := *n
+		clones[n] = &result
+		originals[&result] = n
+		if n.Content != nil {
+			result.Content = make([]*yaml.Node, len(n.Content))
+			for i, child := range n.Content {
+				result.Content[i] = copyNode(child)
+			}
+		}
+		return &result
+	}
+	result := copyNode(doc)
+
+	// aliases are remapped once all nodes are copied, as an alias may be copied before its anchor
+	for _, c := range clones {
+		if c.Alias != nil {
+			if anchor, ok := clones[c.Alias]; ok {
+				c.Alias = anchor
+			}
+		}
+	}
+	return result, originals
+}
+
+// document is an open text document
+type document struct {
+	uri     string
+	version int
+	text    []byte
+	// lineStarts are the offsets at which each line begins
+	lineStarts []int
+	parsed     parsed
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{uri: uri, version: version, text: []byte(text), lineStarts: []int{0}}
+	for i, b := range d.text {
+		if b == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+	d.parsed = parse(d.text)
+	return d
+}
+
+// lineEnd returns the offset of the end of the 0-based line, excluding the line break
+func (d *document) lineEnd(line int) int {
+	if line+1 < len(d.lineStarts) {
+		end := d.lineStarts[line+1] - 1
+		if end > d.lineStarts[line] && d.text[end-1] == '\r' {
+			end--
+		}
+		return end
+	}
+	return len(d.text)
+}
+
+// toLSP converts a 1-based line and character column to an LSP position
+func (d *document) toLSP(line int, column int) Position {
+	if line < 1 || line > len(d.lineStarts) {
+		return Position{}
+	}
+	start, end := d.lineStarts[line-1], d.lineEnd(line-1)
+	units := 0
+	for i, offset := 1, start; i < column && offset < end; i++ {
+		r, size := utf8.DecodeRune(d.text[offset:])
+		units += utf16.RuneLen(r)
+		offset += size
+	}
+	return Position{Line: line - 1, Character: units}
+}
+
+// fromLSP converts an LSP position to a 1-based line and character column
+func (d *document) fromLSP(p Position) (int, int) {
+	if p.Line < 0 || p.Line >= len(d.lineStarts) {
+		return 0, 0
+	}
+	start, end := d.lineStarts[p.Line], d.lineEnd(p.Line)
+	column, units := 1, 0
+	for offset := start; units < p.Character && offset < end; column++ {
+		r, size := utf8.DecodeRune(d.text[offset:])
+		units += utf16.RuneLen(r)
+		offset += size
+	}
+	return p.Line + 1, column
+}
+
+// rangeOf returns the LSP range of node, or an empty range at its position if its source range is unknown
+func (d *document) rangeOf(index *yay.PositionIndex, node *yaml.Node) Range {
+	if r, ok := index.Range(node); ok {
+		return Range{Start: d.toLSP(r.Start.Line, r.Start.Column), End: d.toLSP(r.End.Line, r.End.Column)}
+	}
+	p := d.toLSP(node.Line, node.Column)
+	return Range{Start: p, End: p}
+}
+
+// lineRange returns the range of the 1-based line
+func (d *document) lineRange(line int) Range {
+	if line < 1 || line > len(d.lineStarts) {
+		return Range{}
+	}
+	end := d.toLSP(line, utf8.RuneCount(d.text[d.lineStarts[line-1]:d.lineEnd(line-1)])+1)
+	return Range{Start: Position{Line: line - 1}, End: end}
+}
+
+// at returns the innermost node at p, along with the index of its document
+func (d *document) at(p Position) (yay.Location, *yay.PositionIndex, bool) {
+	line, column := d.fromLSP(p)
+	for _, index := range d.parsed.indexes {
+		if loc, ok := index.At(line, column); ok {
+			return loc, index, true
+		}
+	}
+	return yay.Location{}, nil, false
+}
+
+// parseDiagnostic converts a parse error to a diagnostic on the line reported by yaml.v3
+func (d *document) parseDiagnostic(err error) Diagnostic {
+	diagnostic := Diagnostic{Severity: SeverityError, Source: source, Message: err.Error()}
+	if m := parseErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		diagnostic.Range = d.lineRange(line)
+		diagnostic.Message = err.Error()[len(m[0]):]
+	}
+	return diagnostic
+}
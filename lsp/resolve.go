@@ -0,0 +1,135 @@
+package lsp
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/jimschubert/yay"
+	"go.yaml.in/yaml/v3"
+)
+
+// isMergeKey determines whether key is a merge key, i.e. << (see https://yaml.org/type/merge.html)
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.Value == "<<" && (key.Tag == "" || key.Tag == "!!merge" || key.Tag == "tag:yaml.org,2002:merge")
+}
+
+// resolve writes node as YAML with its aliases and merge keys resolved
+func resolve(node *yaml.Node) (string, error) {
+	var buf strings.Builder
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(resolveNode(node, make(map[*yaml.Node]struct{}))); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// resolveNode copies node, replacing aliases with copies of their anchored nodes, and merge keys with the entries they
+// merge. Scalars are retained as written. Recursive aliases can't be expanded, so they're retained.
+func resolveNode(node *yaml.Node, expanding map[*yaml.Node]struct{}) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		if node.Alias == nil {
+			return node
+		}
+		if _, ok := expanding[node.Alias]; ok {
+			return node
+		}
+		node = node.Alias
+	}
+	expanding[node] = struct{}{}
+	defer delete(expanding, node)
+
+	result := *node
+	result.Anchor = ""
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		result.Content = make([]*yaml.Node, 0, len(node.Content))
+		for _, child := range node.Content {
+			result.Content = append(result.Content, resolveNode(child, expanding))
+		}
+	case yaml.MappingNode:
+		result.Content = resolveEntries(node, expanding)
+	}
+	return &result
+}
+
+// mergeSource is a resolved mapping merged by the merge key at index within the content of the merging mapping
+type mergeSource struct {
+	index   int
+	mapping *yaml.Node
+}
+
+// resolveEntries resolves the content of mapping. Keys of the mapping itself take precedence over merged keys, and
+// keys of earlier sources of a merge key take precedence over later sources. As with
+// yay.NewMultipleToSingleMergeHandler, later merge keys take precedence over earlier merge keys. Merged entries are
+// positioned at their merge key.
+func resolveEntries(mapping *yaml.Node, expanding map[*yaml.Node]struct{}) []*yaml.Node {
+	claimed := make(map[string]*yaml.Node)
+	sources := make([]mergeSource, 0)
+	var firstKind yaml.Kind
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if !isMergeKey(key) {
+			claimed[keyID(key)] = mapping
+			continue
+		}
+		if firstKind == 0 {
+			firstKind = value.Kind
+		}
+		resolved := resolveNode(value, expanding)
+		switch resolved.Kind {
+		case yaml.MappingNode:
+			sources = append(sources, mergeSource{index: i, mapping: resolved})
+		case yaml.SequenceNode:
+			for _, item := range resolved.Content {
+				if item.Kind == yaml.MappingNode {
+					sources = append(sources, mergeSource{index: i, mapping: item})
+				}
+			}
+		}
+	}
+
+	precedence := slices.Clone(sources)
+	if firstKind == yaml.AliasNode {
+		slices.Reverse(precedence)
+	}
+	for _, source := range precedence {
+		for i := 0; i+1 < len(source.mapping.Content); i += 2 {
+			id := keyID(source.mapping.Content[i])
+			if _, ok := claimed[id]; !ok {
+				claimed[id] = source.mapping
+			}
+		}
+	}
+
+	content := make([]*yaml.Node, 0, len(mapping.Content))
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if !isMergeKey(key) {
+			content = append(content, resolveNode(key, expanding), resolveNode(value, expanding))
+			continue
+		}
+		for _, source := range sources {
+			if source.index != i {
+				continue
+			}
+			for j := 0; j+1 < len(source.mapping.Content); j += 2 {
+				if claimed[keyID(source.mapping.Content[j])] == source.mapping {
+					content = append(content, source.mapping.Content[j], source.mapping.Content[j+1])
+				}
+			}
+		}
+	}
+	return content
+}
+
+// keyID identifies a mapping key, such that equal keys of merged mappings are recognized
+func keyID(key *yaml.Node) string {
+	if key.Kind == yaml.ScalarNode {
+		return key.ShortTag() + "\x00" + key.Value
+	}
+	return yay.Hash(key)
+}
@@ -0,0 +1,45 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestResolve(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected string
+	}{
+		"retains scalars as written": {
+			input:    "base: &base {max: .inf, data: !!binary aGk=}\nuse: {<<: *base}",
+			expected: "base: {max: .inf, data: !!binary aGk=}\nuse: {max: .inf, data: !!binary aGk=}\n",
+		},
+		"resolves non-string keys": {
+			input:    "base: &base {1: one, true: yes}\nuse:\n  <<: *base\n  1: uno",
+			expected: "base: {1: one, true: yes}\nuse:\n  true: yes\n  1: uno\n",
+		},
+		"gives precedence to earlier sources of a merge key": {
+			input:    "a: &a {x: 1}\nb: &b {x: 2, y: 2}\nuse: {<<: [*a, *b]}",
+			expected: "a: {x: 1}\nb: {x: 2, y: 2}\nuse: {x: 1, y: 2}\n",
+		},
+		"gives precedence to later merge keys": {
+			input:    "a: &a {x: 1}\nb: &b {x: 2}\nuse:\n  <<: *a\n  <<: *b",
+			expected: "a: {x: 1}\nb: {x: 2}\nuse:\n  x: 2\n",
+		},
+		"retains recursive aliases": {
+			input:    "a: &a\n  - x\n  - *a",
+			expected: "a:\n  - x\n  - *a\n",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), &doc))
+			actual, err := resolve(doc.Content[0])
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,291 @@
+// Package lsp provides a Language Server Protocol server which reports the diagnostics of yay handlers for open YAML
+// documents, and offers hover and go-to-definition for their nodes.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jimschubert/yay"
+	"go.yaml.in/yaml/v3"
+)
+
+// source identifies the server's diagnostics
+const source = "yay"
+
+// ServerOpt is an option for NewServer
+type ServerOpt func(s *Server)
+
+// WithHandlers configures the handlers which produce diagnostics. The factory is invoked for each diagnosis, so
+// handlers which retain state aren't shared between documents. Each NodeError returned by a handler becomes a
+// diagnostic of the node, coded by the handler's RuleID if it implements yay.Rule.
+func WithHandlers(factory func() []any) ServerOpt {
+	return func(s *Server) {
+		s.handlers = factory
+	}
+}
+
+// WithSeverity configures the severity of diagnostics reported by handlers, which defaults to SeverityWarning.
+// Parse errors are always reported as SeverityError.
+func WithSeverity(severity DiagnosticSeverity) ServerOpt {
+	return func(s *Server) {
+		s.severity = severity
+	}
+}
+
+// Server is a Language Server Protocol server for YAML documents. See NewServer.
+type Server struct {
+	handlers func() []any
+	severity DiagnosticSeverity
+	docs     map[string]*document
+	shutdown bool
+}
+
+// NewServer creates a server which, by default, reports YAML 1.1 pitfalls (yay.NewYAML11Handler) and duplicate keys
+// (yay.NewDuplicateKeyHandler) as diagnostics. See WithHandlers to configure the handlers.
+//
+// The server synchronizes full documents, publishing diagnostics whenever a document is opened or changed. Hovering a
+// node shows its YAML JSONPath, along with its resolved value if it's an alias or involves aliases or merge keys.
+// Go-to-definition navigates from an alias to its anchor.
+func NewServer(opts ...ServerOpt) *Server {
+	s := &Server{
+		handlers: func() []any {
+			return []any{yay.NewYAML11Handler(), yay.NewDuplicateKeyHandler()}
+		},
+		severity: SeverityWarning,
+		docs:     make(map[string]*document),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Serve reads JSON-RPC messages from in and writes responses and notifications to out, such as a client's stdio,
+// until the client sends the exit notification, in is closed, or ctx is done.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	r := bufio.NewReader(in)
+	w := &writer{w: out}
+	for ctx.Err() == nil {
+		body, err := readMessage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := w.respond(json.RawMessage("null"), nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.handle(ctx, w, msg)
+		if msg.ID == nil {
+			// errors of notifications can't be returned to the client
+			continue
+		}
+		if err := w.respond(*msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// handle processes a request or notification, returning the result of a request
+func (s *Server) handle(ctx context.Context, w *writer, msg message) (any, error) {
+	if s.shutdown {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:   textDocumentSyncOptions{OpenClose: true, Change: textDocumentSyncFull},
+				HoverProvider:      true,
+				DefinitionProvider: true,
+			},
+			ServerInfo: serverInfo{Name: source},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenTextDocumentParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		d := newDocument(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+		s.docs[d.uri] = d
+		return nil, s.publish(ctx, w, d)
+	case "textDocument/didChange":
+		var params didChangeTextDocumentParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// with full synchronization, the last change contains the entire document
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		d := newDocument(params.TextDocument.URI, params.TextDocument.Version, text)
+		s.docs[d.uri] = d
+		return nil, s.publish(ctx, w, d)
+	case "textDocument/didClose":
+		var params didCloseTextDocumentParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return nil, w.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params), nil
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params), nil
+	}
+
+	if msg.ID != nil {
+		return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q is not supported", msg.Method)}
+	}
+	return nil, nil
+}
+
+func unmarshalParams(msg message, params any) error {
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// publish sends the diagnostics of d
+func (s *Server) publish(ctx context.Context, w *writer, d *document) error {
+	return w.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         d.uri,
+		Version:     d.version,
+		Diagnostics: s.diagnose(ctx, d),
+	})
+}
+
+// diagnose runs each handler against d. Each handler visits copies of the parsed documents, as handlers may modify them.
+func (s *Server) diagnose(ctx context.Context, d *document) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	if d.parsed.err != nil {
+		diagnostics = append(diagnostics, d.parseDiagnostic(d.parsed.err))
+	}
+
+	for _, handler := range s.handlers() {
+		code := ""
+		if rule, ok := handler.(yay.Rule); ok {
+			code = rule.RuleID()
+		}
+		v, err := yay.NewVisitor(handler)
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{Severity: SeverityError, Code: code, Source: source, Message: err.Error()})
+			continue
+		}
+
+		for i, parsedDoc := range d.parsed.docs {
+			doc, originals := clone(parsedDoc)
+			err := v.Visit(ctx, doc)
+			if err == nil {
+				continue
+			}
+			nodeErrors := yay.NodeErrors(err)
+			if len(nodeErrors) == 0 {
+				r := d.rangeOf(d.parsed.indexes[i], parsedDoc)
+				diagnostics = append(diagnostics, Diagnostic{Range: r, Severity: s.severity, Code: code, Source: source, Message: err.Error()})
+				continue
+			}
+			for _, nodeErr := range nodeErrors {
+				r := Range{}
+				if nodeErr.Node != nil {
+					node := nodeErr.Node
+					if original, ok := originals[node]; ok {
+						node = original
+					}
+					r = d.rangeOf(d.parsed.indexes[i], node)
+				}
+				diagnostics = append(diagnostics, Diagnostic{Range: r, Severity: s.severity, Code: code, Source: source, Message: nodeErr.Err.Error()})
+			}
+		}
+	}
+	return diagnostics
+}
+
+// hover describes the node at the position: its path, and its resolved value if it involves aliases or merge keys
+func (s *Server) hover(params textDocumentPositionParams) *Hover {
+	d, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	loc, index, ok := d.at(params.Position)
+	if !ok {
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("`" + loc.Path + "`")
+	if hasReferences(loc.Value) {
+		resolved, err := resolve(loc.Value)
+		if err != nil {
+			sb.WriteString("\n\nUnable to resolve: " + err.Error())
+		} else {
+			sb.WriteString("\n\n```yaml\n" + resolved + "```")
+		}
+	}
+	r := d.rangeOf(index, loc.Node)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: sb.String()}, Range: &r}
+}
+
+// definition locates the anchor of the alias at the position
+func (s *Server) definition(params textDocumentPositionParams) *Location {
+	d, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	loc, index, ok := d.at(params.Position)
+	if !ok || loc.Node.Kind != yaml.AliasNode || loc.Node.Alias == nil {
+		return nil
+	}
+	return &Location{URI: d.uri, Range: d.rangeOf(index, loc.Node.Alias)}
+}
+
+// hasReferences determines whether node is or contains an alias or merge key
+func hasReferences(node *yaml.Node) bool {
+	if node.Kind == yaml.AliasNode {
+		return true
+	}
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 && isMergeKey(child) {
+			return true
+		}
+		if hasReferences(child) {
+			return true
+		}
+	}
+	return false
+}
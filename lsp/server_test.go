@@ -0,0 +1,299 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jimschubert/yay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// client is an in-process JSON-RPC client of a Server
+type client struct {
+	t        *testing.T
+	w        *writer
+	messages chan map[string]json.RawMessage
+	nextID   int
+	done     chan error
+}
+
+func newClient(t *testing.T, server *Server) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{
+		t:        t,
+		w:        &writer{w: clientOut},
+		messages: make(chan map[string]json.RawMessage, 100),
+		done:     make(chan error, 1),
+	}
+	go func() {
+		c.done <- server.Serve(context.Background(), serverIn, serverOut)
+		_ = serverOut.Close()
+	}()
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			body, err := readMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var msg map[string]json.RawMessage
+			if assert.NoError(t, json.Unmarshal(body, &msg)) {
+				c.messages <- msg
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		_ = clientOut.Close()
+	})
+	return c
+}
+
+func (c *client) next() map[string]json.RawMessage {
+	select {
+	case msg, ok := <-c.messages:
+		require.True(c.t, ok, "server closed the connection")
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for a message")
+	}
+	return nil
+}
+
+// call sends a request, and unmarshals the result of its response into result
+func (c *client) call(method string, params any, result any) *responseError {
+	c.nextID++
+	id := json.RawMessage(fmt.Sprint(c.nextID))
+	require.NoError(c.t, c.w.write(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}))
+	for {
+		msg := c.next()
+		if string(msg["id"]) != string(id) {
+			continue
+		}
+		if raw, ok := msg["error"]; ok {
+			var rpcErr responseError
+			require.NoError(c.t, json.Unmarshal(raw, &rpcErr))
+			return &rpcErr
+		}
+		if result != nil {
+			require.NoError(c.t, json.Unmarshal(msg["result"], result))
+		}
+		return nil
+	}
+}
+
+func (c *client) notify(method string, params any) {
+	require.NoError(c.t, c.w.notify(method, params))
+}
+
+// diagnostics waits for the next diagnostics published by the server
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	for {
+		msg := c.next()
+		if string(msg["method"]) != `"textDocument/publishDiagnostics"` {
+			continue
+		}
+		var params PublishDiagnosticsParams
+		require.NoError(c.t, json.Unmarshal(msg["params"], &params))
+		return params
+	}
+}
+
+func (c *client) open(uri string, text string) PublishDiagnosticsParams {
+	c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "yaml", "version": 1, "text": text},
+	})
+	return c.diagnostics()
+}
+
+func position(uri string, line int, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+const config = `defaults: &defaults
+  timeout: 30
+  retries: 3
+service:
+  <<: *defaults
+  enabled: yes
+  name: café
+  name: api
+`
+
+func TestServer_lifecycle(t *testing.T) {
+	c := newClient(t, NewServer())
+
+	var result initializeResult
+	assert.Nil(t, c.call("initialize", map[string]any{"capabilities": map[string]any{}}, &result))
+	assert.True(t, result.Capabilities.HoverProvider)
+	assert.True(t, result.Capabilities.DefinitionProvider)
+	assert.Equal(t, textDocumentSyncFull, result.Capabilities.TextDocumentSync.Change)
+	c.notify("initialized", map[string]any{})
+
+	rpcErr := c.call("textDocument/formatting", map[string]any{}, nil)
+	if assert.NotNil(t, rpcErr) {
+		assert.Equal(t, codeMethodNotFound, rpcErr.Code)
+	}
+
+	assert.Nil(t, c.call("shutdown", nil, nil))
+	c.notify("exit", nil)
+	select {
+	case err := <-c.done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't exit")
+	}
+}
+
+func TestServer_diagnostics(t *testing.T) {
+	c := newClient(t, NewServer())
+	assert.Nil(t, c.call("initialize", map[string]any{}, nil))
+
+	published := c.open("file:///config.yaml", config)
+	assert.Equal(t, "file:///config.yaml", published.URI)
+	assert.Equal(t, 1, published.Version)
+	if assert.Len(t, published.Diagnostics, 2) {
+		yaml11 := published.Diagnostics[0]
+		assert.Equal(t, "yaml11", yaml11.Code)
+		assert.Equal(t, SeverityWarning, yaml11.Severity)
+		assert.Equal(t, "yay", yaml11.Source)
+		assert.Equal(t, Range{Start: Position{Line: 5, Character: 11}, End: Position{Line: 5, Character: 14}}, yaml11.Range)
+
+		duplicate := published.Diagnostics[1]
+		assert.Equal(t, "duplicate-keys", duplicate.Code)
+		assert.Contains(t, duplicate.Message, `duplicate key "name"`)
+		assert.Equal(t, Range{Start: Position{Line: 7, Character: 2}, End: Position{Line: 7, Character: 6}}, duplicate.Range)
+	}
+
+	// ranges are in UTF-16 code units, following the multi-byte é
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": "file:///config.yaml", "version": 2},
+		"contentChanges": []map[string]any{{"text": "name: café\nenabled: on # yay:ignore yaml11\nflag: off\n"}},
+	})
+	published = c.diagnostics()
+	assert.Equal(t, 2, published.Version)
+	if assert.Len(t, published.Diagnostics, 1) {
+		assert.Equal(t, Range{Start: Position{Line: 2, Character: 6}, End: Position{Line: 2, Character: 9}}, published.Diagnostics[0].Range)
+	}
+
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": "file:///config.yaml", "version": 3},
+		"contentChanges": []map[string]any{{"text": "a: 1\nb: [\n"}},
+	})
+	published = c.diagnostics()
+	if assert.Len(t, published.Diagnostics, 1) {
+		assert.Equal(t, SeverityError, published.Diagnostics[0].Severity)
+		assert.Equal(t, 1, published.Diagnostics[0].Range.Start.Line)
+		assert.NotContains(t, published.Diagnostics[0].Message, "yaml: line")
+	}
+
+	c.notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": "file:///config.yaml"}})
+	published = c.diagnostics()
+	assert.Empty(t, published.Diagnostics)
+}
+
+func TestServer_withHandlers(t *testing.T) {
+	c := newClient(t, NewServer(
+		WithHandlers(func() []any { return []any{yay.NewDuplicateKeyHandler()} }),
+		WithSeverity(SeverityError),
+	))
+	published := c.open("file:///config.yaml", config)
+	if assert.Len(t, published.Diagnostics, 1) {
+		assert.Equal(t, "duplicate-keys", published.Diagnostics[0].Code)
+		assert.Equal(t, SeverityError, published.Diagnostics[0].Severity)
+	}
+}
+
+func TestServer_withModifyingHandlers(t *testing.T) {
+	c := newClient(t, NewServer(WithHandlers(func() []any {
+		return []any{yay.NewCanonicalHandler(), yay.NewDuplicateKeyHandler()}
+	})))
+	published := c.open("file:///config.yaml", config)
+	if assert.Len(t, published.Diagnostics, 1) {
+		assert.Equal(t, Range{Start: Position{Line: 7, Character: 2}, End: Position{Line: 7, Character: 6}}, published.Diagnostics[0].Range)
+	}
+
+	// handlers visit copies, so the open document retains its aliases
+	var actual *Location
+	assert.Nil(t, c.call("textDocument/definition", position("file:///config.yaml", 4, 7), &actual))
+	if assert.NotNil(t, actual) {
+		assert.Equal(t, 0, actual.Range.Start.Line)
+	}
+}
+
+func TestServer_hover(t *testing.T) {
+	c := newClient(t, NewServer())
+	c.open("file:///config.yaml", config)
+
+	tests := map[string]struct {
+		line      int
+		character int
+		expected  *Hover
+	}{
+		"shows the path of keys": {
+			line: 1, character: 3,
+			expected: &Hover{
+				Contents: MarkupContent{Kind: "markdown", Value: "`$.defaults.timeout`"},
+				Range:    &Range{Start: Position{Line: 1, Character: 2}, End: Position{Line: 1, Character: 9}},
+			},
+		},
+		"resolves aliases": {
+			line: 4, character: 7,
+			expected: &Hover{
+				Contents: MarkupContent{Kind: "markdown", Value: "`$.service['<<']`\n\n```yaml\ntimeout: 30\nretries: 3\n```"},
+				Range:    &Range{Start: Position{Line: 4, Character: 6}, End: Position{Line: 4, Character: 15}},
+			},
+		},
+		"resolves merge keys": {
+			line: 3, character: 2,
+			expected: &Hover{
+				Contents: MarkupContent{Kind: "markdown", Value: "`$.service`\n\n```yaml\ntimeout: 30\nretries: 3\nenabled: yes\nname: café\nname: api\n```"},
+				Range:    &Range{Start: Position{Line: 3, Character: 0}, End: Position{Line: 3, Character: 7}},
+			},
+		},
+		"counts characters in UTF-16 code units": {
+			line: 6, character: 9,
+			expected: &Hover{
+				Contents: MarkupContent{Kind: "markdown", Value: "`$.service.name`"},
+				Range:    &Range{Start: Position{Line: 6, Character: 8}, End: Position{Line: 6, Character: 12}},
+			},
+		},
+		"returns nothing outside of nodes": {line: 20, character: 0},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var actual *Hover
+			assert.Nil(t, c.call("textDocument/hover", position("file:///config.yaml", tt.line, tt.character), &actual))
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestServer_definition(t *testing.T) {
+	c := newClient(t, NewServer())
+	c.open("file:///config.yaml", config)
+
+	var actual *Location
+	assert.Nil(t, c.call("textDocument/definition", position("file:///config.yaml", 4, 8), &actual))
+	assert.Equal(t, &Location{
+		URI:   "file:///config.yaml",
+		Range: Range{Start: Position{Line: 0, Character: 10}, End: Position{Line: 2, Character: 12}},
+	}, actual)
+
+	actual = nil
+	assert.Nil(t, c.call("textDocument/definition", position("file:///config.yaml", 1, 3), &actual))
+	assert.Nil(t, actual)
+
+	assert.Nil(t, c.call("textDocument/definition", position("file:///unknown.yaml", 1, 3), &actual))
+	assert.Nil(t, actual)
+}
@@ -0,0 +1,235 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Ensure middlewareHandler implements all Visits* interfaces
+var _ VisitsDocumentNode = (*middlewareHandler)(nil)
+var _ VisitsSequenceNode = (*middlewareHandler)(nil)
+var _ VisitsMappingNode = (*middlewareHandler)(nil)
+var _ VisitsScalarNode = (*middlewareHandler)(nil)
+var _ VisitsAliasNode = (*middlewareHandler)(nil)
+var _ VisitsMappingKey = (*middlewareHandler)(nil)
+
+// ErrHandlerPanic is wrapped by errors reported by RecoveryMiddleware for handlers which panicked
+var ErrHandlerPanic = errors.New("handler panicked")
+
+// HandlerCall describes the invocation of a handler method by a Visitor
+type HandlerCall struct {
+	// Handler is the handler passed to the Visitor
+	Handler any
+	// Method is the name of the invoked method, e.g. VisitScalarNode
+	Method string
+	// Key is the key argument of the method, which is nil for sequence items and the document's root node
+	Key *yaml.Node
+	// Value is the value argument of the method, or the document node for VisitDocumentNode
+	Value *yaml.Node
+	t     *traversal
+}
+
+// Node returns the node the call is positioned at: the key for VisitMappingKey, otherwise the value
+func (c HandlerCall) Node() *yaml.Node {
+	if c.Method == "VisitMappingKey" {
+		return c.Key
+	}
+	return c.Value
+}
+
+// Path returns the [yamlpath] expression selecting the visited node, or an empty string if the node has no
+// well-defined path, such as the document node itself, or nodes visited without a document.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func (c HandlerCall) Path() string {
+	if c.t == nil {
+		return ""
+	}
+	return c.t.path()
+}
+
+// HandlerFunc invokes the handler method described by call
+type HandlerFunc func(ctx context.Context, call HandlerCall) error
+
+// Middleware wraps each handler method invoked by a Visitor, and must invoke next to continue to the handler
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// middlewareHandler invokes the methods of handler through its middleware chain
+type middlewareHandler struct {
+	handler any
+	invoke  HandlerFunc
+}
+
+func newMiddlewareHandler(handler any, middleware []Middleware) *middlewareHandler {
+	invoke := HandlerFunc(invokeHandler)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		invoke = middleware[i](invoke)
+	}
+	return &middlewareHandler{handler: handler, invoke: invoke}
+}
+
+// invokeHandler is the innermost HandlerFunc, invoking the method of the handler
+func invokeHandler(ctx context.Context, call HandlerCall) error {
+	switch call.Method {
+	case "VisitDocumentNode":
+		return call.Handler.(VisitsDocumentNode).VisitDocumentNode(ctx, call.Value)
+	case "VisitSequenceNode":
+		return call.Handler.(VisitsSequenceNode).VisitSequenceNode(ctx, call.Key, call.Value)
+	case "VisitMappingNode":
+		return call.Handler.(VisitsMappingNode).VisitMappingNode(ctx, call.Key, call.Value)
+	case "VisitScalarNode":
+		return call.Handler.(VisitsScalarNode).VisitScalarNode(ctx, call.Key, call.Value)
+	case "VisitAliasNode":
+		return call.Handler.(VisitsAliasNode).VisitAliasNode(ctx, call.Key, call.Value)
+	case "VisitMappingKey":
+		return call.Handler.(VisitsMappingKey).VisitMappingKey(ctx, call.Key, call.Value)
+	}
+	return fmt.Errorf("unknown handler method %s", call.Method)
+}
+
+func (m *middlewareHandler) call(ctx context.Context, method string, key *yaml.Node, value *yaml.Node) error {
+	t, _ := traversalFrom(ctx)
+	return m.invoke(ctx, HandlerCall{Handler: m.handler, Method: method, Key: key, Value: value, t: t})
+}
+
+// VisitDocumentNode satisfies VisitsDocumentNode, invoking the handler's method through the middleware chain if implemented
+func (m *middlewareHandler) VisitDocumentNode(ctx context.Context, key *yaml.Node) error {
+	if _, ok := m.handler.(VisitsDocumentNode); !ok {
+		return nil
+	}
+	return m.call(ctx, "VisitDocumentNode", nil, key)
+}
+
+// VisitSequenceNode satisfies VisitsSequenceNode, invoking the handler's method through the middleware chain if implemented
+func (m *middlewareHandler) VisitSequenceNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	if _, ok := m.handler.(VisitsSequenceNode); !ok {
+		return nil
+	}
+	return m.call(ctx, "VisitSequenceNode", key, value)
+}
+
+// VisitMappingNode satisfies VisitsMappingNode, invoking the handler's method through the middleware chain if implemented
+func (m *middlewareHandler) VisitMappingNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	if _, ok := m.handler.(VisitsMappingNode); !ok {
+		return nil
+	}
+	return m.call(ctx, "VisitMappingNode", key, value)
+}
+
+// VisitScalarNode satisfies VisitsScalarNode, invoking the handler's method through the middleware chain if implemented
+func (m *middlewareHandler) VisitScalarNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	if _, ok := m.handler.(VisitsScalarNode); !ok {
+		return nil
+	}
+	return m.call(ctx, "VisitScalarNode", key, value)
+}
+
+// VisitAliasNode satisfies VisitsAliasNode, invoking the handler's method through the middleware chain if implemented
+func (m *middlewareHandler) VisitAliasNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	if _, ok := m.handler.(VisitsAliasNode); !ok {
+		return nil
+	}
+	return m.call(ctx, "VisitAliasNode", key, value)
+}
+
+// VisitMappingKey satisfies VisitsMappingKey, invoking the handler's method through the middleware chain if implemented
+func (m *middlewareHandler) VisitMappingKey(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	if _, ok := m.handler.(VisitsMappingKey); !ok {
+		return nil
+	}
+	return m.call(ctx, "VisitMappingKey", key, value)
+}
+
+// unwrapHandler returns the handler passed by the user, which may have been wrapped by middleware
+func unwrapHandler(handler any) any {
+	if m, ok := handler.(*middlewareHandler); ok {
+		return m.handler
+	}
+	return handler
+}
+
+// RecoveryMiddleware converts a panic within a handler into a NodeError positioned at the visited node, wrapping
+// ErrHandlerPanic. The panic is reported as an error of the Visitor, and the descendants of the node aren't visited.
+func RecoveryMiddleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, call HandlerCall) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					location := ""
+					if path := call.Path(); path != "" {
+						location = " at " + path
+					}
+					err = &NodeError{
+						Node: call.Node(),
+						Err:  fmt.Errorf("%w: %T.%s%s: %v", ErrHandlerPanic, call.Handler, call.Method, location, r),
+					}
+				}
+			}()
+			return next(ctx, call)
+		}
+	}
+}
+
+// LoggingMiddleware logs each handler call to logger, or slog.Default if nil: at debug level for successful calls,
+// and at error level for calls returning an error.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, call HandlerCall) error {
+			log := logger
+			if log == nil {
+				log = slog.Default()
+			}
+			start := time.Now()
+			err := next(ctx, call)
+			attrs := []slog.Attr{
+				slog.String("handler", fmt.Sprintf("%T", call.Handler)),
+				slog.String("method", call.Method),
+				slog.String("path", call.Path()),
+			}
+			if node := call.Node(); node != nil {
+				attrs = append(attrs, slog.Int("line", node.Line), slog.Int("column", node.Column))
+			}
+			attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+			if err != nil {
+				log.LogAttrs(ctx, slog.LevelError, "yay handler failed", append(attrs, slog.Any("error", err))...)
+			} else {
+				log.LogAttrs(ctx, slog.LevelDebug, "yay handler", attrs...)
+			}
+			return err
+		}
+	}
+}
+
+// HandlerTiming is the duration of a handler call, reported by TimingMiddleware
+type HandlerTiming struct {
+	// Handler is the type of the handler, e.g. *yay.ConditionalHandler
+	Handler string
+	// Method is the name of the invoked method, e.g. VisitScalarNode
+	Method string
+	// Path is the path of the visited node, see HandlerCall.Path
+	Path     string
+	Duration time.Duration
+}
+
+// TimingMiddleware reports the duration of each handler call to report, which may aggregate timings by handler and
+// path. report is invoked synchronously from the Visitor.
+func TimingMiddleware(report func(timing HandlerTiming)) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, call HandlerCall) error {
+			start := time.Now()
+			err := next(ctx, call)
+			report(HandlerTiming{
+				Handler:  fmt.Sprintf("%T", call.Handler),
+				Method:   call.Method,
+				Path:     call.Path(),
+				Duration: time.Since(start),
+			})
+			return err
+		}
+	}
+}
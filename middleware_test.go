@@ -0,0 +1,144 @@
+package yay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+const middlewareSource = `name: demo
+items:
+  - boom
+  - ok
+`
+
+func panickingHandler(t *testing.T) *ConditionalHandler {
+	handler, err := NewConditionalHandler(
+		OnVisitScalarNode("$..*", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+			if value.Value == "boom" {
+				panic("unexpected value")
+			}
+			return nil
+		}),
+	)
+	assert.NoError(t, err)
+	return handler
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(middlewareSource), &doc))
+
+	visited := make([]string, 0)
+	collector, err := NewConditionalHandler(
+		OnVisitScalarNode("$..*", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+			visited = append(visited, value.Value)
+			return nil
+		}),
+	)
+	assert.NoError(t, err)
+
+	v, err := NewVisitorWithOptions(NewOptions().WithMiddleware(RecoveryMiddleware()), panickingHandler(t), collector)
+	assert.NoError(t, err)
+	err = v.Visit(context.Background(), &doc)
+
+	assert.ErrorIs(t, err, ErrHandlerPanic)
+	assert.EqualError(t, err, "3:5: handler panicked: *yay.ConditionalHandler.VisitScalarNode at $.items[0]: unexpected value")
+	nodeErrors := NodeErrors(err)
+	if assert.Len(t, nodeErrors, 1) {
+		assert.Equal(t, "boom", nodeErrors[0].Node.Value)
+	}
+	assert.Equal(t, []string{"demo", "boom", "ok"}, visited)
+
+	v, err = NewVisitor(panickingHandler(t))
+	assert.NoError(t, err)
+	assert.Panics(t, func() { _ = v.Visit(context.Background(), &doc) })
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("name: demo"), &doc))
+
+	failing, err := NewConditionalHandler(
+		OnVisitScalarNode("$.name", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+			return errors.New("invalid name")
+		}),
+	)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	v, err := NewVisitorWithOptions(NewOptions().WithMiddleware(LoggingMiddleware(logger)), failing)
+	assert.NoError(t, err)
+	assert.EqualError(t, v.Visit(context.Background(), &doc), "invalid name")
+
+	assert.Equal(t, []string{
+		`level=DEBUG msg="yay handler" handler=*yay.ConditionalHandler method=VisitDocumentNode path="" line=1 column=1`,
+		`level=DEBUG msg="yay handler" handler=*yay.ConditionalHandler method=VisitMappingKey path=$.name line=1 column=1`,
+		`level=ERROR msg="yay handler failed" handler=*yay.ConditionalHandler method=VisitScalarNode path=$.name line=1 column=7 error="invalid name"`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
+
+func TestTimingMiddleware(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(middlewareSource), &doc))
+
+	timings := make([]string, 0)
+	v, err := NewVisitorWithOptions(NewOptions().WithMiddleware(TimingMiddleware(func(timing HandlerTiming) {
+		assert.GreaterOrEqual(t, timing.Duration.Nanoseconds(), int64(0))
+		timings = append(timings, timing.Handler+" "+timing.Method+" "+timing.Path)
+	})), NewYAML11Handler(), NewDuplicateKeyHandler())
+	assert.NoError(t, err)
+	assert.NoError(t, v.Visit(context.Background(), &doc))
+
+	assert.Equal(t, []string{
+		"*yay.duplicateKeyHandler VisitDocumentNode ",
+		"*yay.yaml11Handler VisitMappingKey $.name",
+		"*yay.yaml11Handler VisitScalarNode $.name",
+		"*yay.yaml11Handler VisitMappingKey $.items",
+		"*yay.yaml11Handler VisitScalarNode $.items[0]",
+		"*yay.yaml11Handler VisitScalarNode $.items[1]",
+	}, timings)
+}
+
+func TestWithMiddleware(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("enabled: yes # yay:ignore yaml11\nother: on"), &doc))
+
+	calls := make([]string, 0)
+	record := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, call HandlerCall) error {
+				calls = append(calls, name+" "+call.Method+" "+call.Path())
+				return next(ctx, call)
+			}
+		}
+	}
+
+	v, err := NewVisitorWithOptions(NewOptions().WithMiddleware(record("outer")).WithMiddleware(record("inner")), NewYAML11Handler())
+	assert.NoError(t, err)
+	err = v.Visit(context.Background(), &doc)
+
+	// suppressed handlers are skipped without invoking middleware
+	assert.Equal(t, []string{
+		"outer VisitMappingKey $.other",
+		"inner VisitMappingKey $.other",
+		"outer VisitScalarNode $.other",
+		"inner VisitScalarNode $.other",
+	}, calls)
+	assert.Len(t, NodeErrors(err), 1)
+}
@@ -3,6 +3,7 @@ package yay
 type opts struct {
 	initialized       bool
 	skipDocumentCheck bool
+	middleware        []Middleware
 }
 
 // FnOptions is a function chain of options to apply conditionally to a Visitor
@@ -17,6 +18,18 @@ func (fn FnOptions) WithSkipDocumentCheck(val bool) FnOptions {
 	}
 }
 
+// WithMiddleware configures a Visitor to invoke each method of each handler through middleware, for example:
+//
+//	yay.NewOptions().WithMiddleware(yay.RecoveryMiddleware(), yay.LoggingMiddleware(logger))
+//
+// Middleware is applied in the order provided, so the first wraps all others. Repeated calls append middleware.
+func (fn FnOptions) WithMiddleware(middleware ...Middleware) FnOptions {
+	return func(o *opts) {
+		fn(o)
+		o.middleware = append(o.middleware, middleware...)
+	}
+}
+
 // NewOptions creates a new options functional builder with discoverable functions that don't pollute the yay package
 //
 //goland:noinspection GoExportedFuncWithUnexportedType
@@ -10,16 +10,26 @@ import (
 
 // PathMatcher collects information internally to wrap yamlpath.Path for optimized key/value matching during iteration.
 // A user-facing PathMatcher.Match can be invoked on a node's children to determine if they also match the condition.
+//
+// When invoked during a visit on the current node or one of its children, matching is evaluated incrementally against the
+// visitor's position within the document. Expressions or documents which require lookahead (for example, filters
+// referring to the root node, aliases, or merge keys) fall back to finding all matches from the root node.
 type PathMatcher struct {
-	rawPath string
-	path    *yamlpath.Path
-	root    *yaml.Node
-	matches map[*yaml.Node]struct{}
-	mu      sync.Mutex
+	rawPath   string
+	path      *yamlpath.Path
+	compiled  *compiledPath
+	root      *yaml.Node
+	traversal *traversal
+	matches   map[*yaml.Node]struct{}
+	mu        sync.Mutex
 }
 
 // Match determines if a node matches the yamlpath.Path condition provided by the user
 func (p *PathMatcher) Match(node *yaml.Node) (bool, error) {
+	if frames, ok := p.incrementalFrames(node); ok {
+		return p.compiled.Match(frames), nil
+	}
+
 	err := p.ensureMatchLookup()
 	if err != nil {
 		return false, fmt.Errorf("path matcher lookup failed: %w", err)
@@ -46,6 +56,15 @@ func (p *PathMatcher) MustMatch(node *yaml.Node) bool {
 	return result
 }
 
+// incrementalFrames returns the traversal frames for node if the path can be evaluated incrementally
+func (p *PathMatcher) incrementalFrames(node *yaml.Node) ([]frame, bool) {
+	t := p.traversal
+	if p.compiled == nil || t == nil || t.root != p.root || !t.isSimple() {
+		return nil, false
+	}
+	return t.framesFor(node)
+}
+
 func (p *PathMatcher) ensureMatchLookup() error {
 	if p.matches == nil {
 		p.mu.Lock()
@@ -64,10 +83,19 @@ func (p *PathMatcher) ensureMatchLookup() error {
 	return nil
 }
 
+// resetRoot binds the matcher to a new root node, forcing re-evaluation of the path for alias/anchor lookups
+func (p *PathMatcher) resetRoot(root *yaml.Node) {
+	p.root = root
+	p.matches = nil
+	p.path, _ = yamlpath.NewPathWithRoot(p.rawPath, root)
+}
+
 func newPathMatcher(path string) (*PathMatcher, error) {
 	yp, err := yamlpath.NewPath(path)
 	if err != nil {
 		return nil, err
 	}
-	return &PathMatcher{rawPath: path, path: yp}, nil
+	// unsupported expressions are left uncompiled, and are always evaluated via yamlpath.Path.Find
+	compiled, _ := compilePath(path)
+	return &PathMatcher{rawPath: path, path: yp, compiled: compiled}, nil
 }
@@ -0,0 +1,440 @@
+package yay
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	_ VisitsDocumentNode = (*positionHandler)(nil)
+	_ VisitsSequenceNode = (*positionHandler)(nil)
+	_ VisitsMappingNode  = (*positionHandler)(nil)
+	_ VisitsScalarNode   = (*positionHandler)(nil)
+	_ VisitsAliasNode    = (*positionHandler)(nil)
+)
+
+// Position is a location within a source document. Line and Column are 1-based and count characters as
+// yaml.Node.Line and yaml.Node.Column do, while Offset is the 0-based byte offset.
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+// Range is the source text of a node, from Start inclusive to End exclusive
+type Range struct {
+	Start Position
+	End   Position
+}
+
+// Contains determines whether the range contains offset. An empty range contains only its start.
+func (r Range) Contains(offset int) bool {
+	if r.Start.Offset == r.End.Offset {
+		return offset == r.Start.Offset
+	}
+	return offset >= r.Start.Offset && offset < r.End.Offset
+}
+
+// Location describes a node of an indexed document
+type Location struct {
+	// Node is the located node, which is either Key or Value
+	Node *yaml.Node
+	// Key is the mapping key of the entry, or nil for sequence items and the document's root node
+	Key *yaml.Node
+	// Value is the value of the entry
+	Value *yaml.Node
+	// Path is the yamlpath expression selecting Value, e.g. $.spec.containers[0].image
+	Path string
+	// Range is the source range of Node
+	Range Range
+}
+
+// PositionIndex maps positions within a source document to the nodes parsed from it, and nodes to their source range.
+// See NewPositionIndex.
+type PositionIndex struct {
+	source []byte
+	// lineStarts are the offsets at which each line begins
+	lineStarts []int
+	// locations are ordered by their start offset, with enclosing locations preceding those they enclose
+	locations []Location
+	// parents are the indexes of the innermost locations enclosing each location, or -1
+	parents []int
+	nodes   map[*yaml.Node]Location
+	ranges  map[*yaml.Node]Range
+}
+
+// NewPositionIndex indexes doc, a document node decoded from source. The source may contain multiple documents, in
+// which case doc may be any one of them.
+func NewPositionIndex(source []byte, doc *yaml.Node) (*PositionIndex, error) {
+	index := &PositionIndex{
+		source:     source,
+		lineStarts: []int{0},
+		nodes:      make(map[*yaml.Node]Location),
+		ranges:     make(map[*yaml.Node]Range),
+	}
+	for i, b := range source {
+		if b == '\n' {
+			index.lineStarts = append(index.lineStarts, i+1)
+		}
+	}
+
+	v, err := NewVisitor(&positionHandler{index: index})
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Visit(context.Background(), doc); err != nil {
+		return nil, err
+	}
+	index.sort()
+	return index, nil
+}
+
+// sort orders the locations by their start offset, and relates each to the innermost location enclosing it
+func (p *PositionIndex) sort() {
+	// locations are visited parent first, so a stable sort retains descendants after ancestors of the same range
+	sort.SliceStable(p.locations, func(i, j int) bool {
+		a, b := p.locations[i].Range, p.locations[j].Range
+		if a.Start.Offset != b.Start.Offset {
+			return a.Start.Offset < b.Start.Offset
+		}
+		return a.End.Offset > b.End.Offset
+	})
+
+	p.parents = make([]int, len(p.locations))
+	enclosing := make([]int, 0)
+	for i, loc := range p.locations {
+		for len(enclosing) > 0 && !encloses(p.locations[enclosing[len(enclosing)-1]].Range, loc.Range) {
+			enclosing = enclosing[:len(enclosing)-1]
+		}
+		p.parents[i] = -1
+		if len(enclosing) > 0 {
+			p.parents[i] = enclosing[len(enclosing)-1]
+		}
+		enclosing = append(enclosing, i)
+	}
+}
+
+// encloses determines whether outer contains all of inner. An empty range encloses nothing.
+func encloses(outer Range, inner Range) bool {
+	return outer.Start.Offset < outer.End.Offset && outer.Start.Offset <= inner.Start.Offset && inner.End.Offset <= outer.End.Offset
+}
+
+// At returns the innermost node at the 1-based line and column, which may be a mapping key
+func (p *PositionIndex) At(line int, column int) (Location, bool) {
+	offset, ok := p.offset(line, column)
+	if !ok {
+		return Location{}, false
+	}
+
+	// the last location starting at or before offset is the innermost candidate, otherwise one of its ancestors
+	i := sort.Search(len(p.locations), func(i int) bool {
+		return p.locations[i].Range.Start.Offset > offset
+	}) - 1
+	for i >= 0 && !p.locations[i].Range.Contains(offset) {
+		i = p.parents[i]
+	}
+	if i < 0 {
+		return Location{}, false
+	}
+	return p.locations[i], true
+}
+
+// Locate returns the location of node, which may be a mapping key
+func (p *PositionIndex) Locate(node *yaml.Node) (Location, bool) {
+	loc, ok := p.nodes[node]
+	return loc, ok
+}
+
+// Range returns the source range of node. The range of a document node is the range of its root node.
+func (p *PositionIndex) Range(node *yaml.Node) (Range, bool) {
+	if node == nil {
+		return Range{}, false
+	}
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return Range{}, false
+		}
+		return p.Range(node.Content[0])
+	}
+	if node.Line == 0 {
+		// constructed nodes have no source position
+		return Range{}, false
+	}
+	if r, ok := p.ranges[node]; ok {
+		return r, true
+	}
+	start, ok := p.offset(node.Line, node.Column)
+	if !ok {
+		return Range{}, false
+	}
+	r := Range{Start: p.position(start), End: p.position(p.end(node, start))}
+	p.ranges[node] = r
+	return r, true
+}
+
+// add indexes the entry of key and value
+func (p *PositionIndex) add(key *yaml.Node, value *yaml.Node, path string) {
+	if key != nil {
+		p.addLocation(Location{Node: key, Key: key, Value: value, Path: path})
+	}
+	p.addLocation(Location{Node: value, Key: key, Value: value, Path: path})
+}
+
+// addLocation indexes loc, if its node has a source range. A node indexed more than once is located at its first entry.
+func (p *PositionIndex) addLocation(loc Location) {
+	r, ok := p.Range(loc.Node)
+	if !ok {
+		return
+	}
+	loc.Range = r
+	p.locations = append(p.locations, loc)
+	if _, ok := p.nodes[loc.Node]; !ok {
+		p.nodes[loc.Node] = loc
+	}
+}
+
+// offset converts a 1-based line and column to a byte offset
+func (p *PositionIndex) offset(line int, column int) (int, bool) {
+	if line < 1 || line > len(p.lineStarts) || column < 1 {
+		return 0, false
+	}
+	offset := p.lineStarts[line-1]
+	for i := 1; i < column && offset < len(p.source); i++ {
+		_, size := utf8.DecodeRune(p.source[offset:])
+		offset += size
+	}
+	return offset, true
+}
+
+// position converts a byte offset to a Position
+func (p *PositionIndex) position(offset int) Position {
+	line := sort.Search(len(p.lineStarts), func(i int) bool {
+		return p.lineStarts[i] > offset
+	})
+	start := p.lineStarts[line-1]
+	return Position{Line: line, Column: utf8.RuneCount(p.source[start:offset]) + 1, Offset: offset}
+}
+
+// end computes the offset following the source text of node, which begins at start
+func (p *PositionIndex) end(node *yaml.Node, start int) int {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return min(start+1+len(node.Value), len(p.source))
+	case yaml.MappingNode, yaml.SequenceNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			return p.flowEnd(node, start)
+		}
+		end := start
+		for _, child := range node.Content {
+			if r, ok := p.Range(child); ok {
+				end = max(end, r.End.Offset)
+			}
+		}
+		return end
+	}
+
+	content, afterProperties := p.skipProperties(start)
+	switch {
+	case node.Style&yaml.DoubleQuotedStyle != 0:
+		for i := content + 1; i < len(p.source); i++ {
+			switch p.source[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1
+			}
+		}
+		return len(p.source)
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		for i := content + 1; i < len(p.source); i++ {
+			if p.source[i] != '\'' {
+				continue
+			}
+			if i+1 < len(p.source) && p.source[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+		return len(p.source)
+	case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		return p.blockScalarEnd(content)
+	}
+
+	// plain scalars are folded across lines without altering their words, so the last word ends the scalar
+	fields := strings.Fields(node.Value)
+	if len(fields) == 0 {
+		return afterProperties
+	}
+	end := content
+	for _, field := range fields {
+		i := bytes.Index(p.source[end:], []byte(field))
+		if i < 0 {
+			break
+		}
+		end += i + len(field)
+	}
+	return end
+}
+
+// skipProperties skips the anchor and tag preceding a node's content, returning the offset of the content and the
+// offset following the last property
+func (p *PositionIndex) skipProperties(offset int) (int, int) {
+	afterProperties := offset
+	for offset < len(p.source) && (p.source[offset] == '&' || p.source[offset] == '!') {
+		if bytes.HasPrefix(p.source[offset:], []byte("!<")) {
+			if i := bytes.IndexByte(p.source[offset:], '>'); i >= 0 {
+				offset += i + 1
+			}
+		}
+		for offset < len(p.source) && !isBlank(p.source[offset]) {
+			offset++
+		}
+		afterProperties = offset
+		offset = p.skipSpace(offset)
+	}
+	return offset, afterProperties
+}
+
+// skipSpace skips whitespace, line breaks, and comments
+func (p *PositionIndex) skipSpace(offset int) int {
+	for offset < len(p.source) {
+		switch {
+		case isBlank(p.source[offset]):
+			offset++
+		case p.source[offset] == '#':
+			for offset < len(p.source) && p.source[offset] != '\n' {
+				offset++
+			}
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// flowEnd finds the offset following the bracket which closes the flow collection beginning at start
+func (p *PositionIndex) flowEnd(node *yaml.Node, start int) int {
+	closing := byte(']')
+	if node.Kind == yaml.MappingNode {
+		closing = '}'
+	}
+
+	offset, _ := p.skipProperties(start)
+	offset++
+	for _, child := range node.Content {
+		if r, ok := p.Range(child); ok {
+			offset = max(offset, r.End.Offset)
+		}
+	}
+	for offset < len(p.source) {
+		offset = p.skipSpace(offset)
+		if offset >= len(p.source) {
+			break
+		}
+		if p.source[offset] == closing {
+			return offset + 1
+		}
+		offset++
+	}
+	return len(p.source)
+}
+
+// blockScalarEnd finds the offset following the last non-empty line of the literal or folded scalar whose header
+// begins at offset
+func (p *PositionIndex) blockScalarEnd(offset int) int {
+	headerEnd := offset + 1
+	for headerEnd < len(p.source) && strings.IndexByte("+-0123456789", p.source[headerEnd]) >= 0 {
+		headerEnd++
+	}
+
+	lineEnd := func(start int) int {
+		if i := bytes.IndexByte(p.source[start:], '\n'); i >= 0 {
+			return start + i
+		}
+		return len(p.source)
+	}
+	indentation := func(start int) int {
+		n := 0
+		for start+n < len(p.source) && p.source[start+n] == ' ' {
+			n++
+		}
+		return n
+	}
+
+	// content must be indented further than the line containing the header
+	headerLine := p.position(offset).Line
+	minimum := indentation(p.lineStarts[headerLine-1]) + 1
+	end := headerEnd
+	contentIndentation := 0
+	for line := headerLine; line < len(p.lineStarts); line++ {
+		start := p.lineStarts[line]
+		stop := lineEnd(start)
+		if len(bytes.TrimSpace(p.source[start:stop])) == 0 {
+			continue
+		}
+		indent := indentation(start)
+		if contentIndentation == 0 {
+			if indent < minimum {
+				break
+			}
+			contentIndentation = indent
+		}
+		if indent < contentIndentation {
+			break
+		}
+		end = stop
+	}
+	return end
+}
+
+// isBlank determines whether b is whitespace or a line break
+func isBlank(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// positionHandler indexes each visited node along with the path at which it was visited
+type positionHandler struct {
+	index *PositionIndex
+}
+
+// unsuppressible ensures nodes ignored by inline directives are still indexed
+func (h *positionHandler) unsuppressible() {}
+
+// VisitDocumentNode indexes the document's root node, as the visitor doesn't visit it
+func (h *positionHandler) VisitDocumentNode(_ context.Context, key *yaml.Node) error {
+	if len(key.Content) > 0 {
+		h.index.add(nil, key.Content[0], "$")
+	}
+	return nil
+}
+
+func (h *positionHandler) VisitSequenceNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return h.visit(ctx, key, value)
+}
+
+func (h *positionHandler) VisitMappingNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return h.visit(ctx, key, value)
+}
+
+func (h *positionHandler) VisitScalarNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return h.visit(ctx, key, value)
+}
+
+func (h *positionHandler) VisitAliasNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return h.visit(ctx, key, value)
+}
+
+func (h *positionHandler) visit(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	path := ""
+	if t, ok := traversalFrom(ctx); ok {
+		path = t.path()
+	}
+	h.index.add(key, value, path)
+	return nil
+}
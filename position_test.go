@@ -0,0 +1,145 @@
+package yay
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+const positionSource = `name: &n !!str demo # comment
+empty:
+script: |
+  echo one
+  echo two
+
+flow: [1, 'it''s', {k: v}]
+items:
+  - *n
+  - "q\"z"
+  - plain
+    folded
+  - é: ü
+# yay:ignore
+ignored: true
+`
+
+func TestPositionIndex_At(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(positionSource), &doc))
+	index, err := NewPositionIndex([]byte(positionSource), &doc)
+	assert.NoError(t, err)
+
+	tests := map[string]struct {
+		line     int
+		column   int
+		path     string
+		value    string
+		isKey    bool
+		notFound bool
+	}{
+		"finds keys":                            {line: 1, column: 2, path: "$.name", value: "name", isKey: true},
+		"finds scalars with properties":         {line: 1, column: 7, path: "$.name", value: "demo"},
+		"finds the content of scalars":          {line: 1, column: 16, path: "$.name", value: "demo"},
+		"finds the root after a scalar":         {line: 1, column: 20, path: "$", value: ""},
+		"finds empty scalars":                   {line: 2, column: 7, path: "$.empty", value: ""},
+		"finds block scalars":                   {line: 5, column: 5, path: "$.script", value: "echo one\necho two\n"},
+		"finds flow items":                      {line: 7, column: 12, path: "$.flow[1]", value: "it's"},
+		"finds nested flow keys":                {line: 7, column: 21, path: "$.flow[2].k", value: "k", isKey: true},
+		"finds flow collections":                {line: 7, column: 26, path: "$.flow", value: ""},
+		"finds aliases":                         {line: 9, column: 6, path: "$.items[0]", value: "n"},
+		"finds double quoted scalars":           {line: 10, column: 9, path: "$.items[1]", value: "q\"z"},
+		"finds folded plain scalars":            {line: 12, column: 6, path: "$.items[2]", value: "plain folded"},
+		"counts columns in characters":          {line: 13, column: 8, path: "$.items[3].é", value: "ü"},
+		"finds sequences":                       {line: 9, column: 3, path: "$.items", value: ""},
+		"indexes nodes ignored by directives":   {line: 15, column: 11, path: "$.ignored", value: "true"},
+		"returns nothing for positions outside": {line: 30, column: 1, notFound: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			loc, ok := index.At(tt.line, tt.column)
+			if tt.notFound {
+				assert.False(t, ok)
+				return
+			}
+			if assert.True(t, ok) {
+				assert.Equal(t, tt.path, loc.Path)
+				assert.Equal(t, tt.value, loc.Node.Value)
+				assert.Equal(t, tt.isKey, loc.Node == loc.Key)
+			}
+		})
+	}
+}
+
+func TestPositionIndex_At_innermost(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(positionSource), &doc))
+	index, err := NewPositionIndex([]byte(positionSource), &doc)
+	assert.NoError(t, err)
+
+	// the binary search agrees with the smallest range containing each position
+	for line, text := range strings.Split(positionSource, "\n") {
+		for column := 1; column <= utf8.RuneCountInString(text)+1; column++ {
+			offset, _ := index.offset(line+1, column)
+			var expected *Location
+			for i, loc := range index.locations {
+				if loc.Range.Contains(offset) && (expected == nil || loc.Range.End.Offset-loc.Range.Start.Offset <= expected.Range.End.Offset-expected.Range.Start.Offset) {
+					expected = &index.locations[i]
+				}
+			}
+			actual, ok := index.At(line+1, column)
+			if expected == nil {
+				assert.False(t, ok, "%d:%d", line+1, column)
+				continue
+			}
+			if assert.True(t, ok, "%d:%d", line+1, column) {
+				assert.Same(t, expected.Node, actual.Node, "%d:%d", line+1, column)
+			}
+		}
+	}
+}
+
+func TestPositionIndex_Range(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(positionSource), &doc))
+	index, err := NewPositionIndex([]byte(positionSource), &doc)
+	assert.NoError(t, err)
+
+	text := func(path string) string {
+		var node *yaml.Node
+		for _, l := range index.locations {
+			if l.Path == path && l.Node == l.Value {
+				node = l.Node
+				break
+			}
+		}
+		r, ok := index.Range(node)
+		assert.True(t, ok)
+		return positionSource[r.Start.Offset:r.End.Offset]
+	}
+
+	assert.Equal(t, "&n !!str demo", text("$.name"))
+	assert.Equal(t, "", text("$.empty"))
+	assert.Equal(t, "|\n  echo one\n  echo two", text("$.script"))
+	assert.Equal(t, "[1, 'it''s', {k: v}]", text("$.flow"))
+	assert.Equal(t, "{k: v}", text("$.flow[2]"))
+	assert.Equal(t, "*n", text("$.items[0]"))
+	assert.Equal(t, `"q\"z"`, text("$.items[1]"))
+	assert.Equal(t, "plain\n    folded", text("$.items[2]"))
+	assert.Equal(t, "- *n\n  - \"q\\\"z\"\n  - plain\n    folded\n  - é: ü", text("$.items"))
+	assert.Equal(t, positionSource[:len(positionSource)-1], text("$"))
+
+	r, ok := index.Range(&doc)
+	assert.True(t, ok)
+	assert.Equal(t, Position{Line: 1, Column: 1, Offset: 0}, r.Start)
+	assert.Equal(t, 15, r.End.Line)
+
+	loc, ok := index.Locate(doc.Content[0].Content[len(doc.Content[0].Content)-1])
+	assert.True(t, ok)
+	assert.Equal(t, Position{Line: 15, Column: 10, Offset: len(positionSource) - 5}, loc.Range.Start)
+
+	_, ok = index.Range(&yaml.Node{Kind: yaml.ScalarNode, Value: "constructed"})
+	assert.False(t, ok)
+}
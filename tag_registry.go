@@ -0,0 +1,120 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	_ VisitsSequenceNode = (*TagRegistry)(nil)
+	_ VisitsMappingNode  = (*TagRegistry)(nil)
+	_ VisitsScalarNode   = (*TagRegistry)(nil)
+	_ VisitsAliasNode    = (*TagRegistry)(nil)
+	_ VisitsMappingKey   = (*TagRegistry)(nil)
+)
+
+// longTagPrefix is the expanded form of the !! tag handle, see yaml.Node.ShortTag
+const longTagPrefix = "tag:yaml.org,2002:"
+
+// FnResolveTag resolves a tagged node to its replacement. Returning a nil node leaves the tagged node unmodified.
+type FnResolveTag func(ctx context.Context, key *yaml.Node, value *yaml.Node) (*yaml.Node, error)
+
+type tagRegistryOpt func(registry *TagRegistry)
+
+// OnTag registers fn to be invoked for any node carrying tag, such as !secret or !env.
+// Tags are compared by their short form, so OnTag("!!int", fn) is invoked for explicitly and implicitly tagged integers.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func OnTag(tag string, fn FnVisitKeyValueNode) tagRegistryOpt {
+	return func(registry *TagRegistry) {
+		tag = shortTag(tag)
+		registry.fnVisitTag[tag] = append(registry.fnVisitTag[tag], fn)
+	}
+}
+
+// ResolveTag registers fn to resolve any node carrying tag, replacing the tagged node in place with fn's result.
+// The replacement is then visited in place of the tagged node, so nodes nested within the result are also dispatched.
+// A result carrying the same tag isn't resolved again.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func ResolveTag(tag string, fn FnResolveTag) tagRegistryOpt {
+	return OnTag(tag, func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+		result, err := fn(ctx, key, value)
+		if err != nil || result == nil {
+			return err
+		}
+		*value = *result
+		return nil
+	})
+}
+
+// TagRegistry dispatches nodes to functions registered per tag, regardless of the node's kind or whether it's a
+// mapping key or value. This avoids inspecting yaml.Node.Tag within every handler when processing custom tags.
+type TagRegistry struct {
+	fnVisitTag map[string][]FnVisitKeyValueNode
+}
+
+// VisitSequenceNode satisfies VisitsSequenceNode such that a visitor always invokes this method, which defers to the handler passed by the user
+func (r *TagRegistry) VisitSequenceNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return r.dispatch(ctx, key, value)
+}
+
+// VisitMappingNode satisfies VisitsMappingNode such that a visitor always invokes this method, which defers to the handler passed by the user
+func (r *TagRegistry) VisitMappingNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return r.dispatch(ctx, key, value)
+}
+
+// VisitScalarNode satisfies VisitsScalarNode such that a visitor always invokes this method, which defers to the handler passed by the user
+func (r *TagRegistry) VisitScalarNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return r.dispatch(ctx, key, value)
+}
+
+// VisitAliasNode satisfies VisitsAliasNode such that a visitor always invokes this method, which defers to the handler passed by the user
+func (r *TagRegistry) VisitAliasNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return r.dispatch(ctx, key, value)
+}
+
+// VisitMappingKey satisfies VisitsMappingKey such that tagged keys are dispatched along with tagged values.
+// The tagged key node is passed as both the key and value of the registered function.
+func (r *TagRegistry) VisitMappingKey(ctx context.Context, key *yaml.Node, _ *yaml.Node) error {
+	return r.dispatch(ctx, key, key)
+}
+
+func (r *TagRegistry) dispatch(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	tag := value.ShortTag()
+	var err error
+	for _, fn := range r.fnVisitTag[tag] {
+		// stop once an error occurs, or once the node has been resolved to a node with another tag
+		if err != nil || value.ShortTag() != tag {
+			break
+		}
+		err = fn(ctx, key, value)
+	}
+	return err
+}
+
+// NewTagRegistry creates a new TagRegistry, allowing the user to provide 1..n functions via OnTag or ResolveTag.
+// Functions registered for the same tag are invoked in the order provided, stopping at the first error.
+func NewTagRegistry(opts ...tagRegistryOpt) (*TagRegistry, error) {
+	if len(opts) == 0 {
+		return nil, errors.New("no tags registered, at least one is expected")
+	}
+	registry := &TagRegistry{
+		fnVisitTag: make(map[string][]FnVisitKeyValueNode),
+	}
+	for _, opt := range opts {
+		opt(registry)
+	}
+	return registry, nil
+}
+
+// shortTag normalizes tag to the form returned by yaml.Node.ShortTag
+func shortTag(tag string) string {
+	if strings.HasPrefix(tag, longTagPrefix) {
+		return "!!" + tag[len(longTagPrefix):]
+	}
+	return tag
+}
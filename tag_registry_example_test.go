@@ -0,0 +1,43 @@
+package yay_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jimschubert/yay"
+	"go.yaml.in/yaml/v3"
+)
+
+func ExampleNewTagRegistry() {
+	input := `---
+database:
+  user: !secret db-user
+  host: !upper localhost`
+
+	document := &yaml.Node{}
+	_ = yaml.Unmarshal([]byte(input), document)
+
+	secrets := map[string]string{"db-user": "admin"}
+	registry, _ := yay.NewTagRegistry(
+		yay.OnTag("!secret", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+			fmt.Printf("found secret reference at key=%s\n", key.Value)
+			return nil
+		}),
+		yay.ResolveTag("!secret", func(ctx context.Context, key *yaml.Node, value *yaml.Node) (*yaml.Node, error) {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: secrets[value.Value]}, nil
+		}),
+	)
+
+	visitor, _ := yay.NewVisitor(registry)
+	_ = visitor.Visit(context.TODO(), document)
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	_ = encoder.Encode(document)
+	// Output:
+	// found secret reference at key=user
+	// database:
+	//   user: admin
+	//   host: !upper localhost
+}
@@ -0,0 +1,142 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestTagRegistry(t *testing.T) {
+	mustCreate := func(t *testing.T, opts ...tagRegistryOpt) *TagRegistry {
+		t.Helper()
+		r, err := NewTagRegistry(opts...)
+		if err != nil {
+			t.Fatalf("unable to create TagRegistry: %s", err)
+		}
+		return r
+	}
+
+	collect := func(processed *[]string) FnVisitKeyValueNode {
+		return func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+			*processed = append(*processed, value.Tag+":"+value.Value)
+			return nil
+		}
+	}
+
+	tests := map[string]func() (visitorScenario[TagRegistry], *[]string, []string, string){
+		"dispatches any node kind": func() (visitorScenario[TagRegistry], *[]string, []string, string) {
+			processed := make([]string, 0)
+			return visitorScenario[TagRegistry]{
+				input: trimmed(`---
+					|password: !secret hunter2
+					|list: !secret [a, b]
+					|map: !secret {a: b}
+					|plain: value`),
+				handler: mustCreate(t, OnTag("!secret", collect(&processed))),
+			}, &processed, []string{"!secret:hunter2", "!secret:", "!secret:"}, ""
+		},
+		"dispatches tagged keys": func() (visitorScenario[TagRegistry], *[]string, []string, string) {
+			processed := make([]string, 0)
+			return visitorScenario[TagRegistry]{
+				input: trimmed(`---
+					|!env HOME: value
+					|? !env [a]
+					|: !env b`),
+				handler: mustCreate(t, OnTag("!env", collect(&processed))),
+			}, &processed, []string{"!env:HOME", "!env:", "!env:b"}, ""
+		},
+		"normalizes long tags": func() (visitorScenario[TagRegistry], *[]string, []string, string) {
+			processed := make([]string, 0)
+			return visitorScenario[TagRegistry]{
+				input:   "a: 1\nb: '2'\nc: !!int 3",
+				handler: mustCreate(t, OnTag("tag:yaml.org,2002:int", collect(&processed))),
+			}, &processed, []string{"!!int:1", "!!int:3"}, ""
+		},
+		"resolves tagged nodes in place": func() (visitorScenario[TagRegistry], *[]string, []string, string) {
+			processed := make([]string, 0)
+			return visitorScenario[TagRegistry]{
+				input: trimmed(`---
+					|password: !secret db
+					|nested:
+					|  token: !secret api`),
+				handler: mustCreate(t,
+					ResolveTag("!secret", func(ctx context.Context, key *yaml.Node, value *yaml.Node) (*yaml.Node, error) {
+						return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "resolved-" + value.Value}, nil
+					}),
+					// not invoked, as the node no longer carries the tag after resolution
+					OnTag("!secret", collect(&processed)),
+				),
+			}, &processed, []string{}, trimmed(`password: resolved-db
+					|nested:
+					|    token: resolved-api`)
+		},
+		"visits resolved content": func() (visitorScenario[TagRegistry], *[]string, []string, string) {
+			processed := make([]string, 0)
+			return visitorScenario[TagRegistry]{
+				input: "config: !include other",
+				handler: mustCreate(t,
+					ResolveTag("!include", func(ctx context.Context, key *yaml.Node, value *yaml.Node) (*yaml.Node, error) {
+						node := &yaml.Node{}
+						if err := yaml.Unmarshal([]byte("password: !secret nested"), node); err != nil {
+							return nil, err
+						}
+						return node.Content[0], nil
+					}),
+					OnTag("!secret", collect(&processed)),
+				),
+			}, &processed, []string{"!secret:nested"}, trimmed(`config:
+					|    password: !secret nested`)
+		},
+		"nil resolution leaves node unmodified": func() (visitorScenario[TagRegistry], *[]string, []string, string) {
+			processed := make([]string, 0)
+			return visitorScenario[TagRegistry]{
+				input: "a: !keep value",
+				handler: mustCreate(t,
+					ResolveTag("!keep", func(ctx context.Context, key *yaml.Node, value *yaml.Node) (*yaml.Node, error) {
+						return nil, nil
+					}),
+					OnTag("!keep", collect(&processed)),
+				),
+			}, &processed, []string{"!keep:value"}, "a: !keep value\n"
+		},
+		"stops at first error": func() (visitorScenario[TagRegistry], *[]string, []string, string) {
+			processed := make([]string, 0)
+			return visitorScenario[TagRegistry]{
+				input: "a: !fail 1\nb: !fail 2",
+				handler: mustCreate(t,
+					OnTag("!fail", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+						return errors.New("failed " + value.Value)
+					}),
+					OnTag("!fail", collect(&processed)),
+				),
+				wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+					return assert.ErrorContains(t, err, "failed 1") && assert.ErrorContains(t, err, "failed 2")
+				},
+			}, &processed, []string{}, ""
+		},
+	}
+
+	for name, setup := range tests {
+		t.Run(name, func(t *testing.T) {
+			scenario, processed, expected, output := setup()
+			scenario.validatorWithNode = func(t *testing.T, h TagRegistry, node *yaml.Node) error {
+				assert.Equal(t, expected, *processed)
+				if output != "" {
+					out, err := yaml.Marshal(node)
+					assert.NoError(t, err)
+					assert.Equal(t, output, string(out))
+				}
+				return nil
+			}
+			validateScenario(t, context.TODO(), scenario)
+		})
+	}
+}
+
+func TestNewTagRegistry_requires_tags(t *testing.T) {
+	_, err := NewTagRegistry()
+	assert.Error(t, err)
+}
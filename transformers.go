@@ -2,6 +2,14 @@ package yay
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
 
 	"go.yaml.in/yaml/v3"
 )
@@ -112,3 +120,357 @@ func NewMultipleToSingleMergeHandler(opts ...MultipleMergeKeyOpt) *multipleToSin
 	}
 	return handler
 }
+
+// ErrRequiredVariable is returned by NewEnvInterpolationHandler for each unset or empty variable required via ${NAME:?message}
+var ErrRequiredVariable = errors.New("required variable is not set")
+
+var (
+	_ VisitsScalarNode = (*envInterpolationHandler)(nil)
+)
+
+// EnvLookup retrieves the value of an environment variable, reporting whether the variable is set
+type EnvLookup func(name string) (string, bool)
+
+// envInterpolationHandler expands environment variables within scalar values.
+// See NewEnvInterpolationHandler for more information.
+type envInterpolationHandler struct {
+	lookup EnvLookup
+	scopes []Condition
+	scope  fnMatchCondition
+}
+
+// VisitScalarNode expands each variable within the scalar value, re-tagging plain scalars according to the expanded value
+func (e *envInterpolationHandler) VisitScalarNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	if !strings.Contains(value.Value, "${") {
+		return nil
+	}
+	if e.scope != nil {
+		_, ok, err := e.scope(ctx, value)
+		if err != nil || !ok {
+			return err
+		}
+	}
+
+	expanded, err := e.expand(value)
+	if err != nil {
+		return err
+	}
+	if expanded == value.Value {
+		return nil
+	}
+
+	value.Value = expanded
+	if value.Style&(yaml.TaggedStyle|yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		// plain scalars are resolved as if the expanded value had been written in the document
+		value.Tag = (&yaml.Node{Kind: yaml.ScalarNode, Value: expanded}).ShortTag()
+	}
+	return nil
+}
+
+// expand replaces each ${NAME}, ${NAME:-default}, and ${NAME:?message} within the value of node.
+// $${ escapes a literal ${. Errors for each required variable are joined, rather than failing on the first.
+func (e *envInterpolationHandler) expand(node *yaml.Node) (string, error) {
+	var sb strings.Builder
+	var maybeErr error
+	rest := node.Value
+	for {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			sb.WriteString(rest)
+			break
+		}
+		if start > 0 && rest[start-1] == '$' {
+			sb.WriteString(rest[:start-1] + "${")
+			rest = rest[start+2:]
+			continue
+		}
+		sb.WriteString(rest[:start])
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			maybeErr = errors.Join(maybeErr, &NodeError{Node: node, Err: fmt.Errorf("unterminated variable reference %q", rest[start:])})
+			break
+		}
+		expr := rest[start+2 : start+end]
+		rest = rest[start+end+1:]
+
+		name, operand, operator := expr, "", ""
+		if i := strings.Index(expr, ":"); i >= 0 && len(expr) > i+1 && (expr[i+1] == '-' || expr[i+1] == '?') {
+			name, operator, operand = expr[:i], expr[i:i+2], expr[i+2:]
+		}
+		if !isVariableName(name) {
+			maybeErr = errors.Join(maybeErr, &NodeError{Node: node, Err: fmt.Errorf("invalid variable reference ${%s}", expr)})
+			continue
+		}
+
+		val, ok := e.lookup(name)
+		switch {
+		case operator == ":-" && (!ok || val == ""):
+			val = operand
+		case operator == ":?" && (!ok || val == ""):
+			err := fmt.Errorf("%w: %s", ErrRequiredVariable, name)
+			if operand != "" {
+				err = fmt.Errorf("%w: %s: %s", ErrRequiredVariable, name, operand)
+			}
+			maybeErr = errors.Join(maybeErr, &NodeError{Node: node, Err: err})
+		}
+		sb.WriteString(val)
+	}
+	return sb.String(), maybeErr
+}
+
+func isVariableName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// EnvInterpolationOpt is an option for NewEnvInterpolationHandler.
+type EnvInterpolationOpt func(handler *envInterpolationHandler)
+
+// WithEnvLookup is an option for NewEnvInterpolationHandler which retrieves variables from lookup, rather than from the
+// environment of the current process.
+func WithEnvLookup(lookup EnvLookup) EnvInterpolationOpt {
+	return func(handler *envInterpolationHandler) {
+		handler.lookup = lookup
+	}
+}
+
+// WithEnvMap is an option for NewEnvInterpolationHandler which retrieves variables from env, rather than from the
+// environment of the current process.
+func WithEnvMap(env map[string]string) EnvInterpolationOpt {
+	return WithEnvLookup(func(name string) (string, bool) {
+		val, ok := env[name]
+		return val, ok
+	})
+}
+
+// WithEnvScopes is an option for NewEnvInterpolationHandler which restricts interpolation to scalars selected by at
+// least one of the [yamlpath] expressions. May be provided multiple times.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func WithEnvScopes(paths ...string) EnvInterpolationOpt {
+	return func(handler *envInterpolationHandler) {
+		for _, path := range paths {
+			handler.scopes = append(handler.scopes, Selector(path))
+		}
+	}
+}
+
+// NewEnvInterpolationHandler creates a handler which expands environment variables within scalar values, using a
+// syntax similar to the shell and docker compose:
+//
+//   - ${NAME} expands to the value of NAME, or an empty string if unset
+//   - ${NAME:-default} expands to default if NAME is unset or empty
+//   - ${NAME:?message} results in an error (wrapping ErrRequiredVariable) if NAME is unset or empty
+//   - $${NAME} escapes the expression, resulting in the literal ${NAME}
+//
+// Plain scalars are re-tagged according to the expanded value, so `port: ${PORT}` with PORT=8080 results in an !!int.
+// Quoted scalars and explicitly tagged scalars retain their tag.
+//
+// Variables are retrieved from the environment of the current process, unless configured by WithEnvLookup or
+// WithEnvMap. Errors for required variables are positioned via NodeError, and reported for every occurrence.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func NewEnvInterpolationHandler(opts ...EnvInterpolationOpt) *envInterpolationHandler {
+	handler := &envInterpolationHandler{lookup: os.LookupEnv}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	if len(handler.scopes) > 0 {
+		handler.scope = Any(handler.scopes...).compile()
+	}
+	return handler
+}
+
+var (
+	_ VisitsSequenceNode = (*redactionHandler)(nil)
+	_ VisitsMappingNode  = (*redactionHandler)(nil)
+	_ VisitsScalarNode   = (*redactionHandler)(nil)
+	_ VisitsAliasNode    = (*redactionHandler)(nil)
+)
+
+// DefaultRedactionMarker is the value of redacted scalars, unless configured via WithRedactionMarker
+const DefaultRedactionMarker = "[REDACTED]"
+
+// redactionHandler replaces sensitive scalar values with a marker.
+// See NewRedactionHandler for more information.
+type redactionHandler struct {
+	paths    []Condition
+	match    fnMatchCondition
+	keys     []string
+	marker   string
+	hash     bool
+	hashKey  []byte
+	redacted map[*yaml.Node]struct{}
+}
+
+// VisitSequenceNode redacts every scalar within a sequence selected by a path or key pattern
+func (r *redactionHandler) VisitSequenceNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return r.visit(ctx, key, value)
+}
+
+// VisitMappingNode redacts every scalar within a mapping selected by a path or key pattern
+func (r *redactionHandler) VisitMappingNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return r.visit(ctx, key, value)
+}
+
+// VisitScalarNode redacts a scalar selected by a path or key pattern
+func (r *redactionHandler) VisitScalarNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return r.visit(ctx, key, value)
+}
+
+// VisitAliasNode redacts the anchored node of an alias selected by a path or key pattern, which also redacts the
+// anchored node and any other aliases of it.
+func (r *redactionHandler) VisitAliasNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	return r.visit(ctx, key, value)
+}
+
+func (r *redactionHandler) visit(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+	if _, ok := r.redacted[value]; ok {
+		return nil
+	}
+	ok, err := r.selects(ctx, key, value)
+	if err != nil || !ok {
+		return err
+	}
+	r.redact(value)
+	return nil
+}
+
+// selects determines whether the node is selected by a configured path, or whether its key matches a configured pattern
+func (r *redactionHandler) selects(ctx context.Context, key *yaml.Node, value *yaml.Node) (bool, error) {
+	if key != nil && key.Kind == yaml.ScalarNode {
+		name := strings.ToLower(key.Value)
+		for _, pattern := range r.keys {
+			matched, err := path.Match(pattern, name)
+			if err != nil {
+				return false, fmt.Errorf("invalid redaction key pattern %q: %w", pattern, err)
+			}
+			if matched {
+				return true, nil
+			}
+		}
+	}
+	if r.match != nil {
+		_, ok, err := r.match(ctx, value)
+		return ok, err
+	}
+	return false, nil
+}
+
+// redact replaces the values of node and all scalars nested within it, retaining comments, anchors, and styles
+func (r *redactionHandler) redact(node *yaml.Node) {
+	if _, ok := r.redacted[node]; ok {
+		return
+	}
+	r.redacted[node] = struct{}{}
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		if node.Alias != nil {
+			r.redact(node.Alias)
+		}
+	case yaml.ScalarNode:
+		marker := r.marker
+		if r.hash {
+			var sum []byte
+			if r.hashKey != nil {
+				mac := hmac.New(sha256.New, r.hashKey)
+				mac.Write([]byte(node.Value))
+				sum = mac.Sum(nil)
+			} else {
+				s := sha256.Sum256([]byte(node.Value))
+				sum = s[:]
+			}
+			marker += ":" + hex.EncodeToString(sum)[:12]
+		}
+		node.Value = marker
+		if strings.HasPrefix(node.Tag, "!!") || node.Tag == "" {
+			// custom tags such as !secret are retained, while core tags no longer describe the value
+			node.Tag = "!!str"
+			node.Style &^= yaml.TaggedStyle
+		}
+	case yaml.MappingNode:
+		// mapping keys aren't redacted, as they describe the structure of the document
+		for i := 1; i < len(node.Content); i += 2 {
+			r.redact(node.Content[i])
+		}
+	default:
+		for _, child := range node.Content {
+			r.redact(child)
+		}
+	}
+}
+
+// RedactionOpt is an option for NewRedactionHandler.
+type RedactionOpt func(handler *redactionHandler)
+
+// WithRedactPaths is an option for NewRedactionHandler which redacts nodes selected by any of the [yamlpath] expressions.
+// May be provided multiple times.
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func WithRedactPaths(paths ...string) RedactionOpt {
+	return func(handler *redactionHandler) {
+		for _, p := range paths {
+			handler.paths = append(handler.paths, Selector(p))
+		}
+	}
+}
+
+// WithRedactKeys is an option for NewRedactionHandler which redacts the values of mapping keys matching any of the
+// patterns, such as password, token, or *_key. Patterns follow the syntax of path.Match and are case-insensitive.
+// May be provided multiple times.
+func WithRedactKeys(patterns ...string) RedactionOpt {
+	return func(handler *redactionHandler) {
+		for _, pattern := range patterns {
+			handler.keys = append(handler.keys, strings.ToLower(pattern))
+		}
+	}
+}
+
+// WithRedactionMarker is an option for NewRedactionHandler which changes the value of redacted scalars, which defaults
+// to DefaultRedactionMarker.
+func WithRedactionMarker(marker string) RedactionOpt {
+	return func(handler *redactionHandler) {
+		handler.marker = marker
+	}
+}
+
+// WithRedactionHash is an option for NewRedactionHandler which appends a hash suffix to the marker of each redacted
+// scalar, such as [REDACTED]:5e884898da28, allowing reviewers to determine whether a value has changed.
+//
+// When key is non-nil, the hash is an HMAC-SHA256 of the value using key. Otherwise, the hash is a SHA-256 of the value,
+// which may allow guessing low-entropy secrets from the suffix.
+func WithRedactionHash(key []byte) RedactionOpt {
+	return func(handler *redactionHandler) {
+		handler.hash = true
+		handler.hashKey = key
+	}
+}
+
+// NewRedactionHandler creates a handler which masks sensitive values, such as before printing a document to logs.
+// Nodes selected via WithRedactPaths or whose keys match WithRedactKeys are redacted; when a mapping or sequence is
+// selected, every scalar within it is redacted. Redaction replaces only scalar values, retaining the structure,
+// comments, and anchors of the document. An alias which is selected redacts its anchored node.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func NewRedactionHandler(opts ...RedactionOpt) *redactionHandler {
+	handler := &redactionHandler{
+		marker:   DefaultRedactionMarker,
+		redacted: make(map[*yaml.Node]struct{}),
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	if len(handler.paths) > 0 {
+		handler.match = Any(handler.paths...).compile()
+	}
+	return handler
+}
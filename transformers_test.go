@@ -283,3 +283,183 @@ func TestMultipleToSingleMerge_VisitMappingNode(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvInterpolation_VisitScalarNode(t *testing.T) {
+	env := map[string]string{
+		"HOST":    "db.local",
+		"PORT":    "5432",
+		"DEBUG":   "true",
+		"EMPTY":   "",
+		"RATIO":   "0.5",
+		"NOTHING": "~",
+	}
+
+	tests := map[string]struct {
+		input   string
+		opts    []EnvInterpolationOpt
+		want    string
+		wantErr []string
+	}{
+		"expands variables": {
+			input: "url: postgres://${HOST}:${PORT}/app",
+			want:  "url: postgres://db.local:5432/app\n",
+		},
+		"expands unset variables to empty": {
+			input: "a: x${UNSET}y",
+			want:  "a: xy\n",
+		},
+		"expands defaults": {
+			input: "a: ${UNSET:-fallback}\nb: ${EMPTY:-fallback}\nc: ${HOST:-fallback}\nd: ${UNSET:-}",
+			want:  "a: fallback\nb: fallback\nc: db.local\nd:\n",
+		},
+		"re-tags plain scalars": {
+			input: "port: ${PORT}\ndebug: ${DEBUG}\nratio: ${RATIO}\nnothing: ${NOTHING}\nhost: ${HOST}",
+			want:  "port: 5432\ndebug: true\nratio: 0.5\nnothing: ~\nhost: db.local\n",
+		},
+		"retains tags of quoted and tagged scalars": {
+			input: "a: '${PORT}'\nb: \"${DEBUG}\"\nc: !!str ${PORT}\nd: !custom ${PORT}",
+			want:  "a: '5432'\nb: \"true\"\nc: !!str 5432\nd: !custom 5432\n",
+		},
+		"escapes expressions": {
+			input: "a: $${HOST} and ${HOST}",
+			want:  "a: ${HOST} and db.local\n",
+		},
+		"ignores values without expressions": {
+			input: "a: $HOST\nb: '{HOST}'",
+			want:  "a: $HOST\nb: '{HOST}'\n",
+		},
+		"restricts to scopes": {
+			input: "a:\n  host: ${HOST}\nb:\n  host: ${HOST}\nc: ${PORT}",
+			opts:  []EnvInterpolationOpt{WithEnvScopes("$.a.*"), WithEnvScopes("$.c")},
+			want:  "a:\n    host: db.local\nb:\n    host: ${HOST}\nc: 5432\n",
+		},
+		"supports lookup functions": {
+			input: "a: ${anything}",
+			opts: []EnvInterpolationOpt{WithEnvLookup(func(name string) (string, bool) {
+				return "looked-up-" + name, true
+			})},
+			want: "a: looked-up-anything\n",
+		},
+		"reports every required variable": {
+			input: "a: ${MISSING:?must be set}\nb:\n  - ${EMPTY:?} ${OTHER:?}\n  - ${HOST:?}",
+			wantErr: []string{
+				"1:4: required variable is not set: MISSING: must be set",
+				"3:5: required variable is not set: EMPTY",
+				"3:5: required variable is not set: OTHER",
+			},
+		},
+		"reports invalid references": {
+			input:   "a: ${1NVALID}\nb: ${UNTERMINATED",
+			wantErr: []string{"1:4: invalid variable reference ${1NVALID}", `2:4: unterminated variable reference "${UNTERMINATED"`},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc := &yaml.Node{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), doc))
+
+			opts := append([]EnvInterpolationOpt{WithEnvMap(env)}, tt.opts...)
+			v, err := NewVisitor(NewEnvInterpolationHandler(opts...))
+			assert.NoError(t, err)
+			err = v.Visit(context.TODO(), doc)
+			if tt.wantErr != nil {
+				messages := make([]string, 0)
+				for _, nodeErr := range NodeErrors(err) {
+					messages = append(messages, nodeErr.Error())
+				}
+				assert.Equal(t, tt.wantErr, messages)
+				return
+			}
+			assert.NoError(t, err)
+
+			out, err := yaml.Marshal(doc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestEnvInterpolation_uses_process_environment(t *testing.T) {
+	t.Setenv("YAY_TEST_PORT", "8080")
+
+	doc := &yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte("port: ${YAY_TEST_PORT}\nmissing: ${YAY_TEST_UNSET:?}"), doc))
+
+	v, err := NewVisitor(NewEnvInterpolationHandler())
+	assert.NoError(t, err)
+	err = v.Visit(context.TODO(), doc)
+	assert.ErrorIs(t, err, ErrRequiredVariable)
+
+	port := doc.Content[0].Content[1]
+	assert.Equal(t, "8080", port.Value)
+	assert.Equal(t, "!!int", port.Tag)
+}
+
+func TestRedaction_visits(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		opts    []RedactionOpt
+		want    string
+		wantErr string
+	}{
+		"redacts matching keys": {
+			input: "user: admin\npassword: hunter2\nPASSWORD: other\napi_key: abc\ntoken: 123",
+			opts:  []RedactionOpt{WithRedactKeys("password", "token", "*_key")},
+			want:  "user: admin\npassword: '[REDACTED]'\nPASSWORD: '[REDACTED]'\napi_key: '[REDACTED]'\ntoken: '[REDACTED]'\n",
+		},
+		"redacts paths": {
+			input: "db:\n  user: admin\n  pass: secret\nother:\n  pass: visible",
+			opts:  []RedactionOpt{WithRedactPaths("$.db.pass")},
+			want:  "db:\n    user: admin\n    pass: '[REDACTED]'\nother:\n    pass: visible\n",
+		},
+		"redacts scalars within selected collections": {
+			input: "credentials:\n  user: admin\n  keys: [a, b]\nlist:\n  - one\n  - two: 2",
+			opts:  []RedactionOpt{WithRedactKeys("credentials"), WithRedactPaths("$.list")},
+			want:  "credentials:\n    user: '[REDACTED]'\n    keys: ['[REDACTED]', '[REDACTED]']\nlist:\n    - '[REDACTED]'\n    - two: '[REDACTED]'\n",
+		},
+		"preserves comments, styles, and custom tags": {
+			input: "# head\npassword: \"hunter2\" # line\ntoken: !secret abc\ncount: !!int 1",
+			opts:  []RedactionOpt{WithRedactKeys("password", "token", "count"), WithRedactionMarker("***")},
+			want:  "# head\npassword: \"***\" # line\ntoken: !secret '***'\ncount: '***'\n",
+		},
+		"redacts aliased values": {
+			input: "base: &pw hunter2\npassword: *pw\nother: *pw",
+			opts:  []RedactionOpt{WithRedactKeys("password")},
+			want:  "base: &pw '[REDACTED]'\npassword: *pw\nother: *pw\n",
+		},
+		"appends hashes": {
+			input: "a:\n  password: hunter2\nb:\n  password: hunter2\nc:\n  password: changed",
+			opts:  []RedactionOpt{WithRedactKeys("password"), WithRedactionHash(nil)},
+			want:  "a:\n    password: '[REDACTED]:f52fbd32b2b3'\nb:\n    password: '[REDACTED]:f52fbd32b2b3'\nc:\n    password: '[REDACTED]:d67e2e944994'\n",
+		},
+		"appends keyed hashes": {
+			input: "password: hunter2",
+			opts:  []RedactionOpt{WithRedactKeys("password"), WithRedactionHash([]byte("key")), WithRedactionMarker("***")},
+			want:  "password: '***:05d210d8af05'\n",
+		},
+		"reports invalid patterns": {
+			input:   "password: hunter2",
+			opts:    []RedactionOpt{WithRedactKeys("[")},
+			wantErr: `invalid redaction key pattern "["`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc := &yaml.Node{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), doc))
+
+			v, err := NewVisitor(NewRedactionHandler(tt.opts...))
+			assert.NoError(t, err)
+			err = v.Visit(context.TODO(), doc)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			out, err := yaml.Marshal(doc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package yay
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+type traversalKey struct{}
+
+// frame describes a single step along the path from a document's root node to the node currently being visited
+type frame struct {
+	node *yaml.Node
+	// key is the mapping key of node, or nil for sequence items and the root node
+	key *yaml.Node
+	// index is the position of node within its parent: the item index for sequences, or the entry index for mappings
+	index int
+}
+
+// traversal tracks the visitor's current position within a document.
+// Frames are pushed and popped as the visitor descends, so a traversal is only meaningful during a visit.
+type traversal struct {
+	root   *yaml.Node
+	frames []frame
+	// simple is lazily evaluated, see isSimple
+	simple *bool
+	// detached traversals track positions relative to a node without a well-defined root, so they provide VisitInfo
+	// but aren't used for path matching
+	detached bool
+}
+
+func newTraversal(root *yaml.Node, node *yaml.Node) *traversal {
+	return &traversal{
+		root:   root,
+		frames: []frame{{node: node, index: -1}},
+	}
+}
+
+// detachedTraversal creates a traversal of node which is excluded from path matching, see traversalFrom
+func detachedTraversal(root *yaml.Node, node *yaml.Node) *traversal {
+	t := newTraversal(root, node)
+	t.detached = true
+	return t
+}
+
+func (t *traversal) push(f frame) {
+	t.frames = append(t.frames, f)
+}
+
+func (t *traversal) pop() {
+	t.frames = t.frames[:len(t.frames)-1]
+}
+
+func (t *traversal) top() frame {
+	return t.frames[len(t.frames)-1]
+}
+
+// isSimple determines whether the document contains only constructs for which a node's position during traversal
+// is equivalent to its location as determined by yamlpath: no aliases, merge keys, or complex mapping keys.
+func (t *traversal) isSimple() bool {
+	if t.simple == nil {
+		simple := isSimpleNode(t.frames[0].node)
+		t.simple = &simple
+	}
+	return *t.simple
+}
+
+func isSimpleNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return false
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode || key.Value == "<<" {
+				return false
+			}
+			if !isSimpleNode(node.Content[i+1]) {
+				return false
+			}
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			if !isSimpleNode(child) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// framesFor returns the frames leading to node, which must be the node currently visited or one of its children.
+func (t *traversal) framesFor(node *yaml.Node) ([]frame, bool) {
+	current := t.top()
+	if current.node == node {
+		return t.frames, true
+	}
+
+	switch current.node.Kind {
+	case yaml.SequenceNode:
+		for i, child := range current.node.Content {
+			if child == node {
+				return append(t.frames[:len(t.frames):len(t.frames)], frame{node: node, index: i}), true
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(current.node.Content); i += 2 {
+			if current.node.Content[i] == node {
+				return append(t.frames[:len(t.frames):len(t.frames)], frame{node: node, key: current.node.Content[i-1], index: i / 2}), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func withTraversal(ctx context.Context, t *traversal) context.Context {
+	return context.WithValue(ctx, traversalKey{}, t)
+}
+
+// traversalFrom retrieves the traversal tracking paths within the visited document, excluding detached traversals
+func traversalFrom(ctx context.Context) (*traversal, bool) {
+	if t, ok := anyTraversalFrom(ctx); ok && !t.detached {
+		return t, true
+	}
+	return nil, false
+}
+
+// anyTraversalFrom retrieves the traversal of the visit, including detached traversals
+func anyTraversalFrom(ctx context.Context) (*traversal, bool) {
+	t, ok := ctx.Value(traversalKey{}).(*traversal)
+	return t, ok && t != nil
+}
+
+// path returns the [yamlpath] expression selecting the node currently visited, e.g. $.spec.containers[0].image
+//
+// [yamlpath]: https://github.com/vmware-labs/yaml-jsonpath#syntax
+func (t *traversal) path() string {
+	return pathOf(t.frames)
+}
+
+func pathOf(frames []frame) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, f := range frames[1:] {
+		switch {
+		case f.key == nil:
+			sb.WriteString("[" + strconv.Itoa(f.index) + "]")
+		case f.key.Value == "" || strings.ContainsAny(f.key.Value, yamlpathReserved):
+			quoted, err := quotedChild(f.key.Value)
+			if err != nil {
+				// names containing both quote characters can't be expressed in yamlpath, so fall back to the entry index
+				quoted = "[" + strconv.Itoa(f.index) + "]"
+			}
+			sb.WriteString(quoted)
+		default:
+			sb.WriteString("." + f.key.Value)
+		}
+	}
+	return sb.String()
+}
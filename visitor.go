@@ -37,6 +37,13 @@ type VisitsAliasNode interface {
 	VisitAliasNode(ctx context.Context, key *yaml.Node, value *yaml.Node) error
 }
 
+// VisitsMappingKey defines behaviors for visitors which want to handle the key nodes of mappings.
+// The key is the visited key node and value is the value of its mapping entry. Complex keys (mappings or sequences
+// used as keys) are descended, invoking VisitMappingKey for each node nested within the key along with the entry's value.
+type VisitsMappingKey interface {
+	VisitMappingKey(ctx context.Context, key *yaml.Node, value *yaml.Node) error
+}
+
 // VisitsYaml defines all behaviors for YAML visitors
 type VisitsYaml interface {
 	VisitsDocumentNode
@@ -69,6 +76,8 @@ func (v *visitor) Visit(parent context.Context, node *yaml.Node) error {
 
 	ctx, canceler := context.WithCancel(parent)
 	defer canceler()
+	// inline directives such as # yay:ignore are scoped to the visited document
+	ctx = withDirectives(ctx, collectDirectives(node))
 
 	if node.Kind == yaml.DocumentNode {
 		// TODO: We should be able to move the document visit into iterate and simplify this function
@@ -85,7 +94,7 @@ func (v *visitor) Visit(parent context.Context, node *yaml.Node) error {
 		}
 
 		value := node.Content[0]
-		err := v.iterate(ctx, value)
+		err := v.iterate(withTraversal(ctx, newTraversal(node, value)), value)
 		maybeErr = errors.Join(maybeErr, err)
 	} else if node.Content != nil && len(node.Content) == 2 {
 		if node.Content[1] != nil {
@@ -99,17 +108,19 @@ func (v *visitor) Visit(parent context.Context, node *yaml.Node) error {
 				wrapper.Content = append(wrapper.Content, node.Content[0], node.Content[1])
 			}
 
-			nestedCtx := withRootNode(ctx, wrapper)
+			// positions within the wrapper don't reflect the user's document, so paths aren't tracked incrementally
+			nestedCtx := withTraversal(withRootNode(ctx, wrapper), detachedTraversal(wrapper, node.Content[1]))
 			err := v.visit(nestedCtx, node.Content[0], node.Content[1])
 			maybeErr = errors.Join(maybeErr, err)
 		} else {
-			nestedCtx := withRootNode(ctx, &yaml.Node{Kind: yaml.DocumentNode, Content: node.Content})
+			nestedRoot := &yaml.Node{Kind: yaml.DocumentNode, Content: node.Content}
+			nestedCtx := withTraversal(withRootNode(ctx, nestedRoot), detachedTraversal(nestedRoot, node.Content[0]))
 			err := v.iterate(nestedCtx, node.Content[0])
 			maybeErr = errors.Join(maybeErr, err)
 		}
 	} else {
 		virtualRoot := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{node}}
-		nestedCtx := withRootNode(ctx, virtualRoot)
+		nestedCtx := withTraversal(withRootNode(ctx, virtualRoot), newTraversal(virtualRoot, node))
 		err := v.iterate(nestedCtx, node)
 		maybeErr = errors.Join(maybeErr, err)
 	}
@@ -130,6 +141,22 @@ func (v *visitor) visit(ctx context.Context, key *yaml.Node, value *yaml.Node) e
 		keyNode = key
 	}
 
+	// handlers suppressed by an inline directive are skipped, but descendants are still visited
+	if !suppressed(ctx, v.handler, keyNode, value) {
+		maybeErr = v.dispatch(ctx, keyNode, value)
+	}
+
+	// if there was an error, we won't recurse nodes any further
+	if maybeErr == nil && value.Content != nil && len(value.Content) > 0 {
+		maybeErr = v.iterate(ctx, value)
+	}
+
+	return maybeErr
+}
+
+// dispatch invokes the handler's method for the kind of value
+func (v *visitor) dispatch(ctx context.Context, keyNode *yaml.Node, value *yaml.Node) error {
+	var maybeErr error
 	switch value.Kind {
 	case yaml.SequenceNode:
 		if handle, ok := v.handler.(VisitsSequenceNode); ok {
@@ -159,27 +186,29 @@ func (v *visitor) visit(ctx context.Context, key *yaml.Node, value *yaml.Node) e
 			}
 		}
 	default:
-		panic("unhandled default case")
-	}
-
-	// if there was an error, we won't recurse nodes any further
-	if maybeErr == nil && value.Content != nil && len(value.Content) > 0 {
-		maybeErr = v.iterate(ctx, value)
+		maybeErr = &NodeError{Node: value, Err: fmt.Errorf("unexpected node kind %d", value.Kind)}
 	}
-
 	return maybeErr
 }
 
 func (v *visitor) iterate(ctx context.Context, value *yaml.Node) error {
 	var maybeErr error
 	if ctx.Err() == nil {
+		// the traversal tracks the current path for incremental path matching and VisitInfo
+		t, tracked := anyTraversalFrom(ctx)
 		switch value.Kind {
 		case yaml.SequenceNode:
 			for i := 0; i < len(value.Content); i++ {
 				val := value.Content[i]
+				if tracked {
+					t.push(frame{node: val, index: i})
+				}
 				if err := v.visit(ctx, emptyNode, val); err != nil {
 					maybeErr = errors.Join(maybeErr, err)
 				}
+				if tracked {
+					t.pop()
+				}
 				if ctx.Err() != nil {
 					break
 				}
@@ -188,9 +217,20 @@ func (v *visitor) iterate(ctx context.Context, value *yaml.Node) error {
 			for i := 0; i < len(value.Content); i += 2 {
 				key := value.Content[i]
 				val := value.Content[i+1]
+				if tracked {
+					t.push(frame{node: val, key: key, index: i / 2})
+				}
+				if handle, ok := v.handler.(VisitsMappingKey); ok {
+					if err := v.visitKey(ctx, handle, key, val); err != nil {
+						maybeErr = errors.Join(maybeErr, err)
+					}
+				}
 				if err := v.visit(ctx, key, val); err != nil {
 					maybeErr = errors.Join(maybeErr, err)
 				}
+				if tracked {
+					t.pop()
+				}
 				if ctx.Err() != nil {
 					break
 				}
@@ -200,6 +240,34 @@ func (v *visitor) iterate(ctx context.Context, value *yaml.Node) error {
 	return maybeErr
 }
 
+// visitKey invokes handle for node, which is (or is nested within) the mapping key of value, then descends into complex keys
+func (v *visitor) visitKey(ctx context.Context, handle VisitsMappingKey, node *yaml.Node, value *yaml.Node) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if !suppressed(ctx, handle, node, value) {
+		if err := handle.VisitMappingKey(ctx, node, value); err != nil {
+			// as with values, we won't recurse nodes any further
+			return err
+		}
+	}
+
+	var maybeErr error
+	// aliased keys aren't descended, as the anchored node has already been visited
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		for _, child := range node.Content {
+			if err := v.visitKey(ctx, handle, child, value); err != nil {
+				maybeErr = errors.Join(maybeErr, err)
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	return maybeErr
+}
+
 // NewVisitor constructs a new Visitor which handles yaml.Node processing defined by handler.
 // The handler must satisfy one or more of the visitor interfaces.
 // See:
@@ -209,6 +277,7 @@ func (v *visitor) iterate(ctx context.Context, value *yaml.Node) error {
 //   - VisitsMappingNode
 //   - VisitsScalarNode
 //   - VisitsAliasNode
+//   - VisitsMappingKey
 func NewVisitor(handlers ...any) (Visitor, error) {
 	return NewVisitorWithOptions(NewOptions(), handlers...)
 }
@@ -223,10 +292,11 @@ func NewVisitor(handlers ...any) (Visitor, error) {
 //   - VisitsMappingNode
 //   - VisitsScalarNode
 //   - VisitsAliasNode
+//   - VisitsMappingKey
 func NewVisitorWithOptions(options FnOptions, handlers ...any) (Visitor, error) {
 	for _, handler := range handlers {
 		switch i := handler.(type) {
-		case VisitsYaml, VisitsDocumentNode, VisitsSequenceNode, VisitsMappingNode, VisitsScalarNode, VisitsAliasNode:
+		case VisitsYaml, VisitsDocumentNode, VisitsSequenceNode, VisitsMappingNode, VisitsScalarNode, VisitsAliasNode, VisitsMappingKey:
 		default:
 			return nil, fmt.Errorf("type %T doesn't implement any visitor handlers", i)
 		}
@@ -237,6 +307,14 @@ func NewVisitorWithOptions(options FnOptions, handlers ...any) (Visitor, error)
 		options(&o)
 	}
 
+	if len(o.middleware) > 0 {
+		wrapped := make([]any, 0, len(handlers))
+		for _, handler := range handlers {
+			wrapped = append(wrapped, newMiddlewareHandler(handler, o.middleware))
+		}
+		handlers = wrapped
+	}
+
 	if len(handlers) == 1 {
 		return &visitor{handler: handlers[0], options: o}, nil
 	}
@@ -456,3 +456,120 @@ func TestNewVisitorWithOptions(t *testing.T) {
 		})
 	}
 }
+
+// keyCollector records each visited mapping key, along with the value of its mapping entry
+type keyCollector struct {
+	keys    []pair
+	failKey string
+}
+
+func (k *keyCollector) VisitMappingKey(_ context.Context, key *yaml.Node, value *yaml.Node) error {
+	k.keys = append(k.keys, pair{left: key, right: value})
+	if k.failKey != "" && key.Value == k.failKey {
+		return errors.New("forbidden key " + key.Value)
+	}
+	return nil
+}
+
+func (k *keyCollector) describe() []string {
+	result := make([]string, 0, len(k.keys))
+	for _, p := range k.keys {
+		key := p.left.Value
+		switch p.left.Kind {
+		case yaml.MappingNode:
+			key = "<mapping>"
+		case yaml.SequenceNode:
+			key = "<sequence>"
+		case yaml.AliasNode:
+			key = "*" + p.left.Value
+		}
+		value := p.right.Value
+		if p.right.Kind != yaml.ScalarNode {
+			value = "<" + p.right.Tag + ">"
+		}
+		result = append(result, key+"="+value)
+	}
+	return result
+}
+
+func TestVisitorTraversals_mapping_keys(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		failKey string
+		want    []string
+		wantErr assert.ErrorAssertionFunc
+	}{
+		"visits scalar keys": {
+			input: trimmed(`---
+				|a: 1
+				|b:
+				|  c: 2
+				|d:
+				|- e: 3`),
+			want: []string{"a=1", "b=<!!map>", "c=2", "d=<!!seq>", "e=3"},
+		},
+		"descends complex keys": {
+			input: trimmed(`---
+				|? [x, y]
+				|: seq
+				|? {k: v}
+				|: map`),
+			want: []string{"<sequence>=seq", "x=seq", "y=seq", "<mapping>=map", "k=map", "v=map"},
+		},
+		"visits anchored and aliased keys": {
+			input: trimmed(`---
+				|&anchor name: first
+				|*anchor : second`),
+			want: []string{"name=first", "*anchor=second"},
+		},
+		"ignores sequences of scalars": {
+			input: "- a\n- b",
+			want:  []string{},
+		},
+		"joins errors without skipping values": {
+			input: trimmed(`---
+				|bad: 1
+				|nested:
+				|  bad: 2`),
+			failKey: "bad",
+			want:    []string{"bad=1", "nested=<!!map>", "bad=2"},
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorContains(t, err, "forbidden key bad")
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := &keyCollector{failKey: tt.failKey}
+			v, err := NewVisitor(handler)
+			assert.NoError(t, err)
+
+			doc := &yaml.Node{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), doc))
+
+			errFn := tt.wantErr
+			if errFn == nil {
+				errFn = assert.NoError
+			}
+			errFn(t, v.Visit(context.TODO(), doc))
+			assert.Equal(t, tt.want, handler.describe())
+		})
+	}
+}
+
+func TestVisitor_unexpectedKind(t *testing.T) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{
+		Kind: yaml.MappingNode,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "nested", Line: 1, Column: 1},
+			{Kind: yaml.DocumentNode, Line: 1, Column: 9},
+		},
+	}}}
+	handler, err := NewConditionalHandler(OnVisitScalarNode("$..*", func(ctx context.Context, key *yaml.Node, value *yaml.Node) error {
+		return nil
+	}))
+	assert.NoError(t, err)
+	v, err := NewVisitor(handler)
+	assert.NoError(t, err)
+	assert.EqualError(t, v.Visit(context.Background(), doc), "1:9: unexpected node kind 1")
+}
@@ -0,0 +1,293 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	_ VisitsScalarNode = (*yaml11Handler)(nil)
+	_ VisitsMappingKey = (*yaml11Handler)(nil)
+	_ Rule             = (*yaml11Handler)(nil)
+)
+
+// ErrAmbiguousScalar is wrapped by each AmbiguousScalarError reported by NewYAML11Handler
+var ErrAmbiguousScalar = errors.New("ambiguous scalar")
+
+// YAML 1.1 resolution, per the type repository of the specification at https://yaml.org/type/
+var (
+	yaml11Null      = regexp.MustCompile(`^(?:~|null|Null|NULL|)$`)
+	yaml11Bool      = regexp.MustCompile(`^(?:y|Y|yes|Yes|YES|n|N|no|No|NO|true|True|TRUE|false|False|FALSE|on|On|ON|off|Off|OFF)$`)
+	yaml11Int       = regexp.MustCompile(`^(?:[-+]?0b[01_]+|[-+]?0[0-7_]+|[-+]?(?:0|[1-9][0-9_]*)|[-+]?0x[0-9a-fA-F_]+|[-+]?[1-9][0-9_]*(?::[0-5]?[0-9])+)$`)
+	yaml11Float     = regexp.MustCompile(`^(?:[-+]?[0-9][0-9_]*\.[0-9_]*(?:[eE][-+][0-9]+)?|\.[0-9_]+(?:[eE][-+][0-9]+)?|[-+]?[0-9][0-9_]*(?::[0-5]?[0-9])+\.[0-9_]*|[-+]?\.(?:inf|Inf|INF)|\.(?:nan|NaN|NAN))$`)
+	yaml11Timestamp = regexp.MustCompile(`^(?:[0-9]{4}-[0-9]{2}-[0-9]{2}|[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}(?:[Tt]|[ \t]+)[0-9]{1,2}:[0-9]{2}:[0-9]{2}(?:\.[0-9]*)?(?:[ \t]*(?:Z|[-+][0-9]{1,2}(?::[0-9]{2})?))?)$`)
+)
+
+// ScalarInterpretation is the resolved tag and value of a plain scalar, with values of non-string types in canonical
+// form (e.g. the YAML 1.1 interpretation of 0777 is !!int 511)
+type ScalarInterpretation struct {
+	Tag   string
+	Value string
+}
+
+// String formats the interpretation as a tagged value, e.g. !!bool true or !!str "on"
+func (i ScalarInterpretation) String() string {
+	if i.Tag == "!!str" {
+		return fmt.Sprintf("%s %q", i.Tag, i.Value)
+	}
+	return i.Tag + " " + i.Value
+}
+
+// AmbiguousScalarError reports a plain scalar which is resolved differently by YAML 1.1 and YAML 1.2
+type AmbiguousScalarError struct {
+	Value string
+	// YAML11 is the interpretation of the YAML 1.1 type repository
+	YAML11 ScalarInterpretation
+	// YAML12 is the interpretation of yaml.v3, which reads the document
+	YAML12 ScalarInterpretation
+}
+
+// Error describes both interpretations of the scalar
+func (e *AmbiguousScalarError) Error() string {
+	return fmt.Sprintf("%s %q: YAML 1.1 resolves %s, but YAML 1.2 resolves %s", ErrAmbiguousScalar, e.Value, e.YAML11, e.YAML12)
+}
+
+// Unwrap returns ErrAmbiguousScalar
+func (e *AmbiguousScalarError) Unwrap() error {
+	return ErrAmbiguousScalar
+}
+
+// YAML11FixMode determines how NewYAML11Handler rewrites ambiguous scalars
+type YAML11FixMode int
+
+const (
+	// YAML11Report reports ambiguous scalars without modifying them
+	YAML11Report YAML11FixMode = iota
+	// YAML11Quote quotes ambiguous scalars, such that both versions resolve them as the string written in the document
+	YAML11Quote
+	// YAML11Canonical rewrites ambiguous scalars to a form resolved as their YAML 1.2 interpretation by both versions:
+	// strings are quoted, and other values are written in canonical form (e.g. 0o10 becomes 8)
+	YAML11Canonical
+)
+
+// YAML11Opt is an option for NewYAML11Handler
+type YAML11Opt func(handler *yaml11Handler)
+
+// WithYAML11Fix rewrites ambiguous scalars according to mode, rather than reporting them
+func WithYAML11Fix(mode YAML11FixMode) YAML11Opt {
+	return func(handler *yaml11Handler) {
+		handler.mode = mode
+	}
+}
+
+// yaml11Handler detects plain scalars which are resolved differently by YAML 1.1 and YAML 1.2.
+// See NewYAML11Handler for more information.
+type yaml11Handler struct {
+	mode YAML11FixMode
+}
+
+// RuleID identifies the handler within inline directives, e.g. # yay:ignore yaml11
+func (h *yaml11Handler) RuleID() string {
+	return "yaml11"
+}
+
+// VisitScalarNode checks the scalar value
+func (h *yaml11Handler) VisitScalarNode(_ context.Context, _ *yaml.Node, value *yaml.Node) error {
+	return h.check(value)
+}
+
+// VisitMappingKey checks scalar keys, such as the on: key of a GitHub Actions workflow
+func (h *yaml11Handler) VisitMappingKey(_ context.Context, key *yaml.Node, _ *yaml.Node) error {
+	if key.Kind != yaml.ScalarNode {
+		return nil
+	}
+	return h.check(key)
+}
+
+func (h *yaml11Handler) check(node *yaml.Node) error {
+	// only plain, implicitly tagged scalars are resolved
+	if node.Style != 0 || node.Value == "<<" {
+		return nil
+	}
+	v11, v12 := resolveYAML11(node.Value), resolveYAML12(node.Value)
+	if v11 == v12 {
+		return nil
+	}
+
+	switch h.mode {
+	case YAML11Quote:
+		node.Tag = "!!str"
+		node.Style = yaml.DoubleQuotedStyle
+	case YAML11Canonical:
+		node.Tag = v12.Tag
+		node.Value = v12.Value
+		switch v12.Tag {
+		case "!!str":
+			node.Style = yaml.DoubleQuotedStyle
+		case "!!float":
+			node.Value = unambiguousFloat(v12.Value)
+		}
+	default:
+		return &NodeError{Node: node, Err: &AmbiguousScalarError{Value: node.Value, YAML11: v11, YAML12: v12}}
+	}
+	return nil
+}
+
+// unambiguousFloat formats a canonical float such that YAML 1.1, which requires a decimal point and a signed
+// exponent, also resolves it as a float
+func unambiguousFloat(value string) string {
+	if strings.HasPrefix(value, ".") || strings.HasPrefix(value, "-.") {
+		// .inf, -.inf, .nan
+		return value
+	}
+	mantissa, exponent, ok := strings.Cut(value, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	if !ok {
+		return mantissa
+	}
+	return mantissa + "e" + exponent
+}
+
+// resolveYAML11 resolves a plain scalar per the YAML 1.1 type repository
+func resolveYAML11(value string) ScalarInterpretation {
+	switch {
+	case yaml11Null.MatchString(value):
+		return ScalarInterpretation{Tag: "!!null", Value: "null"}
+	case yaml11Bool.MatchString(value):
+		switch strings.ToLower(value) {
+		case "y", "yes", "true", "on":
+			return ScalarInterpretation{Tag: "!!bool", Value: "true"}
+		}
+		return ScalarInterpretation{Tag: "!!bool", Value: "false"}
+	case yaml11Int.MatchString(value):
+		sign, digits := splitSign(strings.ReplaceAll(value, "_", ""))
+		n := new(big.Int)
+		switch {
+		case strings.HasPrefix(digits, "0b"):
+			n.SetString(digits[2:], 2)
+		case strings.HasPrefix(digits, "0x"):
+			n.SetString(digits[2:], 16)
+		case strings.Contains(digits, ":"):
+			n = sexagesimal(digits)
+		case len(digits) > 1 && digits[0] == '0':
+			n.SetString(digits[1:], 8)
+		default:
+			n.SetString(digits, 10)
+		}
+		if sign == "-" {
+			n.Neg(n)
+		}
+		return ScalarInterpretation{Tag: "!!int", Value: n.String()}
+	case yaml11Float.MatchString(value):
+		plain := strings.ReplaceAll(value, "_", "")
+		if base, fraction, ok := strings.Cut(plain, "."); ok && strings.Contains(base, ":") {
+			sign, digits := splitSign(base)
+			f, _ := new(big.Float).SetInt(sexagesimal(digits)).Float64()
+			if fraction != "" {
+				frac, _ := strconv.ParseFloat("0."+fraction, 64)
+				f += frac
+			}
+			if sign == "-" {
+				f = -f
+			}
+			return ScalarInterpretation{Tag: "!!float", Value: canonicalFloat(strconv.FormatFloat(f, 'g', -1, 64))}
+		}
+		return ScalarInterpretation{Tag: "!!float", Value: canonicalFloat(plain)}
+	case yaml11Timestamp.MatchString(value):
+		return ScalarInterpretation{Tag: "!!timestamp", Value: value}
+	}
+	return ScalarInterpretation{Tag: "!!str", Value: value}
+}
+
+// resolveYAML12 resolves a plain scalar as yaml.v3 does, which follows the YAML 1.2 core schema while retaining some
+// YAML 1.1 forms, such as 0777 (!!int 511), 0b101, 1_000, and timestamps
+func resolveYAML12(value string) ScalarInterpretation {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	tag := node.ShortTag()
+	var decoded any
+	if err := node.Decode(&decoded); err != nil {
+		return ScalarInterpretation{Tag: tag, Value: value}
+	}
+	switch v := decoded.(type) {
+	case nil:
+		return ScalarInterpretation{Tag: tag, Value: "null"}
+	case bool:
+		return ScalarInterpretation{Tag: tag, Value: strconv.FormatBool(v)}
+	case int, int64, uint64:
+		return ScalarInterpretation{Tag: tag, Value: fmt.Sprint(v)}
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return ScalarInterpretation{Tag: tag, Value: ".inf"}
+		case math.IsInf(v, -1):
+			return ScalarInterpretation{Tag: tag, Value: "-.inf"}
+		case math.IsNaN(v):
+			return ScalarInterpretation{Tag: tag, Value: ".nan"}
+		}
+		return ScalarInterpretation{Tag: tag, Value: canonicalFloat(strconv.FormatFloat(v, 'g', -1, 64))}
+	}
+	// strings and timestamps are retained as written
+	return ScalarInterpretation{Tag: tag, Value: value}
+}
+
+// canonicalFloat formats a float consistently across both versions, reusing the canonical form of Hash
+func canonicalFloat(value string) string {
+	_, canonical := canonicalScalar(&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: value})
+	return canonical
+}
+
+func splitSign(value string) (string, string) {
+	if value != "" && (value[0] == '-' || value[0] == '+') {
+		return value[:1], value[1:]
+	}
+	return "", value
+}
+
+// sexagesimal parses base 60 digits such as 1:30 (90)
+func sexagesimal(digits string) *big.Int {
+	n := new(big.Int)
+	for _, part := range strings.Split(digits, ":") {
+		p, _ := new(big.Int).SetString(part, 10)
+		n.Mul(n, big.NewInt(60)).Add(n, p)
+	}
+	return n
+}
+
+// NewYAML11Handler creates a handler which detects plain scalars that are resolved differently by the YAML 1.1
+// specification and YAML 1.2 parsers, for example:
+//
+//	on: yes      # !!bool true in YAML 1.1, but !!str "on" and !!str "yes" in YAML 1.2
+//	time: 1:30   # !!int 90 in YAML 1.1, but !!str "1:30" in YAML 1.2
+//	size: 1e3    # !!str "1e3" in YAML 1.1, but !!float 1000 in YAML 1.2
+//
+// The YAML 1.2 interpretation is that of yaml.v3, which reads the document, so the handler never rewrites a value
+// yaml.v3 already resolves. yaml.v3 retains some YAML 1.1 forms, such as 0777 (!!int 511), 0b101, 1_000, and
+// 2001-01-01 (!!timestamp), which aren't reported.
+//
+// The YAML 1.1 forms are those of the specification's type repository (https://yaml.org/type/), which YAML 1.1 parsers
+// don't all implement in full. For example, the single-letter booleans y, Y, n, and N are reported, although PyYAML
+// resolves them as strings.
+//
+// Each ambiguous scalar, including mapping keys, is reported as a NodeError wrapping an AmbiguousScalarError, which
+// describes both interpretations. With WithYAML11Fix, ambiguous scalars are instead rewritten to a form resolved
+// identically by both versions, and aren't reported. Scalars may be excluded via inline directives such as
+// # yay:ignore yaml11.
+//
+//goland:noinspection GoExportedFuncWithUnexportedType
+func NewYAML11Handler(opts ...YAML11Opt) *yaml11Handler {
+	handler := &yaml11Handler{}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
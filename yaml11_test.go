@@ -0,0 +1,171 @@
+package yay
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestResolveYAML11(t *testing.T) {
+	tests := map[string]struct {
+		yaml11 ScalarInterpretation
+		yaml12 ScalarInterpretation
+	}{
+		"on":         {ScalarInterpretation{"!!bool", "true"}, ScalarInterpretation{"!!str", "on"}},
+		"No":         {ScalarInterpretation{"!!bool", "false"}, ScalarInterpretation{"!!str", "No"}},
+		"y":          {ScalarInterpretation{"!!bool", "true"}, ScalarInterpretation{"!!str", "y"}},
+		"True":       {ScalarInterpretation{"!!bool", "true"}, ScalarInterpretation{"!!bool", "true"}},
+		"~":          {ScalarInterpretation{"!!null", "null"}, ScalarInterpretation{"!!null", "null"}},
+		"0777":       {ScalarInterpretation{"!!int", "511"}, ScalarInterpretation{"!!int", "511"}},
+		"010":        {ScalarInterpretation{"!!int", "8"}, ScalarInterpretation{"!!int", "8"}},
+		"08":         {ScalarInterpretation{"!!str", "08"}, ScalarInterpretation{"!!float", "8.0"}},
+		"0o777":      {ScalarInterpretation{"!!str", "0o777"}, ScalarInterpretation{"!!int", "511"}},
+		"0x1F":       {ScalarInterpretation{"!!int", "31"}, ScalarInterpretation{"!!int", "31"}},
+		"0x_1F":      {ScalarInterpretation{"!!int", "31"}, ScalarInterpretation{"!!int", "31"}},
+		"-0x1F":      {ScalarInterpretation{"!!int", "-31"}, ScalarInterpretation{"!!int", "-31"}},
+		"0b101":      {ScalarInterpretation{"!!int", "5"}, ScalarInterpretation{"!!int", "5"}},
+		"-1_000":     {ScalarInterpretation{"!!int", "-1000"}, ScalarInterpretation{"!!int", "-1000"}},
+		"1:30":       {ScalarInterpretation{"!!int", "90"}, ScalarInterpretation{"!!str", "1:30"}},
+		"1:30.5":     {ScalarInterpretation{"!!float", "90.5"}, ScalarInterpretation{"!!str", "1:30.5"}},
+		"1.5":        {ScalarInterpretation{"!!float", "1.5"}, ScalarInterpretation{"!!float", "1.5"}},
+		"1e3":        {ScalarInterpretation{"!!str", "1e3"}, ScalarInterpretation{"!!float", "1000.0"}},
+		".inf":       {ScalarInterpretation{"!!float", ".inf"}, ScalarInterpretation{"!!float", ".inf"}},
+		"-.inf":      {ScalarInterpretation{"!!float", "-.inf"}, ScalarInterpretation{"!!float", "-.inf"}},
+		"2001-01-01": {ScalarInterpretation{"!!timestamp", "2001-01-01"}, ScalarInterpretation{"!!timestamp", "2001-01-01"}},
+		"text":       {ScalarInterpretation{"!!str", "text"}, ScalarInterpretation{"!!str", "text"}},
+	}
+	for value, tt := range tests {
+		t.Run(value, func(t *testing.T) {
+			assert.Equal(t, tt.yaml11, resolveYAML11(value))
+			assert.Equal(t, tt.yaml12, resolveYAML12(value))
+		})
+	}
+}
+
+func TestNewYAML11Handler(t *testing.T) {
+	input := trimmed(`on: push
+		|enabled: yes
+		|mode: 0777
+		|time: 1:30
+		|date: 2001-01-01
+		|quoted: "no"
+		|tagged: !!str off
+		|exponent: 1e3
+		|fine: [true, 1.5, 10, text]`)
+
+	tests := map[string]struct {
+		opts     []YAML11Opt
+		errors   []string
+		expected string
+	}{
+		"reports ambiguous scalars": {
+			errors: []string{
+				`1:1: ambiguous scalar "on": YAML 1.1 resolves !!bool true, but YAML 1.2 resolves !!str "on"`,
+				`2:10: ambiguous scalar "yes": YAML 1.1 resolves !!bool true, but YAML 1.2 resolves !!str "yes"`,
+				`4:7: ambiguous scalar "1:30": YAML 1.1 resolves !!int 90, but YAML 1.2 resolves !!str "1:30"`,
+				`8:11: ambiguous scalar "1e3": YAML 1.1 resolves !!str "1e3", but YAML 1.2 resolves !!float 1000.0`,
+			},
+			expected: input,
+		},
+		"quotes ambiguous scalars": {
+			opts: []YAML11Opt{WithYAML11Fix(YAML11Quote)},
+			expected: trimmed(`"on": push
+				|enabled: "yes"
+				|mode: 0777
+				|time: "1:30"
+				|date: 2001-01-01
+				|quoted: "no"
+				|tagged: !!str off
+				|exponent: "1e3"
+				|fine: [true, 1.5, 10, text]`),
+		},
+		"rewrites ambiguous scalars to canonical forms": {
+			opts: []YAML11Opt{WithYAML11Fix(YAML11Canonical)},
+			expected: trimmed(`"on": push
+				|enabled: "yes"
+				|mode: 0777
+				|time: "1:30"
+				|date: 2001-01-01
+				|quoted: "no"
+				|tagged: !!str off
+				|exponent: 1000.0
+				|fine: [true, 1.5, 10, text]`),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+
+			v, err := NewVisitor(NewYAML11Handler(tt.opts...))
+			assert.NoError(t, err)
+			err = v.Visit(context.TODO(), &doc)
+
+			actual := make([]string, 0)
+			for _, e := range NodeErrors(err) {
+				actual = append(actual, e.Error())
+				var ambiguous *AmbiguousScalarError
+				assert.True(t, errors.As(e, &ambiguous))
+				assert.ErrorIs(t, e, ErrAmbiguousScalar)
+			}
+			assert.ElementsMatch(t, tt.errors, actual)
+
+			out, err := yaml.Marshal(&doc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(out))
+			if len(tt.errors) == 0 {
+				// the result is unambiguous, and resolved by YAML 1.2 as the original document's 1.2 interpretation
+				assert.NoError(t, v.Visit(context.TODO(), &doc))
+			}
+		})
+	}
+}
+
+func TestNewYAML11Handler_retainsYAML12Values(t *testing.T) {
+	tests := map[string]struct {
+		ambiguous bool
+	}{
+		"1_000":      {},
+		"0b101":      {},
+		"0x_1F":      {},
+		"-0x1F":      {},
+		"010":        {},
+		"0777":       {},
+		"2001-01-01": {},
+		"0o10":       {ambiguous: true},
+		"08":         {ambiguous: true},
+		"1e3":        {ambiguous: true},
+		"on":         {ambiguous: true},
+		"1:30":       {ambiguous: true},
+	}
+	for literal, tt := range tests {
+		t.Run(literal, func(t *testing.T) {
+			input := "value: " + literal + "\n"
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(input), &doc))
+			var expected map[string]any
+			assert.NoError(t, yaml.Unmarshal([]byte(input), &expected))
+
+			v, err := NewVisitor(NewYAML11Handler())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.ambiguous, v.Visit(context.TODO(), &doc) != nil)
+
+			v, err = NewVisitor(NewYAML11Handler(WithYAML11Fix(YAML11Canonical)))
+			assert.NoError(t, err)
+			assert.NoError(t, v.Visit(context.TODO(), &doc))
+			out, err := yaml.Marshal(&doc)
+			assert.NoError(t, err)
+			if !tt.ambiguous {
+				assert.Equal(t, input, string(out))
+			}
+
+			// the rewritten document is read by yaml.v3 as the original was
+			var actual map[string]any
+			assert.NoError(t, yaml.Unmarshal(out, &actual))
+			assert.Equal(t, expected, actual)
+		})
+	}
+}